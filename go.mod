@@ -1,3 +1,7 @@
 module github.com/chris-aubin/Uniswap-Simulator
 
 go 1.20
+
+require golang.org/x/crypto v0.17.0
+
+require golang.org/x/sys v0.15.0 // indirect
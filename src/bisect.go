@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/pool"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/simulation"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/transaction"
+)
+
+// Reads a file containing data for the simulation, panicking if it cannot be
+// read.
+func readDataFile(relPath string) []byte {
+	absPath, err := filepath.Abs(relPath)
+	if err != nil {
+		message := fmt.Sprintf("Failed to get absolute path to file %s: %v", relPath, err)
+		panic(message)
+	}
+	raw, err := os.ReadFile(absPath)
+	if err != nil {
+		message := fmt.Sprintf("Error reading file at path (relative path, absolute path): %s, %s, %v", relPath, absPath, err)
+		panic(message)
+	}
+	return raw
+}
+
+// Writes v to the given file as indented JSON.
+func writeJSONFile(relPath string, v interface{}) {
+	absPath, _ := filepath.Abs(relPath)
+	vJSON, _ := json.MarshalIndent(v, "", "    ")
+	f, _ := os.Create(absPath)
+	f.Write(vJSON)
+	f.Close()
+}
+
+// Replays the transactions on the pool (without a strategy) and returns the
+// index of the first transaction after which the pool state diverges from the
+// state recorded in the transaction (see simulation.CompareToRecorded), or
+// after which the pool would have reverted (as it succeeded on chain). The
+// pool is left in the state just before that transaction, so that it can be
+// inspected and the transaction executed again. Each transaction records the
+// state after it, so the first divergence is found in a single replay.
+// Returns -1, with all of the transactions executed, if none diverges.
+//
+// Arguments:
+// transactions -- The transactions to replay
+// p            -- The pool, in the state before the first transaction
+// swapMode     -- How swaps are replayed
+//
+// Returns:
+// The index of the first transaction that diverges, or -1
+func firstDivergence(transactions []transaction.Transaction, p *pool.Pool, swapMode transaction.SwapMode) int {
+	for i, t := range transactions {
+		snapshot := p.Snapshot()
+		_, err := transaction.Execute(t, p, swapMode)
+		if err != nil || len(simulation.CompareToRecorded(i, t, p)) > 0 {
+			p.Restore(snapshot)
+			p.Discard(snapshot)
+			return i
+		}
+		p.Discard(snapshot)
+	}
+	return -1
+}
+
+// Replays transactions.txt from pool.txt (without a strategy) and finds the
+// first transaction after which the simulated pool state diverges from the
+// state recorded on chain (see firstDivergence). The pool state just before
+// and just after it are dumped, along with the steps of the swap (if the
+// transaction is a swap).
+func bisect(args []string) {
+	flags := flag.NewFlagSet("bisect", flag.ExitOnError)
+	relPathToData := flags.String("data", "../data/testV21", "Path to file containing data for simulation")
+	relPathToResults := flags.String("results", "../results", "Path to folder in which to write the pool state before and after the diverging transaction")
+	swapModeName := flags.String("swapMode", "exactInput", "How recorded swaps are replayed (exactInput, pricePath or inferred)")
+	logSpec := flags.String("log", "", logUsage)
+	logFile := flags.String("logFile", "", "Path to file to write logs to (stderr by default)")
+	flags.Parse(args)
+	configureLogging(*logSpec, *logFile)
+
+	swapMode, err := transaction.ParseSwapMode(*swapModeName)
+	if err != nil {
+		panic(err)
+	}
+
+	transactions := getTransactions(readDataFile(*relPathToData + "/transactions.txt"))
+	p := getPoolState(readDataFile(*relPathToData + "/pool.txt"))
+	first := firstDivergence(transactions, p, swapMode)
+	if first == -1 {
+		fmt.Printf("No divergence found in %d transactions\n", len(transactions))
+		return
+	}
+	t := transactions[first]
+	writeJSONFile(*relPathToResults+"/bisectPoolBefore.txt", poolStateOutput(p))
+
+	var steps []*pool.StepComputations
+	if t.Method == "SWAP" {
+		if swapArgs, err := transaction.GetSwapArgs(t, p, swapMode); err == nil && swapArgs != nil {
+			if result, err := p.ComputeSwap(swapArgs.ZeroForOne, swapArgs.AmountSpecified, swapArgs.SqrtPriceLimitX96); err == nil {
+				steps = result.Steps
+			}
+		}
+	}
+	_, err = transaction.Execute(t, p, swapMode)
+	divergences := simulation.CompareToRecorded(first, t, p)
+
+	writeJSONFile(*relPathToResults+"/bisectPoolAfter.txt", poolStateOutput(p))
+	writeJSONFile(*relPathToResults+"/bisectSteps.txt", steps)
+	writeJSONFile(*relPathToResults+"/bisectDivergences.txt", divergences)
+
+	fmt.Printf("First divergence at transaction %d (block %d, %s)\n", first, t.BlockNo, t.Method)
+	if err != nil {
+		fmt.Printf("    failed: %v\n", err)
+	}
+	for _, d := range divergences {
+		fmt.Printf("    %s: expected %v, actual %v (relative error %g)\n", d.Field, d.Expected, d.Actual, d.RelativeError)
+	}
+	fmt.Printf("Pool state before and after, swap steps and divergences written to %s\n", *relPathToResults)
+}
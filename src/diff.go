@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/pool"
+)
+
+// Parses tolerances of the form "field=absolute:relative,...", e.g.
+// "balance0=1000:0,ticks.=0:1e-9".
+func parseTolerances(tolerancesRaw string) (map[string]pool.Tolerance, error) {
+	tolerances := make(map[string]pool.Tolerance)
+	if tolerancesRaw == "" {
+		return tolerances, nil
+	}
+	for _, toleranceRaw := range strings.Split(tolerancesRaw, ",") {
+		field, values, found := strings.Cut(toleranceRaw, "=")
+		if !found {
+			return nil, fmt.Errorf("tolerance %q must be of the form field=absolute:relative", toleranceRaw)
+		}
+		absoluteRaw, relativeRaw, found := strings.Cut(values, ":")
+		if !found {
+			return nil, fmt.Errorf("tolerance %q must be of the form field=absolute:relative", toleranceRaw)
+		}
+		absolute, ok := new(big.Int).SetString(absoluteRaw, 10)
+		if !ok {
+			return nil, fmt.Errorf("absolute tolerance %q for %s is not an integer", absoluteRaw, field)
+		}
+		relative, err := strconv.ParseFloat(relativeRaw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("relative tolerance %q for %s is not a number", relativeRaw, field)
+		}
+		tolerances[field] = pool.Tolerance{Absolute: absolute, Relative: relative}
+	}
+	return tolerances, nil
+}
+
+// Loads two pool states (in the same format as pool.txt) and reports the
+// fields that differ between them. Exits with status 1 if there are any
+// differences.
+func diff(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	absolute := flags.String("abs", "0", "Default absolute tolerance for numeric fields")
+	relative := flags.Float64("rel", 0, "Default relative tolerance for numeric fields")
+	tolerancesRaw := flags.String("tolerances", "", "Tolerances for fields with the given prefixes, e.g. \"balance0=1000:0,ticks.=0:1e-9\"")
+	outputJSON := flags.Bool("json", false, "Output the differences as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: diff [flags] path_to_pool_state_a path_to_pool_state_b")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	defaultAbsolute, ok := new(big.Int).SetString(*absolute, 10)
+	if !ok {
+		panic(fmt.Sprintf("Absolute tolerance %q is not an integer", *absolute))
+	}
+	fieldTolerances, err := parseTolerances(*tolerancesRaw)
+	if err != nil {
+		panic(err)
+	}
+	tolerances := &pool.Tolerances{
+		Default: pool.Tolerance{Absolute: defaultAbsolute, Relative: *relative},
+		Fields:  fieldTolerances,
+	}
+
+	a := getPoolState(readDataFile(flags.Arg(0)))
+	b := getPoolState(readDataFile(flags.Arg(1)))
+	differences := pool.Diff(a, b, tolerances)
+
+	if *outputJSON {
+		differencesJSON, _ := json.MarshalIndent(differences, "", "    ")
+		fmt.Println(string(differencesJSON))
+	} else {
+		for _, d := range differences {
+			fmt.Printf("%s: %s -> %s (relative error %g)\n", d.Field, d.A, d.B, d.RelativeError)
+		}
+		fmt.Printf("%d differences\n", len(differences))
+	}
+	if len(differences) > 0 {
+		os.Exit(1)
+	}
+}
@@ -30,6 +30,8 @@ var (
 	Q256 = new(big.Int)
 	Q128 = new(big.Int)
 	Q96  = new(big.Int)
+	// The maximum signed 256 bit integer (type(int256).max).
+	MaxInt256 = new(big.Int)
 	// Maximum unsigned integers for given number of bits.
 	MaxUint256 = new(big.Int)
 	MaxUint160 = new(big.Int)
@@ -61,6 +63,7 @@ func init() {
 	Q256.SetString("10000000000000000000000000000000000000000000000000000000000000000", 16)
 	Q128.SetString("100000000000000000000000000000000", 16)
 	Q96.SetString("1000000000000000000000000", 16)
+	MaxInt256.SetString("7fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", 16)
 	MaxUint256.SetString("ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", 16)
 	MaxUint160.SetString("ffffffffffffffffffffffffffffffffffffffff", 16)
 	MaxUint128.SetString("ffffffffffffffffffffffffffffffff", 16)
@@ -0,0 +1,169 @@
+// Package factory simulates the Uniswap V3 factory.
+//
+// Creates pools for pairs of tokens and fee tiers, and controls which fee
+// tiers (and their tick spacings) pools can be created with. Used to create
+// fresh pools, e.g. for synthetic scenarios and tests, rather than loading a
+// pool state from JSON.
+package factory
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/pool"
+)
+
+// The zero address, which cannot be a token of a pool.
+const zeroAddress = "0x0000000000000000000000000000000000000000"
+
+// Factory state.
+type Factory struct {
+	// Maps fee amounts (in hundredths of a bip) to the tick spacing of pools
+	// created with that fee. A fee amount can never be removed, so this value
+	// should be hard coded or cached in the calling context.
+	FeeAmountTickSpacing map[int]int
+	// Maps the key of each pool created by the factory (see poolKey) to the
+	// pool.
+	Pools map[string]*pool.Pool
+}
+
+// Make returns a new factory with the fee tiers enabled in the deployed
+// factory: 0.05% (tick spacing 10), 0.3% (tick spacing 60), 1% (tick spacing
+// 200) and 0.01% (tick spacing 1, enabled by governance after deployment).
+func Make() *Factory {
+	f := &Factory{
+		FeeAmountTickSpacing: make(map[int]int),
+		Pools:                make(map[string]*pool.Pool),
+	}
+	f.EnableFeeAmount(500, 10)
+	f.EnableFeeAmount(3000, 60)
+	f.EnableFeeAmount(10000, 200)
+	f.EnableFeeAmount(100, 1)
+	return f
+}
+
+// Returns the tokens sorted by address.
+func sortTokens(tokenA, tokenB string) (token0, token1 string) {
+	if strings.ToLower(tokenA) < strings.ToLower(tokenB) {
+		return tokenA, tokenB
+	}
+	return tokenB, tokenA
+}
+
+// Returns the key of the pool for the given (sorted) tokens and fee.
+func poolKey(token0, token1 string, fee int) string {
+	return fmt.Sprintf("%s%s%d", strings.ToLower(token0), strings.ToLower(token1), fee)
+}
+
+// Enables a fee amount with the given tick spacing. Fee amounts may never be
+// removed once enabled.
+//
+// Arguments:
+// fee         -- The fee amount to enable, denominated in hundredths of a bip
+//                (i.e. 1e-6)
+// tickSpacing -- The spacing between ticks to be enforced for all pools
+//                created with the given fee amount
+func (f *Factory) EnableFeeAmount(fee, tickSpacing int) {
+	if fee >= 1000000 {
+		message := fmt.Sprintf("factory.EnableFeeAmount: Fee %d must be less than 1000000", fee)
+		panic(message)
+	}
+	// Tick spacing is capped at 16384 to prevent the situation where
+	// tickSpacing is so large that TickBitmap#nextInitializedTickWithinOneWord
+	// overflows int24 container from a valid tick. 16384 ticks represents a
+	// >5x price change with ticks of 1 bips.
+	if tickSpacing <= 0 || tickSpacing >= 16384 {
+		message := fmt.Sprintf("factory.EnableFeeAmount: Tick spacing %d must be greater than 0 and less than 16384", tickSpacing)
+		panic(message)
+	}
+	if _, found := f.FeeAmountTickSpacing[fee]; found {
+		message := fmt.Sprintf("factory.EnableFeeAmount: Fee %d is already enabled", fee)
+		panic(message)
+	}
+	f.FeeAmountTickSpacing[fee] = tickSpacing
+}
+
+// Returns the pool for a given pair of tokens and a fee, or nil if it does
+// not exist. The tokens may be passed in either order.
+//
+// Arguments:
+// tokenA -- The contract address of either token0 or token1
+// tokenB -- The contract address of the other token
+// fee    -- The fee collected upon every swap in the pool, denominated in
+//           hundredths of a bip
+//
+// Returns:
+// The pool
+func (f *Factory) GetPool(tokenA, tokenB string, fee int) *pool.Pool {
+	token0, token1 := sortTokens(tokenA, tokenB)
+	return f.Pools[poolKey(token0, token1, fee)]
+}
+
+// Creates a pool for the given two tokens and fee. The tokens may be passed
+// in either order. The tick spacing is retrieved from the fee and the max
+// liquidity per tick is derived from the tick spacing. The pool must be
+// initialized (see pool.Initialize) before it is used.
+//
+// Arguments:
+// tokenA -- One of the two tokens in the desired pool
+// tokenB -- The other of the two tokens in the desired pool
+// fee    -- The desired fee for the pool
+//
+// Returns:
+// The newly created pool
+func (f *Factory) CreatePool(tokenA, tokenB string, fee int) *pool.Pool {
+	if strings.EqualFold(tokenA, tokenB) {
+		message := fmt.Sprintf("factory.CreatePool: Tokens must be different, got %s twice", tokenA)
+		panic(message)
+	}
+	token0, token1 := sortTokens(tokenA, tokenB)
+	if strings.EqualFold(token0, zeroAddress) {
+		panic("factory.CreatePool: Token cannot be the zero address")
+	}
+	tickSpacing, found := f.FeeAmountTickSpacing[fee]
+	if !found {
+		message := fmt.Sprintf("factory.CreatePool: Fee %d is not enabled", fee)
+		panic(message)
+	}
+	key := poolKey(token0, token1, fee)
+	if _, found := f.Pools[key]; found {
+		message := fmt.Sprintf("factory.CreatePool: Pool for %s, %s and fee %d already exists", token0, token1, fee)
+		panic(message)
+	}
+	p := pool.Make(token0, token1, fee, tickSpacing)
+	f.Pools[key] = p
+	return p
+}
+
+// Creates a pool for the given two tokens and fee if it does not exist, and
+// initializes it with the given price if it is not initialized.
+//
+// Arguments:
+// tokenA       -- One of the two tokens in the desired pool
+// tokenB       -- The other of the two tokens in the desired pool
+// fee          -- The desired fee for the pool
+// sqrtPriceX96 -- The initial square root price of the pool as a Q64.96
+//                 value
+//
+// Returns:
+// p            -- The pool
+// err          -- An error if the pool cannot be initialized with the given
+//                 price (see pool.Initialize), in which case a pool created
+//                 by this call is removed again
+func (f *Factory) CreateAndInitializePoolIfNecessary(tokenA, tokenB string, fee int, sqrtPriceX96 *big.Int) (p *pool.Pool, err error) {
+	p = f.GetPool(tokenA, tokenB, fee)
+	created := p == nil
+	if created {
+		p = f.CreatePool(tokenA, tokenB, fee)
+	}
+	if p.Slot0.SqrtPriceX96.Cmp(big.NewInt(0)) == 0 {
+		if err = p.Initialize(sqrtPriceX96); err != nil {
+			if created {
+				delete(f.Pools, poolKey(p.Token0, p.Token1, fee))
+			}
+			return nil, fmt.Errorf("factory.CreateAndInitializePoolIfNecessary: %w", err)
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,113 @@
+package factory
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/pool"
+)
+
+const (
+	tokenA = "0x1000000000000000000000000000000000000000"
+	tokenB = "0x2000000000000000000000000000000000000000"
+)
+
+func TestMakeFeeAmounts(t *testing.T) {
+	fmt.Println("Make: Enables the 0.01%, 0.05%, 0.3% and 1% fee tiers")
+	f := Make()
+	for fee, tickSpacing := range map[int]int{100: 1, 500: 10, 3000: 60, 10000: 200} {
+		if f.FeeAmountTickSpacing[fee] != tickSpacing {
+			t.Errorf("Fee %d: Got tick spacing %d; want %d", fee, f.FeeAmountTickSpacing[fee], tickSpacing)
+		}
+	}
+}
+
+func TestCreatePool(t *testing.T) {
+	fmt.Println("CreatePool: Sorts the tokens and uses the tick spacing of the fee tier")
+	f := Make()
+	p := f.CreatePool(tokenB, tokenA, 500)
+	if p.Token0 != tokenA || p.Token1 != tokenB || p.Fee != 500 || p.TickSpacing != 10 {
+		t.Errorf("Got %s, %s, %d, %d; want %s, %s, 500, 10", p.Token0, p.Token1, p.Fee, p.TickSpacing, tokenA, tokenB)
+	}
+	if f.GetPool(tokenA, tokenB, 500) != p || f.GetPool(tokenB, tokenA, 500) != p {
+		t.Errorf("Expected GetPool to return the created pool for both token orders")
+	}
+	if f.GetPool(tokenA, tokenB, 3000) != nil {
+		t.Errorf("Expected GetPool to return nil for a pool that does not exist")
+	}
+}
+
+func TestCreatePoolPanics(t *testing.T) {
+	tests := []struct {
+		description string
+		tokenA      string
+		tokenB      string
+		fee         int
+	}{
+		{"Panics if the tokens are the same", tokenA, tokenA, 500},
+		{"Panics if a token is the zero address", zeroAddress, tokenA, 500},
+		{"Panics if the fee is not enabled", tokenA, tokenB, 250},
+		{"Panics if the pool already exists", tokenA, tokenB, 3000},
+	}
+	f := Make()
+	f.CreatePool(tokenA, tokenB, 3000)
+	for _, test := range tests {
+		fmt.Println("CreatePool: " + test.description)
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("CreatePool(%s, %s, %d): Expected panic", test.tokenA, test.tokenB, test.fee)
+				}
+			}()
+			f.CreatePool(test.tokenA, test.tokenB, test.fee)
+		}()
+	}
+}
+
+func TestEnableFeeAmount(t *testing.T) {
+	fmt.Println("EnableFeeAmount: Enables custom fee tiers and panics for invalid or enabled ones")
+	f := Make()
+	f.EnableFeeAmount(250, 5)
+	if p := f.CreatePool(tokenA, tokenB, 250); p.TickSpacing != 5 {
+		t.Errorf("Got tick spacing %d; want 5", p.TickSpacing)
+	}
+	for _, args := range [][2]int{{1000000, 1}, {100, 1}, {200, 0}, {200, 16384}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("EnableFeeAmount(%d, %d): Expected panic", args[0], args[1])
+				}
+			}()
+			f.EnableFeeAmount(args[0], args[1])
+		}()
+	}
+}
+
+func TestCreateAndInitializePoolIfNecessary(t *testing.T) {
+	fmt.Println("CreateAndInitializePoolIfNecessary: Creates and initializes the pool once")
+	f := Make()
+	price := new(big.Int).Lsh(big.NewInt(1), 96)
+	p, err := f.CreateAndInitializePoolIfNecessary(tokenA, tokenB, 3000, price)
+	if err != nil {
+		t.Fatalf("CreateAndInitializePoolIfNecessary failed: %v", err)
+	}
+	if p.Slot0.SqrtPriceX96.Cmp(price) != 0 || p.Slot0.Tick != 0 {
+		t.Errorf("Got price %v, tick %d; want %v, 0", p.Slot0.SqrtPriceX96, p.Slot0.Tick, price)
+	}
+	if existing, err := f.CreateAndInitializePoolIfNecessary(tokenB, tokenA, 3000, big.NewInt(1)); err != nil || existing != p {
+		t.Errorf("Got %p, %v; want the existing pool", existing, err)
+	}
+	if p.Slot0.SqrtPriceX96.Cmp(price) != 0 {
+		t.Errorf("Expected the existing pool not to be reinitialized")
+	}
+
+	// A pool that cannot be initialized is not created.
+	if _, err := f.CreateAndInitializePoolIfNecessary(tokenA, tokenB, 500, big.NewInt(1)); !errors.Is(err, pool.ErrInvalidSqrtPrice) {
+		t.Errorf("Expected %v, got %v", pool.ErrInvalidSqrtPrice, err)
+	}
+	if f.GetPool(tokenA, tokenB, 500) != nil {
+		t.Errorf("Expected the pool not to be created")
+	}
+}
@@ -0,0 +1,232 @@
+// Package logging provides levelled, structured logging for the simulator.
+//
+// Each package logs to its own subsystem (e.g. "pool" or "transaction"), and
+// the level of each subsystem can be set separately (see Configure). Logging
+// is off by default. Checking whether a level is enabled is a single atomic
+// load, so call sites in hot paths should check Enabled before building their
+// fields, so that the simulation is not slowed down unless logging has been
+// turned on.
+//
+// Lines are written in logfmt, e.g.
+//
+//	level=debug subsystem=pool msg=mint owner=0xC tickLower=-60 tickUpper=60
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Level is the severity of a log line.
+type Level int32
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+	// Disables logging, the default level of every subsystem.
+	Off
+)
+
+// Names used to select a level (e.g. from the command line).
+var levelNames = map[string]Level{
+	"debug": Debug,
+	"info":  Info,
+	"warn":  Warn,
+	"error": Error,
+	"off":   Off,
+}
+
+// ParseLevel returns the level with the given name.
+func ParseLevel(name string) (Level, error) {
+	level, found := levelNames[strings.ToLower(name)]
+	if !found {
+		return 0, fmt.Errorf("logging.ParseLevel: Unknown level %q", name)
+	}
+	return level, nil
+}
+
+// String returns the name of the level.
+func (l Level) String() string {
+	for name, level := range levelNames {
+		if level == l {
+			return name
+		}
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// Field is a key-value pair added to a log line.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F returns a field with the given key and value. The value is formatted with
+// fmt's %v verb (so *big.Int values are printed in full) only if the line is
+// written.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger writes the log lines of a subsystem.
+type Logger struct {
+	subsystem string
+	level     int32
+}
+
+var (
+	// The loggers of the subsystems, by name.
+	loggers   = make(map[string]*Logger)
+	loggersMu sync.Mutex
+	// Where log lines are written, stderr by default.
+	output   io.Writer = os.Stderr
+	outputMu sync.Mutex
+)
+
+// Get returns the logger of the given subsystem, creating it (with logging
+// off) if it does not exist yet. Packages call Get once, when they are
+// initialized.
+func Get(subsystem string) *Logger {
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+	logger, found := loggers[subsystem]
+	if !found {
+		logger = &Logger{subsystem: subsystem, level: int32(Off)}
+		loggers[subsystem] = logger
+	}
+	return logger
+}
+
+// Subsystems returns the names of the subsystems that have a logger, sorted.
+func Subsystems() []string {
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+	subsystems := make([]string, 0, len(loggers))
+	for subsystem := range loggers {
+		subsystems = append(subsystems, subsystem)
+	}
+	sort.Strings(subsystems)
+	return subsystems
+}
+
+// SetOutput sets where log lines are written for every subsystem.
+func SetOutput(w io.Writer) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	output = w
+}
+
+// SetLevel sets the minimum level of the lines written by the subsystem.
+func (l *Logger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+// Enabled returns true iff lines of the given level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return level < Off && int32(level) >= atomic.LoadInt32(&l.level)
+}
+
+// Configure sets the levels of subsystems from a comma separated list of
+// subsystem=level pairs, e.g. "pool=debug,transaction=info". The subsystem
+// "*" sets the level of every subsystem, and a level without a subsystem
+// (e.g. "info") is the same as "*=info". Pairs are applied in order, so
+// "*=info,pool=off" logs everything but the pool at info.
+//
+// Arguments:
+// spec -- The subsystem=level pairs
+//
+// Returns:
+// err  -- An error if a level is unknown or a subsystem has no logger
+func Configure(spec string) error {
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		subsystem, levelName, found := strings.Cut(pair, "=")
+		if !found {
+			subsystem, levelName = "*", pair
+		}
+		level, err := ParseLevel(levelName)
+		if err != nil {
+			return fmt.Errorf("logging.Configure: %w", err)
+		}
+		if subsystem == "*" {
+			for _, name := range Subsystems() {
+				Get(name).SetLevel(level)
+			}
+			continue
+		}
+		loggersMu.Lock()
+		logger, found := loggers[subsystem]
+		loggersMu.Unlock()
+		if !found {
+			return fmt.Errorf("logging.Configure: Unknown subsystem %q (known subsystems: %s)", subsystem, strings.Join(Subsystems(), ", "))
+		}
+		logger.SetLevel(level)
+	}
+	return nil
+}
+
+// Log writes a line with the given level, message and fields, if the level
+// is enabled.
+func (l *Logger) Log(level Level, msg string, fields ...Field) {
+	if !l.Enabled(level) {
+		return
+	}
+	var line bytes.Buffer
+	line.WriteString("level=")
+	line.WriteString(level.String())
+	line.WriteString(" subsystem=")
+	writeValue(&line, l.subsystem)
+	line.WriteString(" msg=")
+	writeValue(&line, msg)
+	for _, field := range fields {
+		line.WriteByte(' ')
+		line.WriteString(field.Key)
+		line.WriteByte('=')
+		writeValue(&line, fmt.Sprintf("%v", field.Value))
+	}
+	line.WriteByte('\n')
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	output.Write(line.Bytes())
+}
+
+// Writes the value, quoted if it is empty or contains spaces, quotes or '='.
+func writeValue(line *bytes.Buffer, value string) {
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		line.WriteString(strconv.Quote(value))
+		return
+	}
+	line.WriteString(value)
+}
+
+// Debug writes a line at the debug level.
+func (l *Logger) Debug(msg string, fields ...Field) {
+	l.Log(Debug, msg, fields...)
+}
+
+// Info writes a line at the info level.
+func (l *Logger) Info(msg string, fields ...Field) {
+	l.Log(Info, msg, fields...)
+}
+
+// Warn writes a line at the warn level.
+func (l *Logger) Warn(msg string, fields ...Field) {
+	l.Log(Warn, msg, fields...)
+}
+
+// Error writes a line at the error level.
+func (l *Logger) Error(msg string, fields ...Field) {
+	l.Log(Error, msg, fields...)
+}
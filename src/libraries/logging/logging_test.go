@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestLoggerOffByDefault(t *testing.T) {
+	fmt.Println("Logger: Writes nothing until a level is set")
+	var out bytes.Buffer
+	SetOutput(&out)
+	logger := Get("testOff")
+	logger.Error("message")
+	if logger.Enabled(Error) || out.Len() != 0 {
+		t.Errorf("Expected nothing to be written, got %q", out.String())
+	}
+}
+
+func TestLoggerWritesFields(t *testing.T) {
+	fmt.Println("Logger: Writes lines at or above the level in logfmt")
+	var out bytes.Buffer
+	SetOutput(&out)
+	logger := Get("testFields")
+	logger.SetLevel(Info)
+	logger.Debug("hidden")
+	logger.Info("mint", F("tick", -60), F("amount", big.NewInt(100)), F("note", "two words"))
+	want := "level=info subsystem=testFields msg=mint tick=-60 amount=100 note=\"two words\"\n"
+	if out.String() != want {
+		t.Errorf("Got %q; want %q", out.String(), want)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	fmt.Println("Configure: Sets the levels of the subsystems")
+	a, b := Get("testA"), Get("testB")
+	if err := Configure("*=warn, testA=debug"); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	if !a.Enabled(Debug) || b.Enabled(Info) || !b.Enabled(Warn) {
+		t.Errorf("Expected testA at debug and testB at warn")
+	}
+	if err := Configure("off"); err != nil || a.Enabled(Error) {
+		t.Errorf("Expected every subsystem to be off, got %v", err)
+	}
+	if err := Configure("testA=loud"); err == nil || !strings.Contains(err.Error(), "loud") {
+		t.Errorf("Expected an error for an unknown level, got %v", err)
+	}
+	if err := Configure("unknown=debug"); err == nil {
+		t.Errorf("Expected an error for an unknown subsystem")
+	}
+}
@@ -0,0 +1,437 @@
+// Package oracle simulates the Uniswap Oracle library.
+//
+// Provides price and liquidity data useful for a wide variety of system
+// designs. Instances of stored oracle data, "observations", are collected in
+// the oracle array. Every pool is initialized with an oracle array length of 1.
+// Anyone can pay to increase the maximum length of the oracle array, new slots
+// will be added when the array is fully populated. Observations are
+// overwritten when the full length of the oracle array is populated. The most
+// recent observation is available, independent of the length of the oracle
+// array, by passing 0 to Observe.
+//
+// As in the deployed contract, timestamps are uint32s, so all timestamp
+// arithmetic wraps around (once every 136 years).
+package oracle
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/constants"
+)
+
+// The maximum length of the oracle array (type(uint16).max).
+const MaxCardinality = 65535
+
+// Errors returned by oracle operations, wrapped with the details of the
+// failed operation (check them with errors.Is).
+var (
+	// The oracle array has not been initialized (I in the deployed
+	// contract).
+	ErrNotInitialized = errors.New("oracle array is not initialized")
+	// The requested cardinality is greater than MaxCardinality (the deployed
+	// contract takes a uint16).
+	ErrCardinalityTooHigh = errors.New("cardinality is greater than the maximum cardinality")
+	// An observation was requested for a time before the oldest observation
+	// (OLD).
+	ErrObservationTooOld = errors.New("target is older than the oldest observation")
+)
+
+// A single oracle observation.
+type Observation struct {
+	// The block timestamp of the observation.
+	BlockTimestamp uint32
+	// The tick accumulator, i.e. tick * time elapsed since the pool was first
+	// initialized.
+	TickCumulative int64
+	// The seconds per liquidity, i.e. seconds elapsed / max(1, liquidity)
+	// since the pool was first initialized.
+	SecondsPerLiquidityCumulativeX128 *big.Int
+	// Whether or not the observation is initialized.
+	Initialized bool
+}
+
+// The oracle array. Unlike in the deployed contract, in which the array has
+// a fixed length of 65535, the slice only grows as the cardinality is
+// increased.
+type Observations []Observation
+
+// Returns a deep copy of the observations, i.e. observations that share no
+// big.Ints (or backing array) with the original. Returns nil if there are no
+// observations.
+func (o Observations) Copy() Observations {
+	if o == nil {
+		return nil
+	}
+	observations := make(Observations, len(o), cap(o))
+	for i, observation := range o {
+		if observation.SecondsPerLiquidityCumulativeX128 != nil {
+			observation.SecondsPerLiquidityCumulativeX128 = new(big.Int).Set(observation.SecondsPerLiquidityCumulativeX128)
+		}
+		observations[i] = observation
+	}
+	return observations
+}
+
+// Transforms a previous observation into a new observation, given the passage
+// of time and the current tick and liquidity values. The block timestamp must
+// be chronologically equal to or greater than last.BlockTimestamp, safe for 0
+// or 1 overflows.
+//
+// Arguments:
+// last           -- The specified observation to be transformed
+// blockTimestamp -- The timestamp of the new observation
+// tick           -- The active tick at the time of the new observation
+// liquidity      -- The total in-range liquidity at the time of the new
+//                   observation
+//
+// Returns:
+// The newly populated observation
+func transform(last Observation, blockTimestamp uint32, tick int, liquidity *big.Int) Observation {
+	delta := blockTimestamp - last.BlockTimestamp
+	if liquidity.Cmp(big.NewInt(0)) <= 0 {
+		liquidity = big.NewInt(1)
+	}
+	secondsPerLiquidityX128 := new(big.Int).Div(new(big.Int).Lsh(big.NewInt(int64(delta)), 128), liquidity)
+	secondsPerLiquidityCumulativeX128 := new(big.Int).Add(last.SecondsPerLiquidityCumulativeX128, secondsPerLiquidityX128)
+	return Observation{
+		BlockTimestamp:                    blockTimestamp,
+		TickCumulative:                    last.TickCumulative + int64(tick)*int64(delta),
+		SecondsPerLiquidityCumulativeX128: secondsPerLiquidityCumulativeX128.And(secondsPerLiquidityCumulativeX128, constants.MaxUint160),
+		Initialized:                       true,
+	}
+}
+
+// Initializes the oracle array by writing the first slot. Called once for
+// the lifecycle of the observations array.
+//
+// Arguments:
+// blockTimestamp  -- The time of the oracle initialization
+//
+// Returns:
+// cardinality     -- The number of populated elements in the oracle array
+// cardinalityNext -- The new length of the oracle array, independent of
+//                    population
+func (o *Observations) Initialize(blockTimestamp uint32) (cardinality, cardinalityNext int) {
+	*o = Observations{{
+		BlockTimestamp:                    blockTimestamp,
+		TickCumulative:                    0,
+		SecondsPerLiquidityCumulativeX128: big.NewInt(0),
+		Initialized:                       true,
+	}}
+	return 1, 1
+}
+
+// Writes an oracle observation to the array. Writable at most once per block.
+// Index represents the most recently written element. Cardinality and index
+// must be tracked externally. If the index is at the end of the allowable
+// array length (according to cardinality), and the next cardinality is
+// greater than the current one, cardinality may be increased. This
+// restriction is created to preserve ordering.
+//
+// Arguments:
+// index              -- The index of the observation that was most recently
+//                       written to the observations array
+// blockTimestamp     -- The timestamp of the new observation
+// tick               -- The active tick at the time of the new observation
+// liquidity          -- The total in-range liquidity at the time of the new
+//                       observation
+// cardinality        -- The number of populated elements in the oracle array
+// cardinalityNext    -- The new length of the oracle array, independent of
+//                       population
+//
+// Returns:
+// indexUpdated       -- The new index of the most recently written element in
+//                       the oracle array
+// cardinalityUpdated -- The new cardinality of the oracle array
+func (o *Observations) Write(index int, blockTimestamp uint32, tick int, liquidity *big.Int, cardinality, cardinalityNext int) (indexUpdated, cardinalityUpdated int) {
+	last := (*o)[index]
+
+	// Early return if we've already written an observation this block.
+	if last.BlockTimestamp == blockTimestamp {
+		return index, cardinality
+	}
+
+	// If the conditions are right, we can bump the cardinality.
+	if cardinalityNext > cardinality && index == cardinality-1 {
+		cardinalityUpdated = cardinalityNext
+	} else {
+		cardinalityUpdated = cardinality
+	}
+
+	indexUpdated = (index + 1) % cardinalityUpdated
+	(*o)[indexUpdated] = transform(last, blockTimestamp, tick, liquidity)
+	return
+}
+
+// Prepares the oracle array to store up to next observations.
+//
+// Arguments:
+// current -- The current next cardinality of the oracle array
+// next    -- The proposed next cardinality which will be populated in the
+//            oracle array
+//
+// Returns:
+// next -- The next cardinality which will be populated in the oracle array
+// err  -- ErrNotInitialized or ErrCardinalityTooHigh
+func (o *Observations) Grow(current, next int) (int, error) {
+	if current <= 0 {
+		return 0, fmt.Errorf("oracle.Grow: %w", ErrNotInitialized)
+	}
+	if next > MaxCardinality {
+		return 0, fmt.Errorf("oracle.Grow: %w (cardinality %d, maximum %d)", ErrCardinalityTooHigh, next, MaxCardinality)
+	}
+	// No-op if the passed next value isn't greater than the current next
+	// value.
+	if next <= current {
+		return current, nil
+	}
+	// The new slots are uninitialized (the deployed contract stores 1 in
+	// each slot to prevent fresh SSTOREs in swaps).
+	for len(*o) < next {
+		*o = append(*o, Observation{SecondsPerLiquidityCumulativeX128: big.NewInt(0)})
+	}
+	return next, nil
+}
+
+// Comparator for 32-bit timestamps, safe for 0 or 1 overflows. a and b must
+// be chronologically before or equal to time.
+//
+// Arguments:
+// time -- A timestamp truncated to 32 bits
+// a    -- A comparison timestamp from which to determine the relative
+//         position of time
+// b    -- From which to determine the relative position of time
+//
+// Returns:
+// Whether a is chronologically <= b
+func lte(time, a, b uint32) bool {
+	// If there hasn't been overflow, no need to adjust.
+	if a <= time && b <= time {
+		return a <= b
+	}
+	aAdjusted, bAdjusted := uint64(a), uint64(b)
+	if a <= time {
+		aAdjusted += 1 << 32
+	}
+	if b <= time {
+		bAdjusted += 1 << 32
+	}
+	return aAdjusted <= bAdjusted
+}
+
+// Fetches the observations beforeOrAt and atOrAfter a target, i.e. where
+// [beforeOrAt, atOrAfter] is satisfied. The result may be the same
+// observation, or adjacent observations. The answer must be contained in the
+// array, used when the target is located within the stored observation
+// boundaries: older than the most recent observation and younger, or the same
+// age as, the oldest observation.
+//
+// Arguments:
+// time        -- The current block timestamp
+// target      -- The timestamp at which the reserved observation should be
+//                for
+// index       -- The index of the observation that was most recently written
+//                to the observations array
+// cardinality -- The number of populated elements in the oracle array
+//
+// Returns:
+// beforeOrAt  -- The observation recorded before, or at, the target
+// atOrAfter   -- The observation recorded at, or after, the target
+func (o Observations) binarySearch(time, target uint32, index, cardinality int) (beforeOrAt, atOrAfter Observation) {
+	l := (index + 1) % cardinality // Oldest observation.
+	r := l + cardinality - 1       // Newest observation.
+	for {
+		i := (l + r) / 2
+		beforeOrAt = o[i%cardinality]
+
+		// We've landed on an uninitialized tick, keep searching higher (more
+		// recently).
+		if !beforeOrAt.Initialized {
+			l = i + 1
+			continue
+		}
+
+		atOrAfter = o[(i+1)%cardinality]
+		targetAtOrAfter := lte(time, beforeOrAt.BlockTimestamp, target)
+
+		// Check if we've found the answer!
+		if targetAtOrAfter && lte(time, target, atOrAfter.BlockTimestamp) {
+			return
+		}
+
+		if !targetAtOrAfter {
+			r = i - 1
+		} else {
+			l = i + 1
+		}
+	}
+}
+
+// Fetches the observations beforeOrAt and atOrAfter a given target, i.e.
+// where [beforeOrAt, atOrAfter] is satisfied. Returns ErrObservationTooOld
+// if the target is older than the oldest observation.
+//
+// Arguments:
+// time        -- The current block timestamp
+// target      -- The timestamp at which the reserved observation should be
+//                for
+// tick        -- The active tick at the time of the returned or simulated
+//                observation
+// index       -- The index of the observation that was most recently written
+//                to the observations array
+// liquidity   -- The total pool liquidity at the time of the call
+// cardinality -- The number of populated elements in the oracle array
+//
+// Returns:
+// beforeOrAt  -- The observation which occurred at, or before, the given
+//                timestamp
+// atOrAfter   -- The observation which occurred at, or after, the given
+//                timestamp
+// err         -- ErrObservationTooOld if the target is older than the oldest
+//                observation
+func (o Observations) getSurroundingObservations(time, target uint32, tick, index int, liquidity *big.Int, cardinality int) (beforeOrAt, atOrAfter Observation, err error) {
+	// Optimistically set before to the newest observation.
+	beforeOrAt = o[index]
+
+	// If the target is chronologically at or after the newest observation,
+	// we can early return.
+	if lte(time, beforeOrAt.BlockTimestamp, target) {
+		if beforeOrAt.BlockTimestamp == target {
+			// If newest observation equals target, we're in the same block,
+			// so we can ignore atOrAfter.
+			return beforeOrAt, atOrAfter, nil
+		}
+		// Otherwise, we need to transform.
+		return beforeOrAt, transform(beforeOrAt, target, tick, liquidity), nil
+	}
+
+	// Now, set before to the oldest observation. The deployed contract falls
+	// back to the first slot if the slot after the newest observation is
+	// uninitialized, which is the oldest observation unless the oracle was
+	// seeded part way through the array (see pool.SetBlockTimestamp), so the
+	// first initialized slot after the newest observation is used instead.
+	oldest := (index + 1) % cardinality
+	for !o[oldest].Initialized {
+		oldest = (oldest + 1) % cardinality
+	}
+	beforeOrAt = o[oldest]
+
+	// Ensure that the target is chronologically at or after the oldest
+	// observation.
+	if !lte(time, beforeOrAt.BlockTimestamp, target) {
+		return Observation{}, Observation{}, fmt.Errorf("oracle.getSurroundingObservations: %w (target %d, oldest observation %d)", ErrObservationTooOld, target, beforeOrAt.BlockTimestamp)
+	}
+
+	// If we've reached this point, we have to binary search.
+	beforeOrAt, atOrAfter = o.binarySearch(time, target, index, cardinality)
+	return beforeOrAt, atOrAfter, nil
+}
+
+// Returns the accumulator values as of secondsAgo seconds ago from the given
+// time. Returns ErrObservationTooOld if the observation at or before the
+// desired observation timestamp does not exist. 0 may be passed as secondsAgo to return the
+// current cumulative values. If called with a timestamp falling between two
+// observations, returns the counterfactual accumulator values at exactly the
+// timestamp between the two observations.
+//
+// Arguments:
+// time                              -- The current block timestamp
+// secondsAgo                        -- The amount of time to look back, in
+//                                      seconds, at which point to return an
+//                                      observation
+// tick                              -- The current tick
+// index                             -- The index of the observation that was
+//                                      most recently written to the
+//                                      observations array
+// liquidity                         -- The current in-range pool liquidity
+// cardinality                       -- The number of populated elements in
+//                                      the oracle array
+//
+// Returns:
+// tickCumulative                    -- The tick * time elapsed since the pool
+//                                      was first initialized, as of
+//                                      secondsAgo
+// secondsPerLiquidityCumulativeX128 -- The time elapsed / max(1, liquidity)
+//                                      since the pool was first initialized,
+//                                      as of secondsAgo
+// err                               -- ErrObservationTooOld if secondsAgo is
+//                                      before the oldest observation
+func (o Observations) ObserveSingle(time, secondsAgo uint32, tick, index int, liquidity *big.Int, cardinality int) (tickCumulative int64, secondsPerLiquidityCumulativeX128 *big.Int, err error) {
+	if secondsAgo == 0 {
+		last := o[index]
+		if last.BlockTimestamp != time {
+			last = transform(last, time, tick, liquidity)
+		}
+		return last.TickCumulative, last.SecondsPerLiquidityCumulativeX128, nil
+	}
+
+	target := time - secondsAgo
+	beforeOrAt, atOrAfter, err := o.getSurroundingObservations(time, target, tick, index, liquidity, cardinality)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if target == beforeOrAt.BlockTimestamp {
+		// We're at the left boundary.
+		return beforeOrAt.TickCumulative, beforeOrAt.SecondsPerLiquidityCumulativeX128, nil
+	} else if target == atOrAfter.BlockTimestamp {
+		// We're at the right boundary.
+		return atOrAfter.TickCumulative, atOrAfter.SecondsPerLiquidityCumulativeX128, nil
+	}
+
+	// We're in the middle.
+	observationTimeDelta := int64(atOrAfter.BlockTimestamp - beforeOrAt.BlockTimestamp)
+	targetDelta := int64(target - beforeOrAt.BlockTimestamp)
+	tickCumulative = beforeOrAt.TickCumulative + ((atOrAfter.TickCumulative-beforeOrAt.TickCumulative)/observationTimeDelta)*targetDelta
+	secondsPerLiquidityDelta := new(big.Int).Sub(atOrAfter.SecondsPerLiquidityCumulativeX128, beforeOrAt.SecondsPerLiquidityCumulativeX128)
+	secondsPerLiquidityDelta.And(secondsPerLiquidityDelta, constants.MaxUint160)
+	secondsPerLiquidityDelta.Mul(secondsPerLiquidityDelta, big.NewInt(targetDelta))
+	secondsPerLiquidityDelta.Div(secondsPerLiquidityDelta, big.NewInt(observationTimeDelta))
+	secondsPerLiquidityCumulativeX128 = new(big.Int).Add(beforeOrAt.SecondsPerLiquidityCumulativeX128, secondsPerLiquidityDelta)
+	secondsPerLiquidityCumulativeX128.And(secondsPerLiquidityCumulativeX128, constants.MaxUint160)
+	return
+}
+
+// Returns the accumulator values as of each time seconds ago from the given
+// time in the array of secondsAgos. Returns ErrObservationTooOld if any of
+// the secondsAgos is before the oldest observation.
+//
+// Arguments:
+// time                               -- The current block timestamp
+// secondsAgos                        -- Each amount of time to look back, in
+//                                       seconds, at which point to return an
+//                                       observation
+// tick                               -- The current tick
+// index                              -- The index of the observation that was
+//                                       most recently written to the
+//                                       observations array
+// liquidity                          -- The current in-range pool liquidity
+// cardinality                        -- The number of populated elements in
+//                                       the oracle array
+//
+// Returns:
+// tickCumulatives                    -- The tick * time elapsed since the
+//                                       pool was first initialized, as of
+//                                       each secondsAgo
+// secondsPerLiquidityCumulativeX128s -- The cumulative seconds / max(1,
+//                                       liquidity) since the pool was first
+//                                       initialized, as of each secondsAgo
+// err                                -- ErrNotInitialized or
+//                                       ErrObservationTooOld
+func (o Observations) Observe(time uint32, secondsAgos []uint32, tick, index int, liquidity *big.Int, cardinality int) (tickCumulatives []int64, secondsPerLiquidityCumulativeX128s []*big.Int, err error) {
+	if cardinality <= 0 {
+		return nil, nil, fmt.Errorf("oracle.Observe: %w", ErrNotInitialized)
+	}
+
+	tickCumulatives = make([]int64, len(secondsAgos))
+	secondsPerLiquidityCumulativeX128s = make([]*big.Int, len(secondsAgos))
+	for i, secondsAgo := range secondsAgos {
+		tickCumulatives[i], secondsPerLiquidityCumulativeX128s[i], err = o.ObserveSingle(time, secondsAgo, tick, index, liquidity, cardinality)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return tickCumulatives, secondsPerLiquidityCumulativeX128s, nil
+}
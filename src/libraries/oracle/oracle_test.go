@@ -0,0 +1,170 @@
+package oracle
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+// Returns (seconds << 128) / liquidity, i.e. the seconds per liquidity
+// accumulated over the given number of seconds.
+func secondsPerLiquidity(seconds, liquidity int64) *big.Int {
+	return new(big.Int).Div(new(big.Int).Lsh(big.NewInt(seconds), 128), big.NewInt(liquidity))
+}
+
+func TestInitialize(t *testing.T) {
+	fmt.Println("Initialize: Index is 0, cardinality is 1 and the first slot is populated")
+	var o Observations
+	cardinality, cardinalityNext := o.Initialize(1)
+	if cardinality != 1 || cardinalityNext != 1 {
+		t.Errorf("Got cardinality %d, cardinalityNext %d; want 1, 1", cardinality, cardinalityNext)
+	}
+	if !o[0].Initialized || o[0].BlockTimestamp != 1 || o[0].TickCumulative != 0 || o[0].SecondsPerLiquidityCumulativeX128.Cmp(big.NewInt(0)) != 0 {
+		t.Errorf("Got observation %+v; want initialized observation at 1 with zero accumulators", o[0])
+	}
+}
+
+func TestGrow(t *testing.T) {
+	fmt.Println("Grow: Increases the cardinality next and does not touch the first slot")
+	var o Observations
+	o.Initialize(1)
+	if next, err := o.Grow(1, 5); err != nil || next != 5 {
+		t.Errorf("Got %d, %v; want 5", next, err)
+	}
+	if len(o) != 5 {
+		t.Errorf("Got %d slots; want 5", len(o))
+	}
+	for i := 1; i < 5; i++ {
+		if o[i].Initialized {
+			t.Errorf("Expected slot %d to be uninitialized", i)
+		}
+	}
+	if !o[0].Initialized {
+		t.Errorf("Expected slot 0 to be initialized")
+	}
+	if next, err := o.Grow(5, 3); err != nil || next != 5 {
+		t.Errorf("Grow is a no-op if less than current, got %d, %v; want 5", next, err)
+	}
+}
+
+func TestGrowErrors(t *testing.T) {
+	fmt.Println("Grow: Returns an error if the array is not initialized or the cardinality is too high")
+	var o Observations
+	if _, err := o.Grow(0, 5); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("Expected ErrNotInitialized, got %v", err)
+	}
+	o.Initialize(1)
+	if _, err := o.Grow(1, MaxCardinality+1); !errors.Is(err, ErrCardinalityTooHigh) {
+		t.Errorf("Expected ErrCardinalityTooHigh, got %v", err)
+	}
+	if len(o) != 1 {
+		t.Errorf("Got %d slots; want 1", len(o))
+	}
+}
+
+func TestWriteSameBlock(t *testing.T) {
+	fmt.Println("Write: Does nothing if time has not changed")
+	var o Observations
+	o.Initialize(0)
+	o.Grow(1, 2)
+	index, cardinality := o.Write(0, 0, 3, big.NewInt(2), 1, 2)
+	if index != 0 || cardinality != 1 {
+		t.Errorf("Got index %d, cardinality %d; want 0, 1", index, cardinality)
+	}
+}
+
+func TestWriteAccumulates(t *testing.T) {
+	fmt.Println("Write: Accumulates tick and seconds per liquidity (single element array is overwritten)")
+	var o Observations
+	o.Initialize(0)
+	index, cardinality := o.Write(0, 3, -5, big.NewInt(5), 1, 1)
+	if index != 0 || cardinality != 1 {
+		t.Errorf("Got index %d, cardinality %d; want 0, 1", index, cardinality)
+	}
+	o.Write(0, 7, 1, big.NewInt(2), 1, 1)
+	o.Write(0, 12, -7, big.NewInt(6), 1, 1)
+	expected := new(big.Int).Add(secondsPerLiquidity(3, 5), secondsPerLiquidity(4, 2))
+	expected.Add(expected, secondsPerLiquidity(5, 6))
+	if o[0].BlockTimestamp != 12 || o[0].TickCumulative != -15+4-35 || o[0].SecondsPerLiquidityCumulativeX128.Cmp(expected) != 0 {
+		t.Errorf("Got observation %+v; want timestamp 12, tickCumulative %d, secondsPerLiquidityCumulativeX128 %v", o[0], -15+4-35, expected)
+	}
+}
+
+func TestWriteZeroLiquidity(t *testing.T) {
+	fmt.Println("Write: Treats zero liquidity as one when accumulating seconds per liquidity")
+	var o Observations
+	o.Initialize(0)
+	o.Write(0, 3, 1, big.NewInt(0), 1, 1)
+	if o[0].SecondsPerLiquidityCumulativeX128.Cmp(secondsPerLiquidity(3, 1)) != 0 {
+		t.Errorf("Got %v; want %v", o[0].SecondsPerLiquidityCumulativeX128, secondsPerLiquidity(3, 1))
+	}
+}
+
+func TestWriteGrowsCardinality(t *testing.T) {
+	fmt.Println("Write: Grows cardinality when writing past the end of the array and wraps around")
+	var o Observations
+	o.Initialize(0)
+	o.Grow(1, 3)
+	index, cardinality := o.Write(0, 1, 0, big.NewInt(1), 1, 3)
+	if index != 1 || cardinality != 3 {
+		t.Errorf("Got index %d, cardinality %d; want 1, 3", index, cardinality)
+	}
+	index, cardinality = o.Write(index, 2, 0, big.NewInt(1), cardinality, 3)
+	index, cardinality = o.Write(index, 3, 0, big.NewInt(1), cardinality, 3)
+	if index != 0 || cardinality != 3 || o[0].BlockTimestamp != 3 {
+		t.Errorf("Got index %d, cardinality %d, timestamp %d; want 0, 3, 3", index, cardinality, o[0].BlockTimestamp)
+	}
+}
+
+func TestObserveInterpolates(t *testing.T) {
+	fmt.Println("Observe: Interpolates between observations and transforms the newest observation")
+	var o Observations
+	o.Initialize(5)
+	o.Grow(1, 2)
+	index, cardinality := o.Write(0, 9, 2, big.NewInt(5), 1, 2)
+	tickCumulatives, secondsPerLiquidityCumulativeX128s, err := o.Observe(11, []uint32{6, 4, 2, 0}, 3, index, big.NewInt(4), cardinality)
+	if err != nil {
+		t.Fatalf("Observe failed: %v", err)
+	}
+	expectedTicks := []int64{0, 4, 8, 14}
+	expectedSecondsPerLiquidity := []*big.Int{
+		big.NewInt(0),
+		new(big.Int).Div(new(big.Int).Mul(secondsPerLiquidity(4, 5), big.NewInt(2)), big.NewInt(4)),
+		secondsPerLiquidity(4, 5),
+		new(big.Int).Add(secondsPerLiquidity(4, 5), secondsPerLiquidity(2, 4)),
+	}
+	for i := range expectedTicks {
+		if tickCumulatives[i] != expectedTicks[i] || secondsPerLiquidityCumulativeX128s[i].Cmp(expectedSecondsPerLiquidity[i]) != 0 {
+			t.Errorf("Observation %d: Got %d, %v; want %d, %v", i, tickCumulatives[i], secondsPerLiquidityCumulativeX128s[i], expectedTicks[i], expectedSecondsPerLiquidity[i])
+		}
+	}
+}
+
+func TestObserveTooOld(t *testing.T) {
+	fmt.Println("Observe: Returns ErrObservationTooOld if the target is older than the oldest observation")
+	var o Observations
+	o.Initialize(5)
+	if _, _, err := o.Observe(9, []uint32{5}, 0, 0, big.NewInt(1), 1); !errors.Is(err, ErrObservationTooOld) {
+		t.Errorf("Expected ErrObservationTooOld, got %v", err)
+	}
+	// The oldest observation itself can be observed.
+	if tickCumulatives, _, err := o.Observe(9, []uint32{4, 0}, 2, 0, big.NewInt(1), 1); err != nil || tickCumulatives[0] != 0 || tickCumulatives[1] != 8 {
+		t.Errorf("Got %v, %v; want [0 8]", tickCumulatives, err)
+	}
+	if _, _, err := o.Observe(9, []uint32{0}, 0, 0, big.NewInt(1), 0); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("Expected ErrNotInitialized, got %v", err)
+	}
+}
+
+func TestObserveOverflow(t *testing.T) {
+	fmt.Println("Observe: Handles timestamps that overflow 32 bits")
+	var o Observations
+	o.Initialize(1<<32 - 2)
+	o.Grow(1, 2)
+	index, cardinality := o.Write(0, 2, 1, big.NewInt(1), 1, 2)
+	tickCumulatives, _, err := o.Observe(3, []uint32{3, 0}, 1, index, big.NewInt(1), cardinality)
+	if err != nil || tickCumulatives[0] != 2 || tickCumulatives[1] != 5 {
+		t.Errorf("Got %v, %v; want [2 5]", tickCumulatives, err)
+	}
+}
@@ -0,0 +1,224 @@
+package pool
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/oracle"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/position"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/tick"
+)
+
+// Tolerance for differences between numeric pool state fields. A difference
+// is only reported if it exceeds both the absolute and the relative
+// tolerance, so the zero Tolerance reports every difference.
+type Tolerance struct {
+	Absolute *big.Int
+	Relative float64
+}
+
+// Tolerances used when comparing pool states. Fields maps field name prefixes
+// (e.g. "balance0", "slot0." or "ticks.") to the tolerance for the fields
+// with that prefix. If more than one prefix matches a field the longest is
+// used, and if none match Default is used.
+type Tolerances struct {
+	Default Tolerance
+	Fields  map[string]Tolerance
+}
+
+// Difference records a field whose value differs between two pool states.
+type Difference struct {
+	// The name of the field, e.g. "slot0.sqrtPriceX96",
+	// "ticks.257760.liquidityNet" or "positions.<key>.tokensOwed0".
+	Field string `json:"field"`
+	// The values of the field in the first and second pool state.
+	A string `json:"a"`
+	B string `json:"b"`
+	// |b - a| / |a|, or |b - a| if a is zero (0 for non-numeric fields).
+	RelativeError float64 `json:"relativeError"`
+}
+
+// Returns the tolerance for the given field.
+func (t *Tolerances) forField(field string) Tolerance {
+	tolerance := t.Default
+	longest := -1
+	for prefix, fieldTolerance := range t.Fields {
+		if strings.HasPrefix(field, prefix) && len(prefix) > longest {
+			tolerance = fieldTolerance
+			longest = len(prefix)
+		}
+	}
+	return tolerance
+}
+
+// Used to accumulate the differences between two pool states.
+type differ struct {
+	tolerances  *Tolerances
+	differences []Difference
+}
+
+// Compares two numeric fields (nil is treated as zero).
+func (d *differ) compareInt(field string, a, b *big.Int) {
+	if a == nil {
+		a = big.NewInt(0)
+	}
+	if b == nil {
+		b = big.NewInt(0)
+	}
+	if a.Cmp(b) == 0 {
+		return
+	}
+	difference := new(big.Int).Abs(new(big.Int).Sub(b, a))
+	relativeError, _ := new(big.Float).SetInt(difference).Float64()
+	if a.Cmp(big.NewInt(0)) != 0 {
+		relativeError, _ = new(big.Float).Quo(new(big.Float).SetInt(difference), new(big.Float).SetInt(new(big.Int).Abs(a))).Float64()
+	}
+	tolerance := d.tolerances.forField(field)
+	if tolerance.Absolute != nil && difference.Cmp(tolerance.Absolute) <= 0 {
+		return
+	}
+	if relativeError <= tolerance.Relative {
+		return
+	}
+	d.differences = append(d.differences, Difference{
+		Field:         field,
+		A:             a.String(),
+		B:             b.String(),
+		RelativeError: relativeError,
+	})
+}
+
+// Compares two non-numeric fields.
+func (d *differ) compareValue(field string, a, b interface{}) {
+	if a == b {
+		return
+	}
+	d.differences = append(d.differences, Difference{
+		Field: field,
+		A:     fmt.Sprint(a),
+		B:     fmt.Sprint(b),
+	})
+}
+
+// Compares two ticks.
+func (d *differ) compareTick(prefix string, a, b *tick.Tick) {
+	d.compareInt(prefix+"liquidityGross", a.LiquidityGross, b.LiquidityGross)
+	d.compareInt(prefix+"liquidityNet", a.LiquidityNet, b.LiquidityNet)
+	d.compareInt(prefix+"feeGrowthOutside0X128", a.FeeGrowthOutside0X128, b.FeeGrowthOutside0X128)
+	d.compareInt(prefix+"feeGrowthOutside1X128", a.FeeGrowthOutside1X128, b.FeeGrowthOutside1X128)
+	d.compareInt(prefix+"tickCumulativeOutside", big.NewInt(a.TickCumulativeOutside), big.NewInt(b.TickCumulativeOutside))
+	d.compareInt(prefix+"secondsPerLiquidityOutsideX128", a.SecondsPerLiquidityOutsideX128, b.SecondsPerLiquidityOutsideX128)
+	d.compareInt(prefix+"secondsOutside", big.NewInt(int64(a.SecondsOutside)), big.NewInt(int64(b.SecondsOutside)))
+	d.compareValue(prefix+"initialized", a.Initialized, b.Initialized)
+}
+
+// Compares two positions.
+func (d *differ) comparePosition(prefix string, a, b *position.Position) {
+	d.compareInt(prefix+"liquidity", a.Liquidity, b.Liquidity)
+	d.compareInt(prefix+"feeGrowthInside0LastX128", a.FeeGrowthInside0LastX128, b.FeeGrowthInside0LastX128)
+	d.compareInt(prefix+"feeGrowthInside1LastX128", a.FeeGrowthInside1LastX128, b.FeeGrowthInside1LastX128)
+	d.compareInt(prefix+"tokensOwed0", a.TokensOwed0, b.TokensOwed0)
+	d.compareInt(prefix+"tokensOwed1", a.TokensOwed1, b.TokensOwed1)
+}
+
+// Compares two oracle observations.
+func (d *differ) compareObservation(prefix string, a, b oracle.Observation) {
+	d.compareInt(prefix+"blockTimestamp", big.NewInt(int64(a.BlockTimestamp)), big.NewInt(int64(b.BlockTimestamp)))
+	d.compareInt(prefix+"tickCumulative", big.NewInt(a.TickCumulative), big.NewInt(b.TickCumulative))
+	d.compareInt(prefix+"secondsPerLiquidityCumulativeX128", a.SecondsPerLiquidityCumulativeX128, b.SecondsPerLiquidityCumulativeX128)
+	d.compareValue(prefix+"initialized", a.Initialized, b.Initialized)
+}
+
+// Compares two pool states field by field and returns the differences that
+// exceed the given tolerances, sorted by field name. Ticks, positions and
+// observations that are only present in one of the pool states are compared
+// with an uninitialized tick, an empty position or an uninitialized
+// observation.
+//
+// Arguments:
+// a           -- The first pool state
+// b           -- The second pool state
+// tolerances  -- The tolerances for differences between numeric fields
+//
+// Returns:
+// differences -- The fields that differ between the pool states
+func Diff(a, b *Pool, tolerances *Tolerances) []Difference {
+	d := &differ{tolerances: tolerances}
+
+	d.compareValue("token0", a.Token0, b.Token0)
+	d.compareValue("token1", a.Token1, b.Token1)
+	d.compareValue("fee", a.Fee, b.Fee)
+	d.compareValue("tickSpacing", a.TickSpacing, b.TickSpacing)
+	d.compareInt("maxLiquidityPerTick", a.MaxLiquidityPerTick, b.MaxLiquidityPerTick)
+	d.compareInt("slot0.sqrtPriceX96", a.Slot0.SqrtPriceX96, b.Slot0.SqrtPriceX96)
+	d.compareInt("slot0.tick", big.NewInt(int64(a.Slot0.Tick)), big.NewInt(int64(b.Slot0.Tick)))
+	d.compareValue("slot0.observationIndex", a.Slot0.ObservationIndex, b.Slot0.ObservationIndex)
+	d.compareValue("slot0.observationCardinality", a.Slot0.ObservationCardinality, b.Slot0.ObservationCardinality)
+	d.compareValue("slot0.observationCardinalityNext", a.Slot0.ObservationCardinalityNext, b.Slot0.ObservationCardinalityNext)
+	d.compareValue("slot0.feeProtocol", a.Slot0.FeeProtocol, b.Slot0.FeeProtocol)
+	d.compareInt("feeGrowthGlobal0X128", a.FeeGrowthGlobal0X128, b.FeeGrowthGlobal0X128)
+	d.compareInt("feeGrowthGlobal1X128", a.FeeGrowthGlobal1X128, b.FeeGrowthGlobal1X128)
+	d.compareInt("protocolFees.token0", a.ProtocolFees.Token0, b.ProtocolFees.Token0)
+	d.compareInt("protocolFees.token1", a.ProtocolFees.Token1, b.ProtocolFees.Token1)
+	d.compareInt("liquidity", a.Liquidity, b.Liquidity)
+	d.compareInt("balance0", a.Balance0, b.Balance0)
+	d.compareInt("balance1", a.Balance1, b.Balance1)
+
+	emptyTick := &tick.Tick{}
+	tickIdxs := make(map[int]bool)
+	for tickIdx := range a.Ticks.TickData {
+		tickIdxs[tickIdx] = true
+	}
+	for tickIdx := range b.Ticks.TickData {
+		tickIdxs[tickIdx] = true
+	}
+	for tickIdx := range tickIdxs {
+		tickA, found := a.Ticks.TickData[tickIdx]
+		if !found {
+			tickA = emptyTick
+		}
+		tickB, found := b.Ticks.TickData[tickIdx]
+		if !found {
+			tickB = emptyTick
+		}
+		d.compareTick(fmt.Sprintf("ticks.%d.", tickIdx), tickA, tickB)
+	}
+
+	emptyPosition := &position.Position{}
+	positionKeys := make(map[string]bool)
+	for positionKey := range a.Positions {
+		positionKeys[positionKey] = true
+	}
+	for positionKey := range b.Positions {
+		positionKeys[positionKey] = true
+	}
+	for positionKey := range positionKeys {
+		positionA, found := a.Positions[positionKey]
+		if !found {
+			positionA = emptyPosition
+		}
+		positionB, found := b.Positions[positionKey]
+		if !found {
+			positionB = emptyPosition
+		}
+		d.comparePosition(fmt.Sprintf("positions.%s.", positionKey), positionA, positionB)
+	}
+
+	for i := 0; i < len(a.Observations) || i < len(b.Observations); i++ {
+		var observationA, observationB oracle.Observation
+		if i < len(a.Observations) {
+			observationA = a.Observations[i]
+		}
+		if i < len(b.Observations) {
+			observationB = b.Observations[i]
+		}
+		d.compareObservation(fmt.Sprintf("observations.%d.", i), observationA, observationB)
+	}
+
+	sort.Slice(d.differences, func(i, j int) bool {
+		return d.differences[i].Field < d.differences[j].Field
+	})
+	return d.differences
+}
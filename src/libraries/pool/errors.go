@@ -0,0 +1,47 @@
+package pool
+
+import "errors"
+
+// Errors returned by pool operations. Errors are wrapped with the details of
+// the failed operation, so they should be checked with errors.Is. An
+// operation that returns an error leaves the pool unchanged (as the deployed
+// contract would revert).
+var (
+	// The pool has not been initialized (LOK in the deployed contract).
+	ErrNotInitialized = errors.New("pool is not initialized")
+	// The pool is locked, i.e. it was called from a flash callback (LOK).
+	ErrLocked = errors.New("pool is locked")
+	// The initial price is outside of the range of valid prices, i.e. not at
+	// least MIN_SQRT_RATIO and less than MAX_SQRT_RATIO (R in
+	// TickMath.getTickAtSqrtRatio).
+	ErrInvalidSqrtPrice = errors.New("sqrt price is out of range")
+	// The pool has already been initialized (AI).
+	ErrAlreadyInitialized = errors.New("pool is already initialized")
+	// tickLower is not less than tickUpper (TLU).
+	ErrTickOrder = errors.New("tickLower must be less than tickUpper")
+	// tickLower is less than the minimum tick (TLM).
+	ErrTickLowerTooLow = errors.New("tickLower is less than the minimum tick")
+	// tickUpper is greater than the maximum tick (TUM).
+	ErrTickUpperTooHigh = errors.New("tickUpper is greater than the maximum tick")
+	// A tick of a position is not a multiple of the pool's tick spacing
+	// (reverts in TickBitmap.flipTick in the deployed contract).
+	ErrTickSpacing = errors.New("tick is not a multiple of the tick spacing")
+	// A tick that must be initialized is not.
+	ErrTickNotInitialized = errors.New("tick is not initialized")
+	// A position key's owner is not an address, or a legacy position key
+	// cannot be parsed.
+	ErrInvalidPositionKey = errors.New("invalid position key")
+	// The position being burned or collected from does not exist.
+	ErrPositionNotFound = errors.New("position does not exist")
+	// The amount of liquidity to mint or the amount to swap is zero (AS).
+	ErrZeroAmount = errors.New("amount must not be zero")
+	// The price limit of a swap is on the wrong side of the current price, or
+	// outside of the range of valid prices (SPL).
+	ErrInvalidPriceLimit = errors.New("invalid price limit")
+	// A protocol fee is neither 0 nor between 4 and 10.
+	ErrInvalidFeeProtocol = errors.New("protocol fee must be 0 or between 4 and 10")
+	// The pool has no liquidity in range to lend from (L).
+	ErrNoLiquidity = errors.New("pool has no liquidity in range")
+	// A flash loan was not repaid with the fee (F0 and F1).
+	ErrFlashNotRepaid = errors.New("flash loan not repaid with fee")
+)
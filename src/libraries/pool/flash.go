@@ -0,0 +1,110 @@
+package pool
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/constants"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/fullMath"
+)
+
+// FlashCallback simulates the borrower's uniswapV3FlashCallback. It is called
+// by Flash after the borrowed amounts have been sent, and returns the amounts
+// the borrower pays back to the pool. The pool is locked while the callback
+// runs, so it can read the pool but any call that changes the pool returns
+// ErrLocked (as in the deployed contract).
+//
+// Arguments:
+// p       -- The pool the amounts were borrowed from
+// fee0    -- The fee in token0 owed to the pool
+// fee1    -- The fee in token1 owed to the pool
+//
+// Returns:
+// repaid0 -- The amount of token0 paid back to the pool
+// repaid1 -- The amount of token1 paid back to the pool
+// err     -- An error if the borrower cannot repay (Flash returns it)
+type FlashCallback func(p *Pool, fee0, fee1 *big.Int) (repaid0, repaid1 *big.Int, err error)
+
+// Receive token0 and/or token1 and pay it back, plus a fee, in the callback.
+// The fees (less the protocol's share) are credited to in range liquidity
+// providers via the fee growth, as in the deployed contract.
+//
+// Arguments:
+// recipient -- The address which will receive the token0 and token1 amounts
+// amount0   -- The amount of token0 to send
+// amount1   -- The amount of token1 to send
+// callback  -- The borrower's callback, which repays the amounts plus fees
+//
+// Returns:
+// paid0     -- The amount of token0 paid to the pool in excess of the amount
+//              borrowed, i.e. at least the fee
+// paid1     -- The amount of token1 paid to the pool in excess of the amount
+//              borrowed, i.e. at least the fee
+// err       -- ErrFlashNotRepaid if the callback does not repay the amounts
+//              plus fees, the callback's error, or an error if the pool
+//              cannot lend
+func (p *Pool) Flash(recipient string, amount0, amount1 *big.Int, callback FlashCallback) (paid0, paid1 *big.Int, err error) {
+	if err = p.checkLock(); err != nil {
+		return nil, nil, fmt.Errorf("pool.Flash: %w", err)
+	}
+	if amount0.Cmp(big.NewInt(0)) <= -1 || amount1.Cmp(big.NewInt(0)) <= -1 {
+		return nil, nil, fmt.Errorf("pool.Flash: amounts must not be negative (got %v and %v)", amount0, amount1)
+	}
+	if p.Liquidity.Cmp(big.NewInt(0)) <= 0 {
+		return nil, nil, fmt.Errorf("pool.Flash: %w", ErrNoLiquidity)
+	}
+
+	fee0 := fullMath.MulDivRoundingUp(amount0, big.NewInt(int64(p.Fee)), big.NewInt(1e6))
+	fee1 := fullMath.MulDivRoundingUp(amount1, big.NewInt(int64(p.Fee)), big.NewInt(1e6))
+	balance0Before := p.Balance0
+	balance1Before := p.Balance1
+
+	// Send the borrowed amounts and lock the pool while the callback runs.
+	p.Balance0 = new(big.Int).Sub(balance0Before, amount0)
+	p.Balance1 = new(big.Int).Sub(balance1Before, amount1)
+	p.locked = true
+	repaid0, repaid1, err := callback(p, new(big.Int).Set(fee0), new(big.Int).Set(fee1))
+	p.locked = false
+	p.Balance0 = balance0Before
+	p.Balance1 = balance1Before
+	if err != nil {
+		return nil, nil, fmt.Errorf("pool.Flash: %w", err)
+	}
+
+	paid0 = new(big.Int).Sub(repaid0, amount0)
+	paid1 = new(big.Int).Sub(repaid1, amount1)
+	if paid0.Cmp(fee0) <= -1 {
+		return nil, nil, fmt.Errorf("pool.Flash: %w (F0: paid %v, fee %v)", ErrFlashNotRepaid, paid0, fee0)
+	}
+	if paid1.Cmp(fee1) <= -1 {
+		return nil, nil, fmt.Errorf("pool.Flash: %w (F1: paid %v, fee %v)", ErrFlashNotRepaid, paid1, fee1)
+	}
+
+	// Sub is safe because we know balanceAfter is gt balanceBefore by at least
+	// fee.
+	if paid0.Cmp(big.NewInt(0)) >= 1 {
+		feeProtocol0 := p.Slot0.FeeProtocol % 16
+		fees0 := big.NewInt(0)
+		if feeProtocol0 != 0 {
+			fees0 = new(big.Int).Div(paid0, big.NewInt(int64(feeProtocol0)))
+		}
+		if fees0.Cmp(big.NewInt(0)) >= 1 {
+			p.ProtocolFees.Token0 = new(big.Int).Add(p.ProtocolFees.Token0, fees0)
+		}
+		p.FeeGrowthGlobal0X128 = new(big.Int).Add(p.FeeGrowthGlobal0X128, fullMath.MulDiv(new(big.Int).Sub(paid0, fees0), constants.Q128, p.Liquidity))
+	}
+	if paid1.Cmp(big.NewInt(0)) >= 1 {
+		feeProtocol1 := p.Slot0.FeeProtocol >> 4
+		fees1 := big.NewInt(0)
+		if feeProtocol1 != 0 {
+			fees1 = new(big.Int).Div(paid1, big.NewInt(int64(feeProtocol1)))
+		}
+		if fees1.Cmp(big.NewInt(0)) >= 1 {
+			p.ProtocolFees.Token1 = new(big.Int).Add(p.ProtocolFees.Token1, fees1)
+		}
+		p.FeeGrowthGlobal1X128 = new(big.Int).Add(p.FeeGrowthGlobal1X128, fullMath.MulDiv(new(big.Int).Sub(paid1, fees1), constants.Q128, p.Liquidity))
+	}
+	p.Balance0 = new(big.Int).Add(p.Balance0, paid0)
+	p.Balance1 = new(big.Int).Add(p.Balance1, paid1)
+	return paid0, paid1, nil
+}
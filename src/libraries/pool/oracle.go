@@ -0,0 +1,235 @@
+package pool
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/constants"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/oracle"
+)
+
+// Returns the block timestamp truncated to 32 bits, as in the deployed
+// contract.
+func (p *Pool) blockTimestamp() uint32 {
+	return uint32(p.BlockTimestamp)
+}
+
+// Sets the timestamp of the block in which the pool is currently being
+// modified. Observations are written with this timestamp.
+//
+// A pool state provided as input that includes the oracle observations (e.g.
+// data/testV21/pool.txt) is used as is. A state with no observations (e.g. if
+// it was read from the contract's slot0 only, with just the observation index
+// and cardinality) is seeded the first time the block timestamp is set: a
+// single observation (with zero accumulators) is written at the current
+// observation index, one second before the given timestamp, i.e. the pool
+// state is taken to have been unchanged for at least a second. Accumulator
+// values are only meaningful relative to each other, and observations older
+// than the seed are not available. The tick cumulative and seconds per
+// liquidity outside each tick are relative to the deployed contract's
+// accumulators, so they are rebased as though every tick was initialized when
+// the oracle was seeded (seconds outside are relative to the block timestamp,
+// so they are kept).
+//
+// Arguments:
+// blockTimestamp -- The block timestamp
+func (p *Pool) SetBlockTimestamp(blockTimestamp int) {
+	p.BlockTimestamp = blockTimestamp
+	p.seedOracle()
+}
+
+// Seeds the oracle with a single observation one second before the current
+// block timestamp, unless the pool already has observations (see
+// SetBlockTimestamp). Pools that have not been initialized are not seeded,
+// as the oracle is initialized along with the pool.
+func (p *Pool) seedOracle() {
+	if len(p.Observations) > 0 || p.Slot0.SqrtPriceX96.Cmp(big.NewInt(0)) == 0 {
+		return
+	}
+	blockTimestamp := p.blockTimestamp() - 1
+	for tickIdx := range p.Ticks.TickData {
+		p.touchTick(tickIdx)
+		tickInfo := p.Ticks.TickData[tickIdx]
+		tickInfo.TickCumulativeOutside = 0
+		tickInfo.SecondsPerLiquidityOutsideX128 = big.NewInt(0)
+	}
+	if p.Slot0.ObservationCardinality <= 0 {
+		p.Slot0.ObservationIndex = 0
+		p.Slot0.ObservationCardinality, p.Slot0.ObservationCardinalityNext = p.Observations.Initialize(blockTimestamp)
+		return
+	}
+	// The other slots up to the cardinality next are uninitialized (as after
+	// Grow). The index is kept in range even if the loaded state is not.
+	length := p.Slot0.ObservationCardinalityNext
+	if length < p.Slot0.ObservationCardinality {
+		length = p.Slot0.ObservationCardinality
+	}
+	if length <= p.Slot0.ObservationIndex {
+		length = p.Slot0.ObservationIndex + 1
+	}
+	p.Observations = make(oracle.Observations, length)
+	for i := range p.Observations {
+		p.Observations[i].SecondsPerLiquidityCumulativeX128 = big.NewInt(0)
+	}
+	p.Observations[p.Slot0.ObservationIndex] = oracle.Observation{
+		BlockTimestamp:                    blockTimestamp,
+		TickCumulative:                    0,
+		SecondsPerLiquidityCumulativeX128: big.NewInt(0),
+		Initialized:                       true,
+	}
+}
+
+// Returns the tick cumulative and seconds per liquidity cumulative as of the
+// current block timestamp.
+func (p *Pool) observeCurrent() (tickCumulative int64, secondsPerLiquidityCumulativeX128 *big.Int) {
+	p.seedOracle()
+	// Observing the current block timestamp (secondsAgo 0) never returns an
+	// error.
+	tickCumulative, secondsPerLiquidityCumulativeX128, _ = p.Observations.ObserveSingle(
+		p.blockTimestamp(),
+		0,
+		p.Slot0.Tick,
+		p.Slot0.ObservationIndex,
+		p.Liquidity,
+		p.Slot0.ObservationCardinality,
+	)
+	return tickCumulative, secondsPerLiquidityCumulativeX128
+}
+
+// Writes an oracle observation with the given tick and liquidity (the values
+// before they are changed) at the current block timestamp, and updates the
+// observation index and cardinality.
+func (p *Pool) writeObservation(tick int, liquidity *big.Int) {
+	p.seedOracle()
+	// The observation written is after the current one, wrapping around at
+	// either the cardinality or the cardinality next (see oracle.Write).
+	p.touchObservation((p.Slot0.ObservationIndex + 1) % p.Slot0.ObservationCardinality)
+	p.touchObservation((p.Slot0.ObservationIndex + 1) % p.Slot0.ObservationCardinalityNext)
+	p.Slot0.ObservationIndex, p.Slot0.ObservationCardinality = p.Observations.Write(
+		p.Slot0.ObservationIndex,
+		p.blockTimestamp(),
+		tick,
+		liquidity,
+		p.Slot0.ObservationCardinality,
+		p.Slot0.ObservationCardinalityNext,
+	)
+}
+
+// Returns the cumulative tick and liquidity as of each timestamp secondsAgo
+// from the current block timestamp. To get a time weighted average tick or
+// liquidity-in-range, you must call this with two values, one representing
+// the beginning of the period and another for the end of the period. E.g.,
+// to get the last hour time-weighted average tick, you must call it with
+// secondsAgos = [3600, 0]. Returns an error if any of the secondsAgos is
+// older than the oldest observation (as the deployed contract would revert
+// with OLD).
+//
+// Arguments:
+// secondsAgos                        -- From how long ago each cumulative tick
+//                                       and liquidity value should be returned
+//
+// Returns:
+// tickCumulatives                    -- Cumulative tick values as of each
+//                                       secondsAgos from the current block
+//                                       timestamp
+// secondsPerLiquidityCumulativeX128s -- Cumulative seconds per liquidity-in-
+//                                       range value as of each secondsAgos
+//                                       from the current block timestamp
+// err                                -- oracle.ErrObservationTooOld if any of
+//                                       the secondsAgos is older than the
+//                                       oldest observation
+func (p *Pool) Observe(secondsAgos []uint32) (tickCumulatives []int64, secondsPerLiquidityCumulativeX128s []*big.Int, err error) {
+	p.seedOracle()
+	tickCumulatives, secondsPerLiquidityCumulativeX128s, err = p.Observations.Observe(
+		p.blockTimestamp(),
+		secondsAgos,
+		p.Slot0.Tick,
+		p.Slot0.ObservationIndex,
+		p.Liquidity,
+		p.Slot0.ObservationCardinality,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pool.Observe: %w", err)
+	}
+	return tickCumulatives, secondsPerLiquidityCumulativeX128s, nil
+}
+
+// Increases the maximum number of price and liquidity observations that the
+// pool will store. This method is a no-op if the pool already has an
+// observationCardinalityNext greater than or equal to the input
+// observationCardinalityNext.
+//
+// Arguments:
+// observationCardinalityNext -- The desired minimum number of observations
+//                               for the pool to store
+//
+// Returns:
+// err                        -- An error if the pool is not initialized or
+//                               locked, or oracle.ErrCardinalityTooHigh
+func (p *Pool) IncreaseObservationCardinalityNext(observationCardinalityNext int) error {
+	if err := p.checkLock(); err != nil {
+		return fmt.Errorf("pool.IncreaseObservationCardinalityNext: %w", err)
+	}
+	if observationCardinalityNext > oracle.MaxCardinality {
+		return fmt.Errorf("pool.IncreaseObservationCardinalityNext: %w (cardinality %d, maximum %d)", oracle.ErrCardinalityTooHigh, observationCardinalityNext, oracle.MaxCardinality)
+	}
+	p.seedOracle()
+	next, err := p.Observations.Grow(p.Slot0.ObservationCardinalityNext, observationCardinalityNext)
+	if err != nil {
+		return fmt.Errorf("pool.IncreaseObservationCardinalityNext: %w", err)
+	}
+	p.Slot0.ObservationCardinalityNext = next
+	return nil
+}
+
+// Returns a snapshot of the tick cumulative, seconds per liquidity and
+// seconds inside a tick range. Snapshots must only be compared to other
+// snapshots, taken over a period for which a position existed. I.e.,
+// snapshots cannot be compared if a position is not held for the entire
+// period between when the first snapshot is taken and the second snapshot is
+// taken.
+//
+// Arguments:
+// tickLower                     -- The lower tick of the range
+// tickUpper                     -- The upper tick of the range
+//
+// Returns:
+// tickCumulativeInside          -- The snapshot of the tick accumulator for
+//                                  the range
+// secondsPerLiquidityInsideX128 -- The snapshot of seconds per liquidity for
+//                                  the range
+// secondsInside                 -- The snapshot of seconds spent inside the
+//                                  range
+// err                           -- An error if the ticks are invalid or not
+//                                  initialized
+func (p *Pool) SnapshotCumulativesInside(tickLower, tickUpper int) (tickCumulativeInside int64, secondsPerLiquidityInsideX128 *big.Int, secondsInside uint32, err error) {
+	if err = checkTicks(tickLower, tickUpper); err != nil {
+		return 0, nil, 0, err
+	}
+
+	lower := p.Ticks.Lookup(tickLower)
+	upper := p.Ticks.Lookup(tickUpper)
+	if !lower.Initialized || !upper.Initialized {
+		return 0, nil, 0, fmt.Errorf("pool.SnapshotCumulativesInside: %w (ticks %d and %d)", ErrTickNotInitialized, tickLower, tickUpper)
+	}
+
+	if p.Slot0.Tick < tickLower {
+		tickCumulativeInside = lower.TickCumulativeOutside - upper.TickCumulativeOutside
+		secondsPerLiquidityInsideX128 = new(big.Int).Sub(lower.SecondsPerLiquidityOutsideX128, upper.SecondsPerLiquidityOutsideX128)
+		secondsInside = lower.SecondsOutside - upper.SecondsOutside
+	} else if p.Slot0.Tick < tickUpper {
+		time := p.blockTimestamp()
+		tickCumulative, secondsPerLiquidityCumulativeX128 := p.observeCurrent()
+		tickCumulativeInside = tickCumulative - lower.TickCumulativeOutside - upper.TickCumulativeOutside
+		secondsPerLiquidityInsideX128 = new(big.Int).Sub(secondsPerLiquidityCumulativeX128, lower.SecondsPerLiquidityOutsideX128)
+		secondsPerLiquidityInsideX128.Sub(secondsPerLiquidityInsideX128, upper.SecondsPerLiquidityOutsideX128)
+		secondsInside = time - lower.SecondsOutside - upper.SecondsOutside
+	} else {
+		tickCumulativeInside = upper.TickCumulativeOutside - lower.TickCumulativeOutside
+		secondsPerLiquidityInsideX128 = new(big.Int).Sub(upper.SecondsPerLiquidityOutsideX128, lower.SecondsPerLiquidityOutsideX128)
+		secondsInside = upper.SecondsOutside - lower.SecondsOutside
+	}
+	// Simulate solidity (uint160) underflow
+	secondsPerLiquidityInsideX128.And(secondsPerLiquidityInsideX128, constants.MaxUint160)
+	return
+}
@@ -7,19 +7,33 @@ import (
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/constants"
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/fullMath"
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/liquidityMath"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/logging"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/oracle"
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/position"
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/sqrtPriceMath"
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/swapMath"
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/tick"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/tickBitmap"
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/tickMath"
 )
 
+// Logs pool operations (subsystem "pool", see the logging package).
+var logger = logging.Get("pool")
+
 // Part of pool state.
 type Slot0 struct {
 	// The current price.
 	SqrtPriceX96 *big.Int
 	// The current tick.
 	Tick int
+	// The most-recently updated index of the observations array.
+	ObservationIndex int
+	// The current maximum number of observations that are being stored.
+	ObservationCardinality int
+	// The next maximum number of observations to store, triggered in
+	// observations.Write. Not included in the pool states provided as input,
+	// in which case it is taken to be ObservationCardinality.
+	ObservationCardinalityNext int
 	// The current protocol fee as a percentage of the swap fee taken on
 	// withdrawal. Represented as an integer denominator (1/x)%
 	FeeProtocol int
@@ -53,18 +67,38 @@ type Pool struct {
 	// a mapping from tick index to a Tick struct that contains information
 	// about that tick (see the tick package for more).
 	Ticks *tick.Ticks
-	// Position-indexed state, as per section 6.4 in Uniswap V3 Whitepaper. In
-	// the deployed contract, this is a mapping from the hash of a position's
-	// owner's address, tickLower, and tickUpper (in byte form) to a Position.
-	// In this simulator it is implemented it as a mapping from a string, which
-	// is the concatenation of the owner's address, tickUpper and tickLower
-	// concatenate, to a Position (see the position package for more).
+	// Packed mapping of which ticks are initialized, used to find the next
+	// initialized tick during a swap (see the tickBitmap package for more).
+	// Kept in step with Ticks, i.e. a tick is flipped in the bitmap whenever
+	// it is flipped between initialized and uninitialized in Ticks.
+	TickBitmap *tickBitmap.TickBitmap
+	// Position-indexed state, as per section 6.4 in Uniswap V3 Whitepaper. As
+	// in the deployed contract, this is a mapping from the hash of a
+	// position's owner's address, tickLower, and tickUpper (in byte form) to a
+	// Position (see PositionKey.Hash and the position package for more).
 	Positions map[string]*position.Position
 	// Balance of token0 and token1 held by the pool. Not part of state in the
 	// deployed contract (the deployed contract checks the balance of the token
 	// owned by the pool address).
 	Balance0 *big.Int
 	Balance1 *big.Int
+	// The oracle observations (see the oracle package for more).
+	Observations oracle.Observations
+	// The timestamp of the block in which the pool is currently being
+	// modified (block.timestamp in the deployed contract). Set with
+	// SetBlockTimestamp.
+	BlockTimestamp int
+	// The snapshots of the pool that are recording changes, oldest first (see
+	// Snapshot).
+	snapshots []*Snapshot
+	// True iff the pool is locked, i.e. a flash callback is running (see
+	// Flash).
+	locked bool
+	// The keys of the pool's positions, by hash, so that positions can be
+	// listed by owner (see PositionKeys).
+	positionKeys map[string]PositionKey
+	// Receives a trace of every swap, if set (see SetSwapTracer).
+	swapTracer SwapTracer
 }
 
 // Same as pool state above, but the ticks map is a map of strings to Tick
@@ -91,23 +125,116 @@ type PoolTemp struct {
 	// a mapping from tick index (string) to a Tick struct that contains
 	// information about that tick (see the tick package for more).
 	Ticks *map[string]tick.Tick
-	// Position-indexed state, as per section 6.4 in Uniswap V3 Whitepaper. In
-	// the deployed contract, this is a mapping from the hash of a position's
-	// owner's address, tickLower, and tickUpper (in byte form) to a Position.
-	// In this simulator it is implemented it as a mapping from a string, which
-	// is the concatenation of the owner's address, tickUpper and tickLower
-	// concatenate, to a Position (see the position package for more).
+	// Position-indexed state, as per section 6.4 in Uniswap V3 Whitepaper. A
+	// mapping from the hash of a position's owner's address, tickLower, and
+	// tickUpper (see PositionKey.Hash) to a Position. Pool states keyed by the
+	// legacy keys (see PositionKey.Legacy) can also be loaded.
 	Positions map[string]*position.Position
+	// The keys of the positions, by hash. Saved with the pool state so that
+	// positions can be listed by owner after the state is loaded (see
+	// Pool.PositionKeys).
+	PositionKeys map[string]PositionKey `json:",omitempty"`
 	// Balance of token0 and token1 held by the pool. Not part of state in the
 	// deployed contract (the deployed contract checks the balance of the token
 	// owned by the pool address).
 	Balance0 *big.Int
 	Balance1 *big.Int
+	// The oracle observations. The pool states provided as input do not
+	// include observations, in which case the oracle is seeded when the
+	// pool's block timestamp is first set (see Pool.SetBlockTimestamp).
+	Observations oracle.Observations `json:",omitempty"`
+}
+
+// Make returns a new, uninitialized pool for the given tokens, fee and tick
+// spacing (the pool must be initialized with Initialize before it is used).
+// Does not check that the fee and tick spacing are valid, pools should
+// generally be created with the factory package instead.
+//
+// Arguments:
+// token0      -- The first of the two tokens of the pool, sorted by address
+// token1      -- The second of the two tokens of the pool, sorted by address
+// fee         -- The fee collected upon every swap in the pool, denominated in
+//                hundredths of a bip
+// tickSpacing -- The spacing between usable ticks
+//
+// Returns:
+// The new pool
+func Make(token0, token1 string, fee, tickSpacing int) *Pool {
+	return &Pool{
+		Token0:              token0,
+		Token1:              token1,
+		Fee:                 fee,
+		TickSpacing:         tickSpacing,
+		MaxLiquidityPerTick: tick.TickSpacingToMaxLiquidityPerTick(tickSpacing),
+		Slot0: &Slot0{
+			SqrtPriceX96: big.NewInt(0),
+		},
+		FeeGrowthGlobal0X128: big.NewInt(0),
+		FeeGrowthGlobal1X128: big.NewInt(0),
+		ProtocolFees: &ProtocolFees{
+			Token0: big.NewInt(0),
+			Token1: big.NewInt(0),
+		},
+		Liquidity:    big.NewInt(0),
+		Ticks:        &tick.Ticks{TickData: make(map[int]*tick.Tick)},
+		TickBitmap:   tickBitmap.Make(),
+		Positions:    make(map[string]*position.Position),
+		Balance0:     big.NewInt(0),
+		Balance1:     big.NewInt(0),
+		positionKeys: make(map[string]PositionKey),
+	}
 }
 
-// Converts a PoolTemp struct to a Pool struct.
-func PoolTempToPool(poolTemp *PoolTemp) *Pool {
+// Sets the initial price for the pool and initializes the oracle at the
+// pool's current block timestamp (see SetBlockTimestamp). Price is
+// represented as a sqrt(amountToken1/amountToken0) Q64.96 value.
+//
+// Arguments:
+// sqrtPriceX96 -- The initial sqrt price of the pool as a Q64.96
+//
+// Returns:
+// err          -- ErrAlreadyInitialized if the pool is already initialized,
+//                 or ErrInvalidSqrtPrice if the price is out of range
+func (p *Pool) Initialize(sqrtPriceX96 *big.Int) error {
+	if p.Slot0.SqrtPriceX96.Cmp(big.NewInt(0)) != 0 {
+		return fmt.Errorf("pool.Initialize: %w", ErrAlreadyInitialized)
+	}
+	if sqrtPriceX96.Cmp(constants.MinSqrtRatioBig) < 0 || sqrtPriceX96.Cmp(constants.MaxSqrtRatio) >= 0 {
+		return fmt.Errorf("pool.Initialize: %w (price %v)", ErrInvalidSqrtPrice, sqrtPriceX96)
+	}
+
+	tick := tickMath.GetTickAtSqrtRatio(sqrtPriceX96)
+
+	cardinality, cardinalityNext := p.Observations.Initialize(p.blockTimestamp())
+
+	p.Slot0 = &Slot0{
+		SqrtPriceX96:               new(big.Int).Set(sqrtPriceX96),
+		Tick:                       tick,
+		ObservationIndex:           0,
+		ObservationCardinality:     cardinality,
+		ObservationCardinalityNext: cardinalityNext,
+		FeeProtocol:                0,
+	}
+	return nil
+}
+
+// Converts a PoolTemp struct to a Pool struct. Uninitialized ticks in the
+// PoolTemp struct are dropped and positions with legacy keys are keyed by
+// their hash. Returns ErrInvalidPositionKey if a legacy key cannot be parsed
+// (see ParseLegacyPositionKey).
+func PoolTempToPool(poolTemp *PoolTemp) (*Pool, error) {
+	positions, positionKeys, err := loadPositions(poolTemp.Positions, poolTemp.PositionKeys, poolTemp.TickSpacing)
+	if err != nil {
+		return nil, err
+	}
 	ticks := tick.TicksTempToTicks(poolTemp.Ticks)
+	ticks.Prune()
+	bitmap := tickBitmap.Make()
+	for tickIdx, tickInfo := range ticks.TickData {
+		if tickInfo.Initialized {
+			bitmap.FlipTick(tickIdx, poolTemp.TickSpacing)
+		}
+	}
 	pool := &Pool{
 		Token0:               poolTemp.Token0,
 		Token1:               poolTemp.Token1,
@@ -120,89 +247,85 @@ func PoolTempToPool(poolTemp *PoolTemp) *Pool {
 		ProtocolFees:         poolTemp.ProtocolFees,
 		Liquidity:            poolTemp.Liquidity,
 		Ticks:                ticks,
-		Positions:            poolTemp.Positions,
+		TickBitmap:           bitmap,
+		Positions:            positions,
 		Balance0:             poolTemp.Balance0,
 		Balance1:             poolTemp.Balance1,
+		Observations:         poolTemp.Observations,
+		positionKeys:         positionKeys,
 	}
-	return pool
+	if pool.Slot0.ObservationCardinalityNext < pool.Slot0.ObservationCardinality {
+		pool.Slot0.ObservationCardinalityNext = pool.Slot0.ObservationCardinality
+	}
+	if pool.Slot0.ObservationCardinalityNext > oracle.MaxCardinality {
+		return nil, fmt.Errorf("pool.PoolTempToPool: %w (observationCardinalityNext %d)", oracle.ErrCardinalityTooHigh, pool.Slot0.ObservationCardinalityNext)
+	}
+	if len(pool.Observations) > 0 {
+		if _, err := pool.Observations.Grow(len(pool.Observations), pool.Slot0.ObservationCardinalityNext); err != nil {
+			return nil, fmt.Errorf("pool.PoolTempToPool: %w", err)
+		}
+	}
+	return pool, nil
+}
+
+// Converts a Pool struct to a PoolTemp struct (i.e. the inverse of
+// PoolTempToPool). Used when saving pool state as JSON, so that saved pool
+// states can be loaded in the same way as the pool states provided as input.
+func PoolToPoolTemp(pool *Pool) *PoolTemp {
+	poolTemp := &PoolTemp{
+		Token0:               pool.Token0,
+		Token1:               pool.Token1,
+		Fee:                  pool.Fee,
+		TickSpacing:          pool.TickSpacing,
+		MaxLiquidityPerTick:  pool.MaxLiquidityPerTick,
+		Slot0:                pool.Slot0,
+		FeeGrowthGlobal0X128: pool.FeeGrowthGlobal0X128,
+		FeeGrowthGlobal1X128: pool.FeeGrowthGlobal1X128,
+		ProtocolFees:         pool.ProtocolFees,
+		Liquidity:            pool.Liquidity,
+		Ticks:                tick.TicksToTicksTemp(pool.Ticks),
+		Positions:            pool.Positions,
+		PositionKeys:         make(map[string]PositionKey),
+		Balance0:             pool.Balance0,
+		Balance1:             pool.Balance1,
+		Observations:         pool.Observations,
+	}
+	for hash, key := range pool.positionKeys {
+		if _, found := pool.Positions[hash]; found {
+			poolTemp.PositionKeys[hash] = key
+		}
+	}
+	return poolTemp
+}
+
+// Checks that the pool can be called, as the deployed contract's lock
+// modifier does. Returns ErrNotInitialized if the pool has not been
+// initialized and ErrLocked if the pool is locked (see Flash).
+func (p *Pool) checkLock() error {
+	if p.Slot0.SqrtPriceX96.Cmp(big.NewInt(0)) == 0 {
+		return ErrNotInitialized
+	}
+	if p.locked {
+		return ErrLocked
+	}
+	return nil
 }
 
 // Common checks for valid tick inputs.
-func checkTicks(tickLower int, tickUpper int) {
+func checkTicks(tickLower int, tickUpper int) error {
 	// Check that tickLower < tickUpper.
 	if tickLower >= tickUpper {
-		panic("Pool.checkTicks: tickLower > tickUpper")
+		return fmt.Errorf("pool.checkTicks: %w (tickLower %d, tickUpper %d)", ErrTickOrder, tickLower, tickUpper)
 	}
 	// Check that tickLower is not less than the minimum tick.
 	if tickLower < constants.MinTick {
-		panic("Pool.checkTicks: tickLower < MINTICK")
+		return fmt.Errorf("pool.checkTicks: %w (tickLower %d)", ErrTickLowerTooLow, tickLower)
 	}
 	// Check that tickUpper is not greater than the maximum tick.
 	if tickUpper > constants.MaxTick {
-		panic("Pool.checkTicks: tickUpper > MAXTICK")
+		return fmt.Errorf("pool.checkTicks: %w (tickUpper %d)", ErrTickUpperTooHigh, tickUpper)
 	}
-}
-
-// Finds the next initialized tick contained in the same word (or adjacent
-// word i.e. within 256 ticks) as the tick that is either to the left (less
-// than or equal to) or right (greater than) of the given tick. This function is
-// used because the deployed contract uses a bitMap to efficiently store and
-// check which ticks are initialized. The bitMap is made up of multiple words.
-// This is unnecessary in the simulator, but we use it to avoid making too many
-// changes to the deployed contract.
-//
-// Arguments:
-// tick        -- the starting tick
-// tickSpacing -- the spacing between usable ticks for the pool
-// lte         -- a bool that indicates whether to search for the next
-//                initialized tick to the left (less than or equal to the
-//                starting tick)
-// Returns:
-// next        -- the next initialized or uninitialized tick up to 256 ticks
-//                away from the current tick
-// initialized -- a bool that indicates whether or not next is initialized
-//                (because the function only searches within up to 256 ticks)
-func (p *Pool) nextInitializedTickWithinOneWord(tick, tickSpacing int, lte bool) (next int, initialized bool) {
-	// Adjust for the tickSpacing.
-	compressed := tick / tickSpacing
-	// Find the boundaries of the word that would contain the tick.
-	wordLowerBound := compressed - compressed%256
-	wordUpperBound := wordLowerBound + 255
-	if tick < 0 && tick%tickSpacing != 0 {
-		compressed = compressed - 1
-	}
-	if lte {
-		// Search for the closest initialized tick, within the word, with
-		// tick_idx less than or equal to tick.
-		for i := compressed; i >= wordLowerBound; i-- {
-			tick_idx := i * tickSpacing
-			tick := p.Ticks.Get(tick_idx)
-			if tick.Initialized {
-				return tick_idx, true
-			} else {
-				if i == wordLowerBound {
-					return tick_idx, false
-				}
-				continue
-			}
-		}
-	} else {
-		// Search for the closest initialized tick, within the word, with
-		// tick_idx greater than tick.
-		for i := compressed + 1; i <= wordUpperBound; i++ {
-			tick_idx := i * tickSpacing
-			tick := p.Ticks.Get(tick_idx)
-			if tick.Initialized {
-				return tick_idx, true
-			} else {
-				if i == wordUpperBound {
-					return tick_idx, false
-				}
-				continue
-			}
-		}
-	}
-	panic("Pool.nextInitializedTickWithinOneWord: Unreachable")
+	return nil
 }
 
 // Input parameters for the Pool.modifyPosition function.
@@ -229,10 +352,21 @@ type modifyPositionParams struct {
 //             should pay the recipient)
 // amount1  -- the amount of token1 owed to the pool (negative if the pool
 //             should pay the recipient)
-func (p *Pool) modifyPosition(params *modifyPositionParams) (position *position.Position, amount0 *big.Int, amount1 *big.Int) {
-	checkTicks(params.TickLower, params.TickUpper)
+// err      -- An error if the position could not be modified
+func (p *Pool) modifyPosition(params *modifyPositionParams) (position *position.Position, amount0 *big.Int, amount1 *big.Int, err error) {
+	if err = p.checkLock(); err != nil {
+		return nil, nil, nil, fmt.Errorf("pool.modifyPosition: %w", err)
+	}
+	if err = checkTicks(params.TickLower, params.TickUpper); err != nil {
+		return nil, nil, nil, err
+	}
 	slot0 := p.Slot0
-	position = p.updatePosition(params.Owner, params.TickLower, params.TickUpper, slot0.Tick, params.LiquidityDelta, params.Mint)
+	position, err = p.updatePosition(params.Owner, params.TickLower, params.TickUpper, slot0.Tick, params.LiquidityDelta, params.Mint)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	amount0 = big.NewInt(0)
+	amount1 = big.NewInt(0)
 	if params.LiquidityDelta.Cmp(big.NewInt(0)) != 0 {
 		if slot0.Tick < params.TickLower {
 			// Current tick is below the passed range; liquidity can only become in range by crossing from left to
@@ -247,6 +381,9 @@ func (p *Pool) modifyPosition(params *modifyPositionParams) (position *position.
 			// Current tick is inside the passed range
 			liquidityBefore := p.Liquidity
 
+			// Write an oracle entry.
+			p.writeObservation(slot0.Tick, liquidityBefore)
+
 			amount0 = sqrtPriceMath.GetAmount0DeltaNoBool(
 				slot0.SqrtPriceX96,
 				tickMath.GetSqrtRatioAtTick(params.TickUpper),
@@ -273,7 +410,9 @@ func (p *Pool) modifyPosition(params *modifyPositionParams) (position *position.
 	return
 }
 
-// Gets and updates a position with the given liquidity delta.
+// Gets and updates a position with the given liquidity delta. If the position
+// or either tick cannot be updated the pool is left unchanged and an error is
+// returned.
 //
 // Arguments:
 // owner     -- the owner of the position
@@ -282,20 +421,31 @@ func (p *Pool) modifyPosition(params *modifyPositionParams) (position *position.
 //
 // Returns:
 // position  -- the updated position
-func (p *Pool) updatePosition(owner string, tickLower, tickUpper, tick int, liquidityDelta *big.Int, mint bool) (pos *position.Position) {
-	position_key := fmt.Sprintf("%s%d%d", owner, tickLower, tickUpper)
+// err       -- An error if the position could not be updated
+func (p *Pool) updatePosition(owner string, tickLower, tickUpper, tick int, liquidityDelta *big.Int, mint bool) (pos *position.Position, err error) {
+	// Only ticks that are multiples of the tick spacing can be initialized,
+	// so check before either tick is updated.
+	if tickLower%p.TickSpacing != 0 || tickUpper%p.TickSpacing != 0 {
+		return nil, fmt.Errorf("pool.updatePosition: %w (tickLower %d, tickUpper %d, tickSpacing %d)", ErrTickSpacing, tickLower, tickUpper, p.TickSpacing)
+	}
+	key := PositionKey{Owner: owner, TickLower: tickLower, TickUpper: tickUpper}
+	position_key, err := key.Hash()
+	if err != nil {
+		return nil, err
+	}
 	pos, found := p.Positions[position_key]
 	if !found {
-		if mint {
-			// In the case of a mint, we create a new position if it does not
-			// exist.
-			pos = position.Make()
-			p.Positions[position_key] = pos
-		} else {
-			// Otherwise, we panic if the position does not exist.
-			message := fmt.Sprintf("pool.updatePosition - Position %s does not exist", position_key)
-			panic(message)
+		if !mint {
+			return nil, fmt.Errorf("pool.updatePosition: %w (%+v)", ErrPositionNotFound, key)
 		}
+		// In the case of a mint, we create a new position if it does not
+		// exist (it is only added to the pool if the update succeeds).
+		pos = position.Make()
+	}
+	// Check the position can be updated before updating the ticks, so that
+	// the ticks' liquidity cannot underflow.
+	if err = pos.CheckUpdate(liquidityDelta); err != nil {
+		return nil, err
 	}
 
 	feeGrowthGlobal0X128 := p.FeeGrowthGlobal0X128
@@ -306,26 +456,74 @@ func (p *Pool) updatePosition(owner string, tickLower, tickUpper, tick int, liqu
 	var flippedLower bool
 	var flippedUpper bool
 	if liquidityDelta.Cmp(big.NewInt(0)) != 0 {
-		flippedLower = p.Ticks.Update(
+		time := p.blockTimestamp()
+		tickCumulative, secondsPerLiquidityCumulativeX128 := p.observeCurrent()
+
+		p.touchTick(tickLower)
+		p.touchTick(tickUpper)
+
+		// Ticks are updated in place, so keep a copy of the lower tick in
+		// case the upper tick cannot be updated.
+		lowerBefore, lowerFound := p.Ticks.TickData[tickLower]
+		if lowerFound {
+			lowerCopy := *lowerBefore
+			lowerBefore = &lowerCopy
+		}
+
+		flippedLower, err = p.Ticks.Update(
 			tickLower,
 			tick,
 			liquidityDelta,
 			feeGrowthGlobal0X128,
 			feeGrowthGlobal1X128,
+			secondsPerLiquidityCumulativeX128,
+			tickCumulative,
+			time,
 			p.MaxLiquidityPerTick,
 			false,
 		)
+		if err != nil {
+			return nil, err
+		}
 
-		flippedUpper = p.Ticks.Update(
+		flippedUpper, err = p.Ticks.Update(
 			tickUpper,
 			tick,
 			liquidityDelta,
 			feeGrowthGlobal0X128,
 			feeGrowthGlobal1X128,
+			secondsPerLiquidityCumulativeX128,
+			tickCumulative,
+			time,
 			p.MaxLiquidityPerTick,
 			true,
 		)
+		if err != nil {
+			// Roll back the update to the lower tick.
+			if lowerFound {
+				*p.Ticks.TickData[tickLower] = *lowerBefore
+			} else {
+				p.Ticks.Clear(tickLower)
+			}
+			return nil, err
+		}
+
+		if flippedLower {
+			p.touchTickBitmap(tickLower)
+			p.TickBitmap.FlipTick(tickLower, p.TickSpacing)
+		}
+		if flippedUpper {
+			p.touchTickBitmap(tickUpper)
+			p.TickBitmap.FlipTick(tickUpper, p.TickSpacing)
+		}
+	}
+	p.touchPosition(position_key)
+	if found {
+		pos = p.Positions[position_key]
+	} else {
+		p.Positions[position_key] = pos
 	}
+	p.indexPosition(position_key, key)
 
 	feeGrowthInside0X128, feeGrowthInside1X128 := p.Ticks.GetFeeGrowthInside(
 		tickLower,
@@ -335,7 +533,8 @@ func (p *Pool) updatePosition(owner string, tickLower, tickUpper, tick int, liqu
 		feeGrowthGlobal1X128,
 	)
 
-	// Update position liquidity and fee growth
+	// Update position liquidity and fee growth (the update has already been
+	// checked, so it cannot fail).
 	pos.Update(liquidityDelta, feeGrowthInside0X128, feeGrowthInside1X128)
 
 	// Clear any tick data that is no longer needed
@@ -347,7 +546,7 @@ func (p *Pool) updatePosition(owner string, tickLower, tickUpper, tick int, liqu
 			p.Ticks.Clear(tickUpper)
 		}
 	}
-	return pos
+	return pos, nil
 }
 
 // Mints liquidity for the given recipient in the given tick range (either
@@ -362,28 +561,21 @@ func (p *Pool) updatePosition(owner string, tickLower, tickUpper, tick int, liqu
 // Returns:
 // amount0   -- the amount of token0 to transfer to the recipient
 // amount1   -- the amount of token1 to transfer to the recipient
-func (p *Pool) Mint(recipient string, tickLower, tickUpper int, amount *big.Int) (amount0, amount1 *big.Int) {
+// err       -- An error if the liquidity could not be minted
+func (p *Pool) Mint(recipient string, tickLower, tickUpper int, amount *big.Int) (amount0, amount1 *big.Int, err error) {
 	// Log mint details for debugging.
-	fmt.Println("MINT")
-	fmt.Printf("MINT - recipient: %s", recipient)
-	fmt.Println()
-	fmt.Printf("MINT - tickLower: %d", tickLower)
-	fmt.Println()
-	fmt.Printf("MINT - tickUpper: %d", tickUpper)
-	fmt.Println()
-	fmt.Printf("MINT - amount: %s", amount)
-	fmt.Println()
+	if logger.Enabled(logging.Debug) {
+		logger.Debug("mint", logging.F("recipient", recipient), logging.F("tickLower", tickLower), logging.F("tickUpper", tickUpper), logging.F("amount", amount), logging.F("tick", p.Slot0.Tick))
+	}
 
 	// Quick sanity checks.
-	checkTicks(tickLower, tickUpper)
 	if amount.Cmp(big.NewInt(0)) <= 0 {
-		message := fmt.Sprintf("pool.Mint: Amount %s must be greater than 0", amount)
-		panic(message)
+		return nil, nil, fmt.Errorf("pool.Mint: %w (amount %v)", ErrZeroAmount, amount)
 	}
 
 	// Get the amount of token0 and token1 owed to the pool (negative if the
 	// pool owes the recipient).
-	_, amount0, amount1 = p.modifyPosition(
+	_, amount0, amount1, err = p.modifyPosition(
 		&modifyPositionParams{
 			Owner:          recipient,
 			TickLower:      tickLower,
@@ -391,10 +583,13 @@ func (p *Pool) Mint(recipient string, tickLower, tickUpper int, amount *big.Int)
 			LiquidityDelta: amount,
 			Mint:           true,
 		})
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// Update the pool's balances.
-	p.Balance0 = p.Balance0.Add(p.Balance0, amount0)
-	p.Balance1 = p.Balance1.Add(p.Balance1, amount1)
+	p.Balance0 = new(big.Int).Add(p.Balance0, amount0)
+	p.Balance1 = new(big.Int).Add(p.Balance1, amount1)
 	return
 }
 
@@ -417,29 +612,38 @@ func (p *Pool) Mint(recipient string, tickLower, tickUpper int, amount *big.Int)
 // Returns:
 // amount0          -- the amount of token0 collected
 // amount1          -- the amount of token1 collected
-func (p *Pool) Collect(owner string, tickLower, tickUpper int, amount0Requested, amount1Requested *big.Int) (amount0, amount1 *big.Int) {
+// err              -- ErrPositionNotFound, an error if the pool cannot be
+//                     called (see checkLock) or nil
+func (p *Pool) Collect(owner string, tickLower, tickUpper int, amount0Requested, amount1Requested *big.Int) (amount0, amount1 *big.Int, err error) {
 	// We don't need to checkTicks here, because invalid positions will never
 	// have non-zero tokensOwed.
-	position_key := fmt.Sprintf("%s%d%d", owner, tickLower, tickUpper)
-	position, found := p.Positions[position_key]
-	if !found {
-		message := fmt.Sprintf("pool.Collect: Position %s does not exist", position_key)
-		panic(message)
+	if err = p.checkLock(); err != nil {
+		return nil, nil, fmt.Errorf("pool.Collect: %w", err)
+	}
+	key := PositionKey{Owner: owner, TickLower: tickLower, TickUpper: tickUpper}
+	position_key, err := key.Hash()
+	if err != nil {
+		return nil, nil, err
 	}
+	if _, found := p.Positions[position_key]; !found {
+		return nil, nil, fmt.Errorf("pool.Collect: %w (%+v)", ErrPositionNotFound, key)
+	}
+	p.touchPosition(position_key)
+	position := p.Positions[position_key]
 
 	// If more tokens are requests than are owed to the position then just
 	// collect all the tokens owed.
 	amount0 = new(big.Int)
 	if amount0Requested.Cmp(position.TokensOwed0) >= 1 {
-		amount0 = position.TokensOwed0
+		amount0.Set(position.TokensOwed0)
 	} else {
-		amount0 = amount0Requested
+		amount0.Set(amount0Requested)
 	}
 	amount1 = new(big.Int)
 	if amount1Requested.Cmp(position.TokensOwed1) >= 1 {
-		amount1 = position.TokensOwed1
+		amount1.Set(position.TokensOwed1)
 	} else {
-		amount1 = amount1Requested
+		amount1.Set(amount1Requested)
 	}
 
 	// Update the positions' tokensOwed
@@ -449,6 +653,10 @@ func (p *Pool) Collect(owner string, tickLower, tickUpper int, amount0Requested,
 	if amount1.Cmp(big.NewInt(0)) >= 1 {
 		position.TokensOwed1 = new(big.Int).Sub(position.TokensOwed1, amount1)
 	}
+
+	// Update the pool's balances
+	p.Balance0 = new(big.Int).Sub(p.Balance0, amount0)
+	p.Balance1 = new(big.Int).Sub(p.Balance1, amount1)
 	return
 }
 
@@ -463,18 +671,13 @@ func (p *Pool) Collect(owner string, tickLower, tickUpper int, amount0Requested,
 // Returns:​
 // amount0   -- The amount of token0 to transfer to the recipient
 // amount1   -- The amount of token1 to transfer to the recipient
-func (p *Pool) Burn(owner string, tickLower, tickUpper int, amount *big.Int) (amount0, amount1 *big.Int) {
+// err       -- An error if the liquidity could not be burned
+func (p *Pool) Burn(owner string, tickLower, tickUpper int, amount *big.Int) (amount0, amount1 *big.Int, err error) {
 	// Log burn details for debugging
-	fmt.Println("BURN")
-	fmt.Printf("BURN - owner: %s", owner)
-	fmt.Println()
-	fmt.Printf("BURN - tickLower: %d", tickLower)
-	fmt.Println()
-	fmt.Printf("BURN - tickUpper: %d", tickUpper)
-	fmt.Println()
-	fmt.Printf("BURN - amount: %s", amount)
-	fmt.Println()
-	position, amount0, amount1 := p.modifyPosition(
+	if logger.Enabled(logging.Debug) {
+		logger.Debug("burn", logging.F("owner", owner), logging.F("tickLower", tickLower), logging.F("tickUpper", tickUpper), logging.F("amount", amount), logging.F("tick", p.Slot0.Tick))
+	}
+	position, amount0, amount1, err := p.modifyPosition(
 		&modifyPositionParams{
 			Owner:          owner,
 			TickLower:      tickLower,
@@ -483,12 +686,14 @@ func (p *Pool) Burn(owner string, tickLower, tickUpper int, amount *big.Int) (am
 			Mint:           false,
 		},
 	)
+	if err != nil {
+		return nil, nil, err
+	}
 	amount0 = new(big.Int).Neg(amount0)
 	amount1 = new(big.Int).Neg(amount1)
 
-	// Update the pool's balances
-	p.Balance0 = p.Balance0.Add(p.Balance0, amount0)
-	p.Balance1 = p.Balance1.Add(p.Balance1, amount1)
+	// The pool's balances are unchanged until the tokens owed are collected
+	// (see Collect).
 
 	// Update the tokens owed to the position
 	if amount0.Cmp(big.NewInt(0)) >= 1 || amount1.Cmp(big.NewInt(0)) >= 1 {
@@ -546,6 +751,49 @@ type StepComputations struct {
 	FeeAmount *big.Int
 }
 
+// Records an initialized tick crossed during a swap and the fee growth
+// globals with which it was crossed.
+type tickCrossing struct {
+	Tick                 int
+	FeeGrowthGlobal0X128 *big.Int
+	FeeGrowthGlobal1X128 *big.Int
+}
+
+// The result of a swap, computed against the pool state but not yet applied
+// to it.
+type SwapResult struct {
+	// The direction of the swap, true for token0 to token1.
+	ZeroForOne bool
+	// The delta of the balance of token0 and token1 of the pool.
+	Amount0 *big.Int
+	Amount1 *big.Int
+	// The price, tick and liquidity in range after the swap.
+	SqrtPriceX96 *big.Int
+	Tick         int
+	Liquidity    *big.Int
+	// The global fee growth of the input token after the swap.
+	FeeGrowthGlobalX128 *big.Int
+	// The amount of the input token paid as protocol fee.
+	ProtocolFee *big.Int
+	// The steps in which the swap was executed.
+	Steps []*StepComputations
+	// The initialized ticks crossed by the swap, in the order they were
+	// crossed. Ticks are only crossed when the swap is applied.
+	crossings []tickCrossing
+	// The traces of the steps, in the same order as Steps.
+	stepTraces []*SwapStepTrace
+}
+
+// Returns the initialized ticks crossed by the swap, in the order they were
+// crossed.
+func (r *SwapResult) TicksCrossed() []int {
+	ticks := make([]int, len(r.crossings))
+	for i, crossing := range r.crossings {
+		ticks[i] = crossing.Tick
+	}
+	return ticks
+}
+
 // Swaps Swap token0 for token1, or token1 for token0.
 //
 // Arguments:
@@ -556,29 +804,70 @@ type StepComputations struct {
 //                      swap as exact input (positive), or exact output (negative)
 // sqrtPriceLimitX96 -- The Q64.96 sqrt price limit. If zero for one, the price
 //                      cannot be less than this value after the swap. If one
-//                      for zero, the price cannot be greater than this value
+//                      for zero, the price cannot be greater than this value.
+//                      The limit must be between the current price and the
+//                      minimum (maximum) price, exclusive, otherwise
+//                      ErrInvalidPriceLimit is returned
 //
 // Returns:
 // amount0           -- The delta of the balance of token0 of the pool, exact
 //                      when negative, minimum when positive
 // amount1           -- The delta of the balance of token1 of the pool, exact
 //                      when negative, minimum when positive
-func (p *Pool) Swap(sender, recipient string, zeroForOne bool, amountSpecified, sqrtPriceLimitX96 *big.Int) (amount0, amount1 *big.Int) {
+// err               -- An error if the swap could not be executed
+func (p *Pool) Swap(sender, recipient string, zeroForOne bool, amountSpecified, sqrtPriceLimitX96 *big.Int) (amount0, amount1 *big.Int, err error) {
 	// Log swap details for debugging
-	fmt.Println("SWAP")
-	fmt.Printf("SWAP - sender: %s", sender)
-	fmt.Println()
-	fmt.Printf("SWAP - recipient: %s", recipient)
-	fmt.Println()
-	fmt.Printf("SWAP - zeroForOne: %t", zeroForOne)
-	fmt.Println()
-	fmt.Printf("SWAP - amountSpecified: %s", amountSpecified)
-	fmt.Println()
+	if logger.Enabled(logging.Debug) {
+		logger.Debug("swap", logging.F("sender", sender), logging.F("recipient", recipient), logging.F("zeroForOne", zeroForOne), logging.F("amountSpecified", amountSpecified), logging.F("tick", p.Slot0.Tick))
+	}
 
+	if err = p.checkLock(); err != nil {
+		return nil, nil, fmt.Errorf("pool.Swap: %w", err)
+	}
+	result, err := p.ComputeSwap(zeroForOne, amountSpecified, sqrtPriceLimitX96)
+	if err != nil {
+		return nil, nil, err
+	}
+	crossings := p.applySwap(result)
+	if p.swapTracer != nil {
+		p.swapTracer.TraceSwap(&SwapTrace{
+			Sender:            sender,
+			Recipient:         recipient,
+			ZeroForOne:        zeroForOne,
+			AmountSpecified:   amountSpecified,
+			SqrtPriceLimitX96: sqrtPriceLimitX96,
+			Amount0:           result.Amount0,
+			Amount1:           result.Amount1,
+			SqrtPriceX96After: result.SqrtPriceX96,
+			TickAfter:         result.Tick,
+			LiquidityAfter:    result.Liquidity,
+			Steps:             result.stepTraces,
+			Crossings:         crossings,
+		})
+	}
+	return result.Amount0, result.Amount1, nil
+}
+
+// Computes the result of a swap without applying it to the pool, i.e. the
+// pool state is left unchanged. Takes the same arguments as Swap.
+//
+// Arguments:
+// zeroForOne        -- The direction of the swap, true for token0 to token1,
+//                      false for token1 to token0
+// amountSpecified   -- The amount of the swap, which implicitly configures the
+//                      swap as exact input (positive), or exact output (negative)
+// sqrtPriceLimitX96 -- The Q64.96 sqrt price limit
+//
+// Returns:
+// result            -- The result of the swap
+// err               -- An error if the swap could not be executed
+func (p *Pool) ComputeSwap(zeroForOne bool, amountSpecified, sqrtPriceLimitX96 *big.Int) (result *SwapResult, err error) {
 	// Check that the amount specified is not 0
 	if amountSpecified.Cmp(big.NewInt(0)) == 0 {
-		message := fmt.Sprintf("pool.Swap: amountSpecified %v must not be 0", amountSpecified)
-		panic(message)
+		return nil, fmt.Errorf("pool.ComputeSwap: %w (amountSpecified %v)", ErrZeroAmount, amountSpecified)
+	}
+	if p.Slot0.SqrtPriceX96.Cmp(big.NewInt(0)) == 0 {
+		return nil, fmt.Errorf("pool.ComputeSwap: %w", ErrNotInitialized)
 	}
 
 	// Store pool state before swap
@@ -588,16 +877,16 @@ func (p *Pool) Swap(sender, recipient string, zeroForOne bool, amountSpecified,
 	var stateFeeGrowthGlobalX128 *big.Int
 	if zeroForOne {
 		// sqrtPriceLimitX96 < slot0Start.sqrtPriceX96 && sqrtPriceLimitX96 > TickMath.MIN_SQRT_RATIO
-		// if !((sqrtPriceLimitX96.Cmp(slot0Start.SqrtPriceX96) <= -1) && (sqrtPriceLimitX96.Cmp(constants.MinSqrtRatioBig) >= 1)) {
-		// 	panic("pool.Swap: Invalid price limit")
-		// }
+		if !((sqrtPriceLimitX96.Cmp(slot0Start.SqrtPriceX96) <= -1) && (sqrtPriceLimitX96.Cmp(constants.MinSqrtRatioBig) >= 1)) {
+			return nil, fmt.Errorf("pool.ComputeSwap: %w (zeroForOne, limit %v, price %v)", ErrInvalidPriceLimit, sqrtPriceLimitX96, slot0Start.SqrtPriceX96)
+		}
 		cacheFeeProtocol = slot0Start.FeeProtocol % 16
 		stateFeeGrowthGlobalX128 = p.FeeGrowthGlobal0X128
 	} else {
 		// sqrtPriceLimitX96 > slot0Start.sqrtPriceX96 && sqrtPriceLimitX96 < TickMath.MAX_SQRT_RATIO
-		// if !((sqrtPriceLimitX96.Cmp(slot0Start.SqrtPriceX96) >= 1) && (sqrtPriceLimitX96.Cmp(constants.MaxSqrtRatio) <= -1)) {
-		// 	panic("pool.Swap: Invalid price limit")
-		// }
+		if !((sqrtPriceLimitX96.Cmp(slot0Start.SqrtPriceX96) >= 1) && (sqrtPriceLimitX96.Cmp(constants.MaxSqrtRatio) <= -1)) {
+			return nil, fmt.Errorf("pool.ComputeSwap: %w (oneForZero, limit %v, price %v)", ErrInvalidPriceLimit, sqrtPriceLimitX96, slot0Start.SqrtPriceX96)
+		}
 		cacheFeeProtocol = slot0Start.FeeProtocol >> 4
 		stateFeeGrowthGlobalX128 = p.FeeGrowthGlobal1X128
 	}
@@ -622,19 +911,27 @@ func (p *Pool) Swap(sender, recipient string, zeroForOne bool, amountSpecified,
 		Liquidity:                cache.LiquidityStart,
 	}
 
+	result = &SwapResult{ZeroForOne: zeroForOne}
+
 	// Continue swapping as long as we haven't used the entire input/output and
 	// haven't reached the price limit.
 	for (state.AmountSpecifiedRemaining.Cmp(big.NewInt(0)) != 0) && (state.SqrtPriceX96.Cmp(sqrtPriceLimitX96) != 0) {
 		step := new(StepComputations)
 		step.SqrtPriceStartX96 = state.SqrtPriceX96
-		step.TickNext, step.Initialized = p.nextInitializedTickWithinOneWord(
+		stepTrace := &SwapStepTrace{
+			SqrtPriceStartX96: state.SqrtPriceX96,
+			TickStart:         state.Tick,
+			LiquidityBefore:   state.Liquidity,
+			ProtocolFee:       big.NewInt(0),
+		}
+		step.TickNext, step.Initialized = p.TickBitmap.NextInitializedTickWithinOneWord(
 			state.Tick,
 			p.TickSpacing,
 			zeroForOne,
 		)
 
-		// Ensure that we do not overshoot the min/max tick (likely unnecessary
-		// in this simulator).
+		// Ensure that we do not overshoot the min/max tick, as the tick bitmap
+		// is not aware of these bounds.
 		if step.TickNext < constants.MinTick {
 			step.TickNext = constants.MinTick
 		} else if step.TickNext > constants.MaxTick {
@@ -685,6 +982,7 @@ func (p *Pool) Swap(sender, recipient string, zeroForOne bool, amountSpecified,
 			delta := new(big.Int).Div(step.FeeAmount, big.NewInt(int64(cache.FeeProtocol)))
 			step.FeeAmount = new(big.Int).Sub(step.FeeAmount, delta)
 			state.ProtocolFee = new(big.Int).Add(state.ProtocolFee, delta)
+			stepTrace.ProtocolFee = delta
 		}
 
 		// Update global fee tracker
@@ -694,21 +992,22 @@ func (p *Pool) Swap(sender, recipient string, zeroForOne bool, amountSpecified,
 
 		// Shift tick if we reached the next price
 		if state.SqrtPriceX96.Cmp(step.SqrtPriceNextX96) == 0 {
-			// If the tick is initialized, run the tick transition
+			// If the tick is initialized, run the tick transition. The
+			// transition itself is deferred until the swap is applied, but
+			// the liquidityNet of a tick is not changed by crossing it.
 			if step.Initialized {
-				tempFeeGrowthGlobal0X128 := p.FeeGrowthGlobal0X128
-				tempFeeGrowthGlobal1X128 := state.FeeGrowthGlobalX128
+				crossing := tickCrossing{
+					Tick:                 step.TickNext,
+					FeeGrowthGlobal0X128: p.FeeGrowthGlobal0X128,
+					FeeGrowthGlobal1X128: state.FeeGrowthGlobalX128,
+				}
 				if zeroForOne {
-					tempFeeGrowthGlobal0X128 = state.FeeGrowthGlobalX128
-					tempFeeGrowthGlobal1X128 = p.FeeGrowthGlobal1X128
+					crossing.FeeGrowthGlobal0X128 = state.FeeGrowthGlobalX128
+					crossing.FeeGrowthGlobal1X128 = p.FeeGrowthGlobal1X128
 				}
+				result.crossings = append(result.crossings, crossing)
 
-				liquidityNet := p.Ticks.Cross(
-					step.TickNext,
-					tempFeeGrowthGlobal0X128,
-					tempFeeGrowthGlobal1X128,
-				)
-
+				liquidityNet := p.Ticks.Lookup(step.TickNext).LiquidityNet
 				if zeroForOne {
 					// If we're moving leftward, we interpret liquidityNet as
 					// the opposite sign.
@@ -728,78 +1027,104 @@ func (p *Pool) Swap(sender, recipient string, zeroForOne bool, amountSpecified,
 			// transitioned ticks), and haven't moved.
 			state.Tick = tickMath.GetTickAtSqrtRatio(state.SqrtPriceX96)
 		}
+		result.Steps = append(result.Steps, step)
+
+		stepTrace.SqrtPriceEndX96 = state.SqrtPriceX96
+		stepTrace.TickEnd = state.Tick
+		stepTrace.TickNext = step.TickNext
+		stepTrace.SqrtPriceNextX96 = step.SqrtPriceNextX96
+		stepTrace.Initialized = step.Initialized
+		stepTrace.AmountIn = step.AmountIn
+		stepTrace.AmountOut = step.AmountOut
+		stepTrace.FeeAmount = step.FeeAmount
+		stepTrace.LiquidityAfter = state.Liquidity
+		result.stepTraces = append(result.stepTraces, stepTrace)
+	}
+
+	if zeroForOne == exactInput {
+		result.Amount0 = new(big.Int).Sub(amountSpecified, state.AmountSpecifiedRemaining)
+		result.Amount1 = state.AmountCalculated
+	} else {
+		result.Amount0 = state.AmountCalculated
+		result.Amount1 = new(big.Int).Sub(amountSpecified, state.AmountSpecifiedRemaining)
+	}
+	result.SqrtPriceX96 = state.SqrtPriceX96
+	result.Tick = state.Tick
+	result.Liquidity = state.Liquidity
+	result.FeeGrowthGlobalX128 = state.FeeGrowthGlobalX128
+	result.ProtocolFee = state.ProtocolFee
+	return result, nil
+}
+
+// Applies the result of a swap (as computed by ComputeSwap) to the pool.
+// Returns the traces of the ticks crossed if the pool has a swap tracer (see
+// SetSwapTracer), and nil otherwise.
+func (p *Pool) applySwap(result *SwapResult) (crossings []*TickCrossTrace) {
+	// Run the tick transitions for the initialized ticks crossed. The oracle
+	// values are the same for every tick crossed by the swap (they are
+	// computed before the swap's observation is written).
+	if len(result.crossings) > 0 {
+		time := p.blockTimestamp()
+		tickCumulative, secondsPerLiquidityCumulativeX128 := p.observeCurrent()
+		for _, crossing := range result.crossings {
+			p.touchTick(crossing.Tick)
+			liquidityNet := p.Ticks.Cross(
+				crossing.Tick,
+				crossing.FeeGrowthGlobal0X128,
+				crossing.FeeGrowthGlobal1X128,
+				secondsPerLiquidityCumulativeX128,
+				tickCumulative,
+				time,
+			)
+			if p.swapTracer != nil {
+				tickInfo := p.Ticks.Get(crossing.Tick)
+				crossings = append(crossings, &TickCrossTrace{
+					Tick:                  crossing.Tick,
+					LiquidityNet:          liquidityNet,
+					FeeGrowthOutside0X128: tickInfo.FeeGrowthOutside0X128,
+					FeeGrowthOutside1X128: tickInfo.FeeGrowthOutside1X128,
+				})
+			}
+		}
+	}
+
+	// Write an oracle entry if the tick changed (before the tick and
+	// liquidity are updated).
+	if result.Tick != p.Slot0.Tick {
+		p.writeObservation(p.Slot0.Tick, p.Liquidity)
 	}
 
 	// Update the price.
-	p.Slot0.SqrtPriceX96 = state.SqrtPriceX96
+	p.Slot0.SqrtPriceX96 = result.SqrtPriceX96
 
 	// Update tick if the tick change.
-	if state.Tick != slot0Start.Tick {
-		p.Slot0.Tick = state.Tick
+	if result.Tick != p.Slot0.Tick {
+		p.Slot0.Tick = result.Tick
 	}
 
 	// Update liquidity if it changed.
-	if cache.LiquidityStart.Cmp(state.Liquidity) != 0 {
-		fmt.Println("CHANGING LIQUIDITY")
-		fmt.Println("BEFORE: ", p.Liquidity)
-		p.Liquidity = state.Liquidity
-		fmt.Println("AFTER: ", p.Liquidity)
-		fmt.Println()
+	if p.Liquidity.Cmp(result.Liquidity) != 0 {
+		if logger.Enabled(logging.Debug) {
+			logger.Debug("liquidity changed", logging.F("before", p.Liquidity), logging.F("after", result.Liquidity), logging.F("tick", result.Tick))
+		}
+		p.Liquidity = result.Liquidity
 	}
 
 	// Update fee growth global and, if necessary, protocol fees.
-	if zeroForOne {
-		p.FeeGrowthGlobal0X128 = state.FeeGrowthGlobalX128
-		if state.ProtocolFee.Cmp(big.NewInt(0)) >= 1 {
-			p.ProtocolFees.Token0 = new(big.Int).Add(p.ProtocolFees.Token0, state.ProtocolFee)
+	if result.ZeroForOne {
+		p.FeeGrowthGlobal0X128 = result.FeeGrowthGlobalX128
+		if result.ProtocolFee.Cmp(big.NewInt(0)) >= 1 {
+			p.ProtocolFees.Token0 = new(big.Int).Add(p.ProtocolFees.Token0, result.ProtocolFee)
 		}
 	} else {
-		p.FeeGrowthGlobal1X128 = state.FeeGrowthGlobalX128
-		if state.ProtocolFee.Cmp(big.NewInt(0)) >= 1 {
-			p.ProtocolFees.Token1 = new(big.Int).Add(p.ProtocolFees.Token1, state.ProtocolFee)
+		p.FeeGrowthGlobal1X128 = result.FeeGrowthGlobalX128
+		if result.ProtocolFee.Cmp(big.NewInt(0)) >= 1 {
+			p.ProtocolFees.Token1 = new(big.Int).Add(p.ProtocolFees.Token1, result.ProtocolFee)
 		}
 	}
 
-	if zeroForOne == exactInput {
-		amount0 = new(big.Int).Sub(amountSpecified, state.AmountSpecifiedRemaining)
-		amount1 = state.AmountCalculated
-	} else {
-		amount0 = state.AmountCalculated
-		amount1 = new(big.Int).Sub(amountSpecified, state.AmountSpecifiedRemaining)
-	}
-
 	// Update pool balances
-	p.Balance0 = new(big.Int).Add(p.Balance0, amount0)
-	p.Balance1 = new(big.Int).Add(p.Balance1, amount1)
+	p.Balance0 = new(big.Int).Add(p.Balance0, result.Amount0)
+	p.Balance1 = new(big.Int).Add(p.Balance1, result.Amount1)
 	return
 }
-
-// Does not actually emulate the flash function, but instead just calculates
-// the changes to protocol fees and fee growth as a result of the flash.
-func (p *Pool) Flash(paid0, paid1 *big.Int) {
-	if paid0.Cmp(big.NewInt(0)) >= 1 {
-		feeProtocol0 := p.Slot0.FeeProtocol % 16
-		fees0 := big.NewInt(0)
-		if feeProtocol0 != 0 {
-			fees0 = new(big.Int).Div(paid0, big.NewInt(int64(feeProtocol0)))
-		}
-
-		if fees0.Cmp(big.NewInt(0)) >= 1 {
-			p.ProtocolFees.Token0 = new(big.Int).Add(p.ProtocolFees.Token0, fees0)
-		}
-		p.FeeGrowthGlobal0X128 = new(big.Int).Add(p.FeeGrowthGlobal0X128, fullMath.MulDiv(new(big.Int).Sub(paid0, fees0), constants.Q128, p.Liquidity))
-	}
-	if paid1.Cmp(big.NewInt(0)) >= 1 {
-		feeProtocol1 := p.Slot0.FeeProtocol >> 4
-		fees1 := big.NewInt(0)
-		if feeProtocol1 != 0 {
-			fees1 = new(big.Int).Div(paid1, big.NewInt(int64(feeProtocol1)))
-		}
-		if fees1.Cmp(big.NewInt(0)) >= 1 {
-			p.ProtocolFees.Token1 = new(big.Int).Add(p.ProtocolFees.Token1, fees1)
-		}
-		p.FeeGrowthGlobal1X128 = new(big.Int).Add(p.FeeGrowthGlobal1X128, fullMath.MulDiv(new(big.Int).Sub(paid1, fees1), constants.Q128, p.Liquidity))
-	}
-	p.Balance0 = new(big.Int).Add(p.Balance0, paid0)
-	p.Balance1 = new(big.Int).Add(p.Balance1, paid1)
-}
@@ -0,0 +1,944 @@
+package pool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/constants"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/oracle"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/position"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/tick"
+)
+
+// sqrt(1/10) as a Q64.96, i.e. encodePriceSqrt(1, 10) in the Uniswap tests.
+var priceOneToTen, _ = new(big.Int).SetString("25054144837504793118641380156", 10)
+
+// Returns an initialized pool with a fee of 0.3% and a tick spacing of 60, at
+// a price of 1:10.
+func initializedPool() *Pool {
+	p := Make("0xA", "0xB", 3000, 60)
+	p.Initialize(priceOneToTen)
+	return p
+}
+
+func TestMake(t *testing.T) {
+	fmt.Println("Make: Derives the max liquidity per tick from the tick spacing and is not initialized")
+	p := Make("0xA", "0xB", 3000, 60)
+	expected, _ := new(big.Int).SetString("11505743598341114571880798222544994", 10)
+	if p.MaxLiquidityPerTick.Cmp(expected) != 0 {
+		t.Errorf("MaxLiquidityPerTick: Got %v; want %v", p.MaxLiquidityPerTick, expected)
+	}
+	if p.Slot0.SqrtPriceX96.Cmp(big.NewInt(0)) != 0 {
+		t.Errorf("Expected the pool not to be initialized, got price %v", p.Slot0.SqrtPriceX96)
+	}
+}
+
+func TestInitialize(t *testing.T) {
+	fmt.Println("Initialize: Sets the initial price, tick and oracle")
+	p := Make("0xA", "0xB", 3000, 60)
+	p.BlockTimestamp = 5
+	p.Initialize(priceOneToTen)
+	if p.Slot0.SqrtPriceX96.Cmp(priceOneToTen) != 0 || p.Slot0.Tick != -23028 {
+		t.Errorf("Got price %v, tick %d; want %v, -23028", p.Slot0.SqrtPriceX96, p.Slot0.Tick, priceOneToTen)
+	}
+	if p.Slot0.ObservationIndex != 0 || p.Slot0.ObservationCardinality != 1 || p.Slot0.ObservationCardinalityNext != 1 {
+		t.Errorf("Got observation index %d, cardinality %d, cardinality next %d; want 0, 1, 1", p.Slot0.ObservationIndex, p.Slot0.ObservationCardinality, p.Slot0.ObservationCardinalityNext)
+	}
+	if len(p.Observations) != 1 || !p.Observations[0].Initialized || p.Observations[0].BlockTimestamp != 5 {
+		t.Errorf("Got observations %+v; want one initialized observation at 5", p.Observations)
+	}
+}
+
+func TestInitializeFailsIfInitialized(t *testing.T) {
+	fmt.Println("Initialize: Fails if the pool is already initialized")
+	p := initializedPool()
+	if err := p.Initialize(big.NewInt(1)); !errors.Is(err, ErrAlreadyInitialized) {
+		t.Errorf("Expected ErrAlreadyInitialized, got %v", err)
+	}
+	if p.Slot0.SqrtPriceX96.Cmp(priceOneToTen) != 0 {
+		t.Errorf("Expected the price to be unchanged, got %v", p.Slot0.SqrtPriceX96)
+	}
+}
+
+func TestInitializeFailsIfPriceOutOfRange(t *testing.T) {
+	fmt.Println("Initialize: Fails if the price is less than MIN_SQRT_RATIO or at least MAX_SQRT_RATIO")
+	prices := []*big.Int{
+		big.NewInt(0),
+		new(big.Int).Sub(constants.MinSqrtRatioBig, big.NewInt(1)),
+		constants.MaxSqrtRatio,
+	}
+	for _, price := range prices {
+		p := Make("0xA", "0xB", 3000, 60)
+		if err := p.Initialize(price); !errors.Is(err, ErrInvalidSqrtPrice) {
+			t.Errorf("Initialize(%v): Expected ErrInvalidSqrtPrice, got %v", price, err)
+		}
+		if p.Slot0.SqrtPriceX96.Sign() != 0 || len(p.Observations) != 0 {
+			t.Errorf("Initialize(%v): Expected the pool to be unchanged", price)
+		}
+	}
+
+	// The minimum price is valid, and the caller's value is not shared.
+	p := Make("0xA", "0xB", 3000, 60)
+	price := new(big.Int).Set(constants.MinSqrtRatioBig)
+	if err := p.Initialize(price); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	price.Add(price, big.NewInt(1))
+	if p.Slot0.SqrtPriceX96.Cmp(constants.MinSqrtRatioBig) != 0 || p.Slot0.Tick != -887272 {
+		t.Errorf("Got price %v, tick %d; want %v, -887272", p.Slot0.SqrtPriceX96, p.Slot0.Tick, constants.MinSqrtRatioBig)
+	}
+}
+
+func TestMintFullRange(t *testing.T) {
+	fmt.Println("Mint: Full range mint on a fresh pool transfers the correct amounts")
+	p := initializedPool()
+	amount0, amount1, err := p.Mint("0xC", -887220, 887220, big.NewInt(3161))
+	if err != nil {
+		t.Fatalf("Mint failed: %v", err)
+	}
+	if amount0.Cmp(big.NewInt(9996)) != 0 || amount1.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("Got %v, %v; want 9996, 1000", amount0, amount1)
+	}
+	if p.Liquidity.Cmp(big.NewInt(3161)) != 0 {
+		t.Errorf("Liquidity: Got %v; want 3161", p.Liquidity)
+	}
+	if !p.TickBitmap.IsInitialized(-887220, 60) || !p.TickBitmap.IsInitialized(887220, 60) {
+		t.Errorf("Expected ticks -887220 and 887220 to be initialized in the tick bitmap")
+	}
+}
+
+func TestSwapWritesObservation(t *testing.T) {
+	fmt.Println("Swap: Writes an observation when the tick changes")
+	p := initializedPool()
+	p.Mint("0xC", -887220, 887220, big.NewInt(3161))
+	p.SetBlockTimestamp(10)
+	startTick := p.Slot0.Tick
+	p.Swap("0xC", "0xC", true, big.NewInt(1000), new(big.Int).Add(big.NewInt(4295128739), big.NewInt(1)))
+	if p.Slot0.Tick >= startTick {
+		t.Errorf("Expected the tick to decrease from %d, got %d", startTick, p.Slot0.Tick)
+	}
+	if p.Observations[0].BlockTimestamp != 10 || p.Observations[0].TickCumulative != int64(startTick)*10 {
+		t.Errorf("Got observation %+v; want timestamp 10, tick cumulative %d", p.Observations[0], int64(startTick)*10)
+	}
+}
+
+func TestSnapshotCumulativesInside(t *testing.T) {
+	fmt.Println("SnapshotCumulativesInside: Accumulates seconds inside an in range position")
+	p := initializedPool()
+	p.Mint("0xC", -23040, -22980, big.NewInt(100))
+	_, _, secondsInsideStart, _ := p.SnapshotCumulativesInside(-23040, -22980)
+	p.SetBlockTimestamp(20)
+	tickCumulativeInside, _, secondsInside, err := p.SnapshotCumulativesInside(-23040, -22980)
+	if err != nil {
+		t.Fatalf("SnapshotCumulativesInside failed: %v", err)
+	}
+	if secondsInside-secondsInsideStart != 20 {
+		t.Errorf("Got %d seconds inside; want 20", secondsInside-secondsInsideStart)
+	}
+	if tickCumulativeInside != -23028*20 {
+		t.Errorf("Got tick cumulative inside %d; want %d", tickCumulativeInside, -23028*20)
+	}
+}
+
+func TestSnapshotCumulativesInsideFailsIfTicksNotInitialized(t *testing.T) {
+	fmt.Println("SnapshotCumulativesInside: Fails if the ticks are not initialized")
+	p := initializedPool()
+	if _, _, _, err := p.SnapshotCumulativesInside(-60, 60); !errors.Is(err, ErrTickNotInitialized) {
+		t.Errorf("Expected ErrTickNotInitialized, got %v", err)
+	}
+}
+
+func TestMintErrors(t *testing.T) {
+	fmt.Println("Mint: Returns typed errors for invalid mints")
+	tests := []struct {
+		tickLower int
+		tickUpper int
+		amount    *big.Int
+		err       error
+	}{
+		{60, -60, big.NewInt(1), ErrTickOrder},
+		{60, 60, big.NewInt(1), ErrTickOrder},
+		{-887280, 60, big.NewInt(1), ErrTickLowerTooLow},
+		{-60, 887280, big.NewInt(1), ErrTickUpperTooHigh},
+		{-60, 60, big.NewInt(0), ErrZeroAmount},
+		{1, 7, big.NewInt(1000), ErrTickSpacing},
+		{-60, 90, big.NewInt(1000), ErrTickSpacing},
+		{-60, 60, new(big.Int).Add(tick.TickSpacingToMaxLiquidityPerTick(60), big.NewInt(1)), tick.ErrMaxLiquidityPerTick},
+	}
+	for _, test := range tests {
+		p := initializedPool()
+		_, _, err := p.Mint("0xC", test.tickLower, test.tickUpper, test.amount)
+		if !errors.Is(err, test.err) {
+			t.Errorf("Mint(%d, %d, %v): Got %v; want %v", test.tickLower, test.tickUpper, test.amount, err, test.err)
+		}
+	}
+}
+
+func TestMintNotInitialized(t *testing.T) {
+	fmt.Println("Mint: Fails if the pool is not initialized")
+	p := Make("0xA", "0xB", 3000, 60)
+	if _, _, err := p.Mint("0xC", -60, 60, big.NewInt(1)); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("Expected ErrNotInitialized, got %v", err)
+	}
+}
+
+func TestMintFailureLeavesPoolUnchanged(t *testing.T) {
+	fmt.Println("Mint: A failed mint does not change the ticks, positions or balances")
+	p := initializedPool()
+	p.Mint("0xC", -120, 60, big.NewInt(100))
+	maxLiquidity := p.MaxLiquidityPerTick
+	// The lower tick can be updated but the upper tick exceeds the max.
+	p.MaxLiquidityPerTick = big.NewInt(150)
+	_, _, err := p.Mint("0xD", -60, 60, big.NewInt(60))
+	if !errors.Is(err, tick.ErrMaxLiquidityPerTick) {
+		t.Fatalf("Expected ErrMaxLiquidityPerTick, got %v", err)
+	}
+	p.MaxLiquidityPerTick = maxLiquidity
+	if _, found := p.Ticks.TickData[-60]; found || p.TickBitmap.IsInitialized(-60, 60) {
+		t.Errorf("Expected tick -60 not to be initialized")
+	}
+	if p.Ticks.TickData[60].LiquidityGross.Cmp(big.NewInt(100)) != 0 {
+		t.Errorf("Expected tick 60 to be unchanged, got liquidityGross %v", p.Ticks.TickData[60].LiquidityGross)
+	}
+	if _, found := p.Position(PositionKey{"0xD", -60, 60}); found {
+		t.Errorf("Expected the position not to be created")
+	}
+	if len(p.Positions) != 1 {
+		t.Errorf("Got %d positions; want 1", len(p.Positions))
+	}
+
+	// The upper tick is not a multiple of the tick spacing.
+	before := poolJSON(t, p)
+	if _, _, err := p.Mint("0xD", -120, 90, big.NewInt(60)); !errors.Is(err, ErrTickSpacing) {
+		t.Fatalf("Expected ErrTickSpacing, got %v", err)
+	}
+	if after := poolJSON(t, p); after != before {
+		t.Errorf("Expected the pool to be unchanged, got %s; want %s", after, before)
+	}
+}
+
+func TestBurnErrors(t *testing.T) {
+	fmt.Println("Burn: Returns typed errors for missing positions and insufficient liquidity")
+	p := initializedPool()
+	p.Mint("0xC", -60, 60, big.NewInt(100))
+	if _, _, err := p.Burn("0xD", -60, 60, big.NewInt(1)); !errors.Is(err, ErrPositionNotFound) {
+		t.Errorf("Expected ErrPositionNotFound, got %v", err)
+	}
+	if _, _, err := p.Burn("0xC", -60, 60, big.NewInt(101)); !errors.Is(err, position.ErrInsufficientLiquidity) {
+		t.Errorf("Expected ErrInsufficientLiquidity, got %v", err)
+	}
+	pos, _ := p.Position(PositionKey{"0xC", -60, 60})
+	if p.Ticks.TickData[-60].LiquidityGross.Cmp(big.NewInt(100)) != 0 || pos.Liquidity.Cmp(big.NewInt(100)) != 0 {
+		t.Errorf("Expected the tick and position to be unchanged")
+	}
+	if _, _, err := p.Collect("0xD", -60, 60, big.NewInt(1), big.NewInt(1)); !errors.Is(err, ErrPositionNotFound) {
+		t.Errorf("Expected ErrPositionNotFound from Collect, got %v", err)
+	}
+}
+
+func TestSwapErrors(t *testing.T) {
+	fmt.Println("Swap: Returns typed errors for zero amounts and uninitialized pools")
+	p := initializedPool()
+	if _, _, err := p.Swap("0xC", "0xC", true, big.NewInt(0), big.NewInt(4295128740)); !errors.Is(err, ErrZeroAmount) {
+		t.Errorf("Expected ErrZeroAmount, got %v", err)
+	}
+	p = Make("0xA", "0xB", 3000, 60)
+	if _, _, err := p.Swap("0xC", "0xC", true, big.NewInt(1), big.NewInt(4295128740)); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("Expected ErrNotInitialized, got %v", err)
+	}
+}
+
+func TestSwapInvalidPriceLimit(t *testing.T) {
+	fmt.Println("Swap: Fails if the price limit is on the wrong side of the price or out of range")
+	p := initializedPool()
+	p.Mint("0xC", -887220, 887220, big.NewInt(3161))
+	minSqrtRatio := big.NewInt(4295128739)
+	maxSqrtRatio, _ := new(big.Int).SetString("1461446703485210103287273052203988822378723970342", 10)
+	tests := []struct {
+		zeroForOne bool
+		limit      *big.Int
+	}{
+		{true, new(big.Int).Add(priceOneToTen, big.NewInt(1))},
+		{true, priceOneToTen},
+		{true, minSqrtRatio},
+		{false, new(big.Int).Sub(priceOneToTen, big.NewInt(1))},
+		{false, priceOneToTen},
+		{false, maxSqrtRatio},
+	}
+	for _, test := range tests {
+		if _, _, err := p.Swap("0xC", "0xC", test.zeroForOne, big.NewInt(1000), test.limit); !errors.Is(err, ErrInvalidPriceLimit) {
+			t.Errorf("Swap(%t, %v): Expected ErrInvalidPriceLimit, got %v", test.zeroForOne, test.limit, err)
+		}
+	}
+	if p.Slot0.SqrtPriceX96.Cmp(priceOneToTen) != 0 {
+		t.Errorf("Expected the price to be unchanged, got %v", p.Slot0.SqrtPriceX96)
+	}
+	if _, _, err := p.Swap("0xC", "0xC", false, big.NewInt(1000), new(big.Int).Sub(maxSqrtRatio, big.NewInt(1))); err != nil {
+		t.Errorf("Expected a one for zero swap with limit MaxSqrtRatio - 1 to succeed, got %v", err)
+	}
+}
+
+// Returns the pool state as JSON, used to compare pool states.
+func poolJSON(t *testing.T, p *Pool) string {
+	poolJSON, err := json.Marshal(PoolToPoolTemp(p))
+	if err != nil {
+		t.Fatalf("Failed to marshal pool: %v", err)
+	}
+	return string(poolJSON)
+}
+
+// Adds every big.Int reachable from v to ints.
+func collectBigInts(v reflect.Value, ints map[*big.Int]bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		if x, ok := v.Interface().(*big.Int); ok {
+			ints[x] = true
+			return
+		}
+		collectBigInts(v.Elem(), ints)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				collectBigInts(v.Field(i), ints)
+			}
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			collectBigInts(v.MapIndex(key), ints)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			collectBigInts(v.Index(i), ints)
+		}
+	}
+}
+
+// Returns a pool with two positions, one of which is crossed by swapping
+// 10000 token0.
+func poolWithPositions(t *testing.T) *Pool {
+	p := initializedPool()
+	p.SetBlockTimestamp(1)
+	if err := p.IncreaseObservationCardinalityNext(4); err != nil {
+		t.Fatalf("IncreaseObservationCardinalityNext failed: %v", err)
+	}
+	if _, _, err := p.Mint("0xC", -887220, 887220, big.NewInt(3161)); err != nil {
+		t.Fatalf("Mint failed: %v", err)
+	}
+	if _, _, err := p.Mint("0xD", -23100, -22980, big.NewInt(100000)); err != nil {
+		t.Fatalf("Mint failed: %v", err)
+	}
+	return p
+}
+
+// Swaps, mints, burns and collects, crossing a tick and writing observations.
+func changePool(t *testing.T, p *Pool) {
+	p.SetBlockTimestamp(p.BlockTimestamp + 10)
+	if _, _, err := p.Swap("0xC", "0xC", true, big.NewInt(10000), big.NewInt(4295128740)); err != nil {
+		t.Fatalf("Swap failed: %v", err)
+	}
+	if p.Slot0.Tick >= -23100 {
+		t.Fatalf("Expected the swap to cross tick -23100, got tick %d", p.Slot0.Tick)
+	}
+	p.SetBlockTimestamp(p.BlockTimestamp + 10)
+	if _, _, err := p.Mint("0xE", -24000, -23040, big.NewInt(5000)); err != nil {
+		t.Fatalf("Mint failed: %v", err)
+	}
+	if _, _, err := p.Burn("0xD", -23100, -22980, big.NewInt(40000)); err != nil {
+		t.Fatalf("Burn failed: %v", err)
+	}
+	if _, _, err := p.Collect("0xD", -23100, -22980, big.NewInt(1), big.NewInt(1)); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+}
+
+func TestClone(t *testing.T) {
+	fmt.Println("Clone: Changes to the clone do not change the pool and no big.Int is shared")
+	p := poolWithPositions(t)
+	before := poolJSON(t, p)
+	clone := p.Clone()
+	if poolJSON(t, clone) != before {
+		t.Errorf("Expected the clone to equal the pool")
+	}
+	poolInts := make(map[*big.Int]bool)
+	cloneInts := make(map[*big.Int]bool)
+	collectBigInts(reflect.ValueOf(p), poolInts)
+	collectBigInts(reflect.ValueOf(clone), cloneInts)
+	for x := range cloneInts {
+		if poolInts[x] {
+			t.Errorf("Expected no big.Int to be shared, %v is shared", x)
+		}
+	}
+	changePool(t, clone)
+	if poolJSON(t, p) != before {
+		t.Errorf("Expected the pool to be unchanged by changes to the clone")
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	fmt.Println("Snapshot: Restore undoes swaps, mints, burns and collects and can be repeated")
+	p := poolWithPositions(t)
+	before := poolJSON(t, p)
+	positionKeys := len(p.positionKeys)
+	snapshot := p.Snapshot()
+	changePool(t, p)
+	after := poolJSON(t, p)
+	p.Restore(snapshot)
+	if poolJSON(t, p) != before {
+		t.Errorf("Expected the pool to be restored")
+	}
+	if len(p.positionKeys) != positionKeys {
+		t.Errorf("Got %d position keys; want %d, the keys indexed before the snapshot", len(p.positionKeys), positionKeys)
+	}
+	changePool(t, p)
+	if poolJSON(t, p) != after {
+		t.Errorf("Expected the same changes to give the same pool after restoring")
+	}
+	p.Restore(snapshot)
+	if poolJSON(t, p) != before {
+		t.Errorf("Expected the pool to be restored a second time")
+	}
+}
+
+func TestSnapshotNested(t *testing.T) {
+	fmt.Println("Snapshot: Nested snapshots can be restored and discarded")
+	p := poolWithPositions(t)
+	before := poolJSON(t, p)
+	outer := p.Snapshot()
+	p.SetBlockTimestamp(p.BlockTimestamp + 10)
+	p.Swap("0xC", "0xC", false, big.NewInt(100), new(big.Int).Add(p.Slot0.SqrtPriceX96, big.NewInt(1e15)))
+	middle := poolJSON(t, p)
+	inner := p.Snapshot()
+	changePool(t, p)
+	p.Restore(inner)
+	if poolJSON(t, p) != middle {
+		t.Errorf("Expected the pool to be restored to the inner snapshot")
+	}
+	changePool(t, p)
+	p.Discard(inner)
+	p.Restore(outer)
+	if poolJSON(t, p) != before {
+		t.Errorf("Expected the pool to be restored to the outer snapshot after discarding the inner snapshot")
+	}
+	p.Discard(outer)
+	if len(p.snapshots) != 0 {
+		t.Errorf("Expected no snapshots, got %d", len(p.snapshots))
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected Restore to panic for a discarded snapshot")
+		}
+	}()
+	p.Restore(outer)
+}
+
+func TestSnapshotCopiesOnWrite(t *testing.T) {
+	fmt.Println("Snapshot: Ticks, tick bitmap words, positions and observations are only copied when they are changed")
+	p := poolWithPositions(t)
+	lower := p.Ticks.TickData[-887220]
+	crossed := p.Ticks.TickData[-23100]
+	snapshot := p.Snapshot()
+	if len(snapshot.tickBitmap) != 0 || len(snapshot.changedObservations) != 0 || &snapshot.observations[0] != &p.Observations[0] {
+		t.Errorf("Expected taking a snapshot not to copy the tick bitmap or the observations")
+	}
+	changePool(t, p)
+	if p.Ticks.TickData[-887220] != lower {
+		t.Errorf("Expected an unchanged tick not to be copied")
+	}
+	if p.Ticks.TickData[-23100] == crossed {
+		t.Errorf("Expected a crossed tick to be copied")
+	}
+	// The mint of 0xE initializes ticks -24000 and -23040, which are in the
+	// same word, and only the swap writes an observation (the mint and the
+	// burn are out of range).
+	if len(snapshot.tickBitmap) != 1 || len(snapshot.changedObservations) != 1 {
+		t.Errorf("Got %d words and %d observations recorded; want 1 and 1", len(snapshot.tickBitmap), len(snapshot.changedObservations))
+	}
+}
+
+func TestSetFeeProtocol(t *testing.T) {
+	fmt.Println("SetFeeProtocol: Accepts 0 and 4 to 10 and packs the fees into slot0")
+	p := initializedPool()
+	for _, fee := range []int{-1, 1, 3, 11, 16} {
+		if err := p.SetFeeProtocol(fee, 6); !errors.Is(err, ErrInvalidFeeProtocol) {
+			t.Errorf("SetFeeProtocol(%d, 6): Expected ErrInvalidFeeProtocol, got %v", fee, err)
+		}
+		if err := p.SetFeeProtocol(6, fee); !errors.Is(err, ErrInvalidFeeProtocol) {
+			t.Errorf("SetFeeProtocol(6, %d): Expected ErrInvalidFeeProtocol, got %v", fee, err)
+		}
+	}
+	if p.Slot0.FeeProtocol != 0 {
+		t.Errorf("Expected the protocol fee to be unchanged, got %d", p.Slot0.FeeProtocol)
+	}
+	if err := p.SetFeeProtocol(6, 10); err != nil || p.Slot0.FeeProtocol != 6+10<<4 {
+		t.Errorf("Got protocol fee %d, error %v; want %d, nil", p.Slot0.FeeProtocol, err, 6+10<<4)
+	}
+	if err := p.SetFeeProtocol(0, 0); err != nil || p.Slot0.FeeProtocol != 0 {
+		t.Errorf("Got protocol fee %d, error %v; want 0, nil", p.Slot0.FeeProtocol, err)
+	}
+}
+
+func TestCollectProtocol(t *testing.T) {
+	fmt.Println("CollectProtocol: Collects the protocol fees accrued by swaps, leaving one wei")
+	p := initializedPool()
+	p.Mint("0xC", -887220, 887220, big.NewInt(3161000))
+	p.SetFeeProtocol(6, 0)
+	p.Swap("0xC", "0xC", true, big.NewInt(100000), big.NewInt(4295128740))
+	// The fee is 300, a sixth of which goes to the protocol.
+	if p.ProtocolFees.Token0.Cmp(big.NewInt(50)) != 0 || p.ProtocolFees.Token1.Cmp(big.NewInt(0)) != 0 {
+		t.Fatalf("Got protocol fees %v, %v; want 50, 0", p.ProtocolFees.Token0, p.ProtocolFees.Token1)
+	}
+	balance0 := p.Balance0
+	amount0, amount1, err := p.CollectProtocol("0xF", big.NewInt(20), big.NewInt(20))
+	if err != nil || amount0.Cmp(big.NewInt(20)) != 0 || amount1.Cmp(big.NewInt(0)) != 0 {
+		t.Errorf("Got %v, %v, %v; want 20, 0, nil", amount0, amount1, err)
+	}
+	amount0, _, _ = p.CollectProtocol("0xF", big.NewInt(100), big.NewInt(0))
+	if amount0.Cmp(big.NewInt(29)) != 0 || p.ProtocolFees.Token0.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("Got %v collected, %v left; want 29, 1", amount0, p.ProtocolFees.Token0)
+	}
+	if new(big.Int).Sub(balance0, p.Balance0).Cmp(big.NewInt(49)) != 0 {
+		t.Errorf("Expected the pool's balance to decrease by 49, got %v", new(big.Int).Sub(balance0, p.Balance0))
+	}
+}
+
+// Returns a flash callback that repays the amounts borrowed plus the given
+// amounts.
+func repay(amount0, amount1, extra0, extra1 *big.Int) FlashCallback {
+	return func(_ *Pool, _, _ *big.Int) (*big.Int, *big.Int, error) {
+		return new(big.Int).Add(amount0, extra0), new(big.Int).Add(amount1, extra1), nil
+	}
+}
+
+func TestFlash(t *testing.T) {
+	fmt.Println("Flash: Rounds the fees up and credits them to liquidity providers and the protocol")
+	p := initializedPool()
+	p.Mint("0xC", -887220, 887220, big.NewInt(3161000))
+	p.SetFeeProtocol(0, 4)
+	balance0, balance1 := p.Balance0, p.Balance1
+	var fee0, fee1 *big.Int
+	paid0, paid1, err := p.Flash("0xF", big.NewInt(1001), big.NewInt(2000), func(_ *Pool, f0, f1 *big.Int) (*big.Int, *big.Int, error) {
+		fee0, fee1 = f0, f1
+		return big.NewInt(1005), big.NewInt(2006), nil
+	})
+	if err != nil {
+		t.Fatalf("Flash failed: %v", err)
+	}
+	// 0.3% of 1001 is 3.003, which is rounded up.
+	if fee0.Cmp(big.NewInt(4)) != 0 || fee1.Cmp(big.NewInt(6)) != 0 {
+		t.Errorf("Got fees %v, %v; want 4, 6", fee0, fee1)
+	}
+	if paid0.Cmp(big.NewInt(4)) != 0 || paid1.Cmp(big.NewInt(6)) != 0 {
+		t.Errorf("Got paid %v, %v; want 4, 6", paid0, paid1)
+	}
+	if new(big.Int).Sub(p.Balance0, balance0).Cmp(big.NewInt(4)) != 0 || new(big.Int).Sub(p.Balance1, balance1).Cmp(big.NewInt(6)) != 0 {
+		t.Errorf("Expected the pool's balances to increase by 4 and 6, got %v, %v", new(big.Int).Sub(p.Balance0, balance0), new(big.Int).Sub(p.Balance1, balance1))
+	}
+	// A quarter of the token1 fee (rounded down) goes to the protocol.
+	if p.ProtocolFees.Token0.Cmp(big.NewInt(0)) != 0 || p.ProtocolFees.Token1.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("Got protocol fees %v, %v; want 0, 1", p.ProtocolFees.Token0, p.ProtocolFees.Token1)
+	}
+	feeGrowth0 := new(big.Int).Div(new(big.Int).Mul(big.NewInt(4), constants.Q128), big.NewInt(3161000))
+	feeGrowth1 := new(big.Int).Div(new(big.Int).Mul(big.NewInt(5), constants.Q128), big.NewInt(3161000))
+	if p.FeeGrowthGlobal0X128.Cmp(feeGrowth0) != 0 || p.FeeGrowthGlobal1X128.Cmp(feeGrowth1) != 0 {
+		t.Errorf("Got fee growth %v, %v; want %v, %v", p.FeeGrowthGlobal0X128, p.FeeGrowthGlobal1X128, feeGrowth0, feeGrowth1)
+	}
+}
+
+func TestFlashErrors(t *testing.T) {
+	fmt.Println("Flash: Fails if the loan is not repaid with the fee, leaving the pool unchanged")
+	p := initializedPool()
+	if _, _, err := p.Flash("0xF", big.NewInt(1000), big.NewInt(0), repay(big.NewInt(1000), big.NewInt(0), big.NewInt(3), big.NewInt(0))); !errors.Is(err, ErrNoLiquidity) {
+		t.Errorf("Expected ErrNoLiquidity, got %v", err)
+	}
+	p.Mint("0xC", -887220, 887220, big.NewInt(3161000))
+	before := poolJSON(t, p)
+	if _, _, err := p.Flash("0xF", big.NewInt(1000), big.NewInt(1000), repay(big.NewInt(1000), big.NewInt(1000), big.NewInt(2), big.NewInt(3))); !errors.Is(err, ErrFlashNotRepaid) {
+		t.Errorf("Expected ErrFlashNotRepaid, got %v", err)
+	}
+	if _, _, err := p.Flash("0xF", big.NewInt(1000), big.NewInt(1000), repay(big.NewInt(1000), big.NewInt(1000), big.NewInt(3), big.NewInt(2))); !errors.Is(err, ErrFlashNotRepaid) {
+		t.Errorf("Expected ErrFlashNotRepaid, got %v", err)
+	}
+	callbackErr := errors.New("cannot repay")
+	_, _, err := p.Flash("0xF", big.NewInt(1000), big.NewInt(0), func(_ *Pool, _, _ *big.Int) (*big.Int, *big.Int, error) {
+		return nil, nil, callbackErr
+	})
+	if !errors.Is(err, callbackErr) {
+		t.Errorf("Expected the callback's error, got %v", err)
+	}
+	if poolJSON(t, p) != before {
+		t.Errorf("Expected the pool to be unchanged")
+	}
+}
+
+func TestFlashLocksPool(t *testing.T) {
+	fmt.Println("Flash: Locks the pool while the callback runs")
+	p := initializedPool()
+	p.Mint("0xC", -887220, 887220, big.NewInt(3161000))
+	var swapErr, mintErr error
+	var balance0 *big.Int
+	_, _, err := p.Flash("0xF", big.NewInt(1000), big.NewInt(0), func(p *Pool, fee0, fee1 *big.Int) (*big.Int, *big.Int, error) {
+		balance0 = p.Balance0
+		_, _, swapErr = p.Swap("0xF", "0xF", true, big.NewInt(100), big.NewInt(4295128740))
+		_, _, mintErr = p.Mint("0xF", -60, 60, big.NewInt(100))
+		return new(big.Int).Add(big.NewInt(1000), fee0), fee1, nil
+	})
+	if err != nil {
+		t.Fatalf("Flash failed: %v", err)
+	}
+	if !errors.Is(swapErr, ErrLocked) || !errors.Is(mintErr, ErrLocked) {
+		t.Errorf("Expected ErrLocked, got %v and %v", swapErr, mintErr)
+	}
+	if new(big.Int).Sub(p.Balance0, balance0).Cmp(big.NewInt(1003)) != 0 {
+		t.Errorf("Expected the borrowed amount to be sent before the callback")
+	}
+	if _, _, err := p.Swap("0xF", "0xF", true, big.NewInt(100), big.NewInt(4295128740)); err != nil {
+		t.Errorf("Expected the pool to be unlocked after the flash, got %v", err)
+	}
+}
+
+func TestCollectUpdatesBalances(t *testing.T) {
+	fmt.Println("Collect: Transfers the tokens owed out of the pool, which burning does not")
+	p := initializedPool()
+	amount0, amount1, _ := p.Mint("0xC", -120, 120, big.NewInt(1000000))
+	balance0, balance1 := p.Balance0, p.Balance1
+	if balance0.Cmp(amount0) != 0 || balance1.Cmp(amount1) != 0 {
+		t.Fatalf("Got balances %v, %v; want %v, %v", balance0, balance1, amount0, amount1)
+	}
+	burned0, burned1, err := p.Burn("0xC", -120, 120, big.NewInt(1000000))
+	if err != nil {
+		t.Fatalf("Burn failed: %v", err)
+	}
+	if p.Balance0.Cmp(balance0) != 0 || p.Balance1.Cmp(balance1) != 0 {
+		t.Errorf("Expected Burn not to change the balances, got %v, %v", p.Balance0, p.Balance1)
+	}
+	collected0, collected1, err := p.Collect("0xC", -120, 120, burned0, big.NewInt(0))
+	if err != nil || collected0.Cmp(burned0) != 0 || collected1.Cmp(big.NewInt(0)) != 0 {
+		t.Errorf("Got %v, %v, %v; want %v, 0, nil", collected0, collected1, err, burned0)
+	}
+	p.Collect("0xC", -120, 120, constants.MaxUint256, constants.MaxUint256)
+	expected0 := new(big.Int).Sub(balance0, burned0)
+	expected1 := new(big.Int).Sub(balance1, burned1)
+	if p.Balance0.Cmp(expected0) != 0 || p.Balance1.Cmp(expected1) != 0 {
+		t.Errorf("Got balances %v, %v; want %v, %v", p.Balance0, p.Balance1, expected0, expected1)
+	}
+	position, _ := p.Position(PositionKey{"0xC", -120, 120})
+	if position.TokensOwed0.Cmp(big.NewInt(0)) != 0 || position.TokensOwed1.Cmp(big.NewInt(0)) != 0 {
+		t.Errorf("Expected no tokens owed, got %v, %v", position.TokensOwed0, position.TokensOwed1)
+	}
+}
+
+func TestPositionKeyHash(t *testing.T) {
+	fmt.Println("PositionKey.Hash: Hashes the owner and the ticks as int24s, as abi.encodePacked does")
+	// keccak256 of 0x0000000000000000000000000000000000000001ffffc400003c,
+	// computed with an independent implementation.
+	want := "0x20583517fe7579aefdc2b22daea49e921883f452382851118a7b4eb9286501db"
+	for _, owner := range []string{"0x0000000000000000000000000000000000000001", "0x1", "0X01"} {
+		hash, err := PositionKey{owner, -60, 60}.Hash()
+		if err != nil || hash != want {
+			t.Errorf("Got %v, %v for owner %s; want %v, nil", hash, err, owner, want)
+		}
+	}
+	// A full range position of the nonfungible position manager.
+	want = "0x381aa6c2062f30ec4294109119a35ae6c664cb629c3c1fad6610316d27488a48"
+	if hash, err := (PositionKey{"0xC36442b4a4522E871399CD717aBDD847Ab11FE88", -887220, 887220}).Hash(); err != nil || hash != want {
+		t.Errorf("Got %v, %v; want %v, nil", hash, err, want)
+	}
+	if _, err := (PositionKey{"0xZ", -60, 60}).Hash(); !errors.Is(err, ErrInvalidPositionKey) {
+		t.Errorf("Expected ErrInvalidPositionKey, got %v", err)
+	}
+}
+
+func TestParseLegacyPositionKey(t *testing.T) {
+	fmt.Println("ParseLegacyPositionKey: Splits the ticks into the only valid tick range")
+	owner := "0xC36442b4a4522E871399CD717aBDD847Ab11FE88"
+	key, err := ParseLegacyPositionKey(owner+"254700260340", 60)
+	if err != nil || key != (PositionKey{owner, 254700, 260340}) {
+		t.Errorf("Got %+v, %v; want {%s 254700 260340}, nil", key, err, owner)
+	}
+	key, err = ParseLegacyPositionKey(owner+"-887220887220", 60)
+	if err != nil || key != (PositionKey{owner, -887220, 887220}) {
+		t.Errorf("Got %+v, %v; want {%s -887220 887220}, nil", key, err, owner)
+	}
+	// With a tick spacing of 1, -1,20 and -12,0 are not the only valid ranges.
+	if _, err = ParseLegacyPositionKey(owner+"-120", 1); !errors.Is(err, ErrInvalidPositionKey) {
+		t.Errorf("Expected ErrInvalidPositionKey for an ambiguous key, got %v", err)
+	}
+	if _, err = ParseLegacyPositionKey("0xC-6060", 60); !errors.Is(err, ErrInvalidPositionKey) {
+		t.Errorf("Expected ErrInvalidPositionKey for a key without an address, got %v", err)
+	}
+}
+
+func TestPoolTempToPoolPositionKeys(t *testing.T) {
+	fmt.Println("PoolTempToPool: Loads positions keyed by legacy key or by hash, with their owners")
+	p := initializedPool()
+	owner := "0xC36442b4a4522E871399CD717aBDD847Ab11FE88"
+	p.Mint(owner, -120, 120, big.NewInt(100))
+	p.Mint(owner, -60, 60, big.NewInt(100))
+	p.Mint("0x1", -60, 60, big.NewInt(100))
+	want := []PositionKey{{owner, -120, 120}, {owner, -60, 60}}
+	if keys := p.OwnerPositionKeys(strings.ToLower(owner)); !reflect.DeepEqual(keys, want) {
+		t.Errorf("Got %v; want %v", keys, want)
+	}
+
+	// A saved pool state is keyed by hash and includes the keys.
+	loaded, err := PoolTempToPool(PoolToPoolTemp(p))
+	if err != nil {
+		t.Fatalf("PoolTempToPool failed: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.PositionKeys(), p.PositionKeys()) {
+		t.Errorf("Got %v; want %v", loaded.PositionKeys(), p.PositionKeys())
+	}
+
+	// A pool state keyed by legacy key.
+	legacy := PoolToPoolTemp(p)
+	legacy.Positions = make(map[string]*position.Position)
+	legacy.PositionKeys = nil
+	for _, key := range p.PositionKeys() {
+		if key.Owner == owner {
+			pos, _ := p.Position(key)
+			legacy.Positions[key.Legacy()] = pos
+		}
+	}
+	loaded, err = PoolTempToPool(legacy)
+	if err != nil {
+		t.Fatalf("PoolTempToPool failed: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.PositionKeys(), want) {
+		t.Errorf("Got %v; want %v", loaded.PositionKeys(), want)
+	}
+	if _, _, err := loaded.Burn(owner, -120, 120, big.NewInt(100)); err != nil {
+		t.Errorf("Expected a position loaded by legacy key to be burnable, got %v", err)
+	}
+
+	legacy.Positions["0xC-6060"] = position.Make()
+	if _, err = PoolTempToPool(legacy); !errors.Is(err, ErrInvalidPositionKey) {
+		t.Errorf("Expected ErrInvalidPositionKey, got %v", err)
+	}
+}
+
+func TestSwapTrace(t *testing.T) {
+	fmt.Println("SetSwapTracer: Traces the steps and tick crossings of executed swaps")
+	p := initializedPool()
+	p.Mint("0xC", -887220, 887220, big.NewInt(3161))
+	p.Mint("0xD", -23100, -22980, big.NewInt(100000))
+	recorder := &SwapTraceRecorder{}
+	p.SetSwapTracer(recorder)
+	if _, err := p.ComputeSwap(true, big.NewInt(10000), big.NewInt(4295128740)); err != nil {
+		t.Fatalf("ComputeSwap failed: %v", err)
+	}
+	if len(recorder.Traces) != 0 {
+		t.Errorf("Expected computed swaps not to be traced")
+	}
+	amount0, amount1, err := p.Swap("0xE", "0xF", true, big.NewInt(10000), big.NewInt(4295128740))
+	if err != nil {
+		t.Fatalf("Swap failed: %v", err)
+	}
+	if len(recorder.Traces) != 1 {
+		t.Fatalf("Got %d traces; want 1", len(recorder.Traces))
+	}
+	trace := recorder.Traces[0]
+	if trace.Amount0.Cmp(amount0) != 0 || trace.Amount1.Cmp(amount1) != 0 || trace.TickAfter != p.Slot0.Tick {
+		t.Errorf("Expected the trace to match the swap")
+	}
+	if len(trace.Crossings) != 1 || trace.Crossings[0].Tick != -23100 || trace.Crossings[0].LiquidityNet.Cmp(big.NewInt(100000)) != 0 {
+		t.Fatalf("Got crossings %+v; want tick -23100 with liquidityNet 100000", trace.Crossings)
+	}
+	amountIn, amountOut := big.NewInt(0), big.NewInt(0)
+	crossed := 0
+	for i, step := range trace.Steps {
+		amountIn.Add(amountIn, new(big.Int).Add(step.AmountIn, step.FeeAmount))
+		amountOut.Add(amountOut, step.AmountOut)
+		if i > 0 && step.SqrtPriceStartX96.Cmp(trace.Steps[i-1].SqrtPriceEndX96) != 0 {
+			t.Errorf("Expected step %d to start where step %d ended", i, i-1)
+		}
+		if step.LiquidityBefore.Cmp(step.LiquidityAfter) != 0 {
+			crossed++
+			// Crossing -23100 from right to left removes the position's
+			// liquidity.
+			if step.TickNext != -23100 || new(big.Int).Sub(step.LiquidityBefore, step.LiquidityAfter).Cmp(big.NewInt(100000)) != 0 {
+				t.Errorf("Got liquidity %v to %v at tick %d; want a decrease of 100000 at -23100", step.LiquidityBefore, step.LiquidityAfter, step.TickNext)
+			}
+		}
+	}
+	if crossed != 1 {
+		t.Errorf("Got %d steps that changed liquidity; want 1", crossed)
+	}
+	if amountIn.Cmp(amount0) != 0 || amountOut.Cmp(new(big.Int).Neg(amount1)) != 0 {
+		t.Errorf("Got %v in, %v out over the steps; want %v, %v", amountIn, amountOut, amount0, new(big.Int).Neg(amount1))
+	}
+	p.SetSwapTracer(nil)
+	p.Swap("0xE", "0xF", false, big.NewInt(10000), new(big.Int).Sub(constants.MaxSqrtRatio, big.NewInt(1)))
+	if len(recorder.Traces) != 1 {
+		t.Errorf("Expected no trace after the tracer is removed")
+	}
+}
+
+func TestObserveErrors(t *testing.T) {
+	fmt.Println("Observe: Returns an error for a time before the oldest observation or too high a cardinality")
+	p := initializedPool()
+	p.SetBlockTimestamp(10)
+	if _, _, err := p.Observe([]uint32{10, 0}); err != nil {
+		t.Errorf("Expected observing the oldest observation to succeed, got %v", err)
+	}
+	if _, _, err := p.Observe([]uint32{11, 0}); !errors.Is(err, oracle.ErrObservationTooOld) {
+		t.Errorf("Expected oracle.ErrObservationTooOld, got %v", err)
+	}
+	if err := p.IncreaseObservationCardinalityNext(oracle.MaxCardinality + 1); !errors.Is(err, oracle.ErrCardinalityTooHigh) {
+		t.Errorf("Expected oracle.ErrCardinalityTooHigh, got %v", err)
+	}
+	if p.Slot0.ObservationCardinalityNext != 1 {
+		t.Errorf("Got cardinality next %d; want 1", p.Slot0.ObservationCardinalityNext)
+	}
+	if err := Make("0xA", "0xB", 3000, 60).IncreaseObservationCardinalityNext(2); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("Expected ErrNotInitialized, got %v", err)
+	}
+}
+
+func TestDiffOracleFields(t *testing.T) {
+	fmt.Println("Diff: Reports differences in the oracle fields of ticks and in the observations")
+	p := poolWithPositions(t)
+	changePool(t, p)
+	q := p.Clone()
+	if differences := Diff(p, q, &Tolerances{}); len(differences) != 0 {
+		t.Fatalf("Got differences %+v; want none", differences)
+	}
+
+	crossed := q.Ticks.TickData[-23100]
+	crossed.TickCumulativeOutside += 7
+	crossed.SecondsPerLiquidityOutsideX128 = new(big.Int).Add(crossed.SecondsPerLiquidityOutsideX128, big.NewInt(1))
+	crossed.SecondsOutside += 5
+	q.Observations[1].TickCumulative += 3
+	q.Observations = append(q.Observations, oracle.Observation{BlockTimestamp: 100, SecondsPerLiquidityCumulativeX128: big.NewInt(0), Initialized: true})
+	last := len(q.Observations) - 1
+	expected := []string{
+		"observations.1.tickCumulative",
+		fmt.Sprintf("observations.%d.blockTimestamp", last),
+		fmt.Sprintf("observations.%d.initialized", last),
+		"ticks.-23100.secondsOutside",
+		"ticks.-23100.secondsPerLiquidityOutsideX128",
+		"ticks.-23100.tickCumulativeOutside",
+	}
+	var fields []string
+	for _, difference := range Diff(p, q, &Tolerances{}) {
+		fields = append(fields, difference.Field)
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Got differences in %q; want %q", fields, expected)
+	}
+}
+
+func TestDiffTolerances(t *testing.T) {
+	fmt.Println("Diff: Only reports differences that exceed the tolerance for the field's longest prefix")
+	p := poolWithPositions(t)
+	q := p.Clone()
+	q.Balance0 = new(big.Int).Add(q.Balance0, big.NewInt(100))
+	q.Liquidity = new(big.Int).Add(q.Liquidity, big.NewInt(1))
+
+	expected := []Difference{
+		{Field: "balance0", A: p.Balance0.String(), B: q.Balance0.String(), RelativeError: diffRelativeError(p.Balance0, 100)},
+		{Field: "liquidity", A: p.Liquidity.String(), B: q.Liquidity.String(), RelativeError: diffRelativeError(p.Liquidity, 1)},
+	}
+	if differences := Diff(p, q, &Tolerances{}); !reflect.DeepEqual(differences, expected) {
+		t.Errorf("Got %+v; want %+v", differences, expected)
+	}
+
+	tests := []struct {
+		tolerances *Tolerances
+		fields     []string
+	}{
+		// A difference is reported if it exceeds both tolerances.
+		{&Tolerances{Default: Tolerance{Absolute: big.NewInt(100)}}, nil},
+		{&Tolerances{Default: Tolerance{Relative: 1}}, nil},
+		{&Tolerances{Default: Tolerance{Absolute: big.NewInt(99)}}, []string{"balance0"}},
+		// The tolerance of the longest matching prefix is used.
+		{&Tolerances{Fields: map[string]Tolerance{"balance": {Absolute: big.NewInt(1000)}}}, []string{"liquidity"}},
+		{&Tolerances{Default: Tolerance{Absolute: big.NewInt(1000)}, Fields: map[string]Tolerance{"balance": {Absolute: big.NewInt(1000)}, "balance0": {}}}, []string{"balance0"}},
+	}
+	for _, test := range tests {
+		var fields []string
+		for _, difference := range Diff(p, q, test.tolerances) {
+			fields = append(fields, difference.Field)
+		}
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("Tolerances %+v: Got differences in %q; want %q", test.tolerances, fields, test.fields)
+		}
+	}
+}
+
+// Returns difference / |a|, the relative error Diff reports for a field that
+// differs by difference.
+func diffRelativeError(a *big.Int, difference int64) float64 {
+	relativeError, _ := new(big.Float).Quo(new(big.Float).SetInt64(difference), new(big.Float).SetInt(new(big.Int).Abs(a))).Float64()
+	return relativeError
+}
+
+func TestDiffOneSided(t *testing.T) {
+	fmt.Println("Diff: Compares a tick or position present in only one pool state with an empty one")
+	p := poolWithPositions(t)
+	q := p.Clone()
+	q.Ticks.TickData[120] = &tick.Tick{
+		LiquidityGross:                 big.NewInt(5),
+		LiquidityNet:                   big.NewInt(5),
+		FeeGrowthOutside0X128:          big.NewInt(0),
+		FeeGrowthOutside1X128:          big.NewInt(0),
+		SecondsPerLiquidityOutsideX128: big.NewInt(0),
+		Initialized:                    true,
+	}
+	key, err := PositionKey{Owner: "0xD", TickLower: -23100, TickUpper: -22980}.Hash()
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+	delete(q.Positions, key)
+
+	expected := []Difference{
+		{Field: "positions." + key + ".liquidity", A: "100000", B: "0", RelativeError: 1},
+		{Field: "ticks.120.initialized", A: "false", B: "true"},
+		{Field: "ticks.120.liquidityGross", A: "0", B: "5", RelativeError: 5},
+		{Field: "ticks.120.liquidityNet", A: "0", B: "5", RelativeError: 5},
+	}
+	if differences := Diff(p, q, &Tolerances{}); !reflect.DeepEqual(differences, expected) {
+		t.Errorf("Got %+v; want %+v", differences, expected)
+	}
+}
+
+func TestSeedOracle(t *testing.T) {
+	fmt.Println("SetBlockTimestamp: Seeds a pool loaded without observations at its observation index")
+	tests := []struct {
+		index, cardinality, cardinalityNext int
+	}{
+		{0, 1, 1},
+		{3, 5, 5},
+		{1, 2, 4},
+	}
+	for _, test := range tests {
+		p := initializedPool()
+		p.Observations = nil
+		p.Slot0.ObservationIndex = test.index
+		p.Slot0.ObservationCardinality = test.cardinality
+		p.Slot0.ObservationCardinalityNext = test.cardinalityNext
+		p.SetBlockTimestamp(100)
+		if len(p.Observations) != test.cardinalityNext {
+			t.Errorf("%+v: Got %d observations; want %d", test, len(p.Observations), test.cardinalityNext)
+			continue
+		}
+		for i, observation := range p.Observations {
+			if observation.Initialized != (i == test.index) {
+				t.Errorf("%+v: Expected only observation %d to be initialized, got %+v at %d", test, test.index, observation, i)
+			}
+		}
+		if seed := p.Observations[test.index]; seed.BlockTimestamp != 99 {
+			t.Errorf("%+v: Got seed at %d; want 99", test, seed.BlockTimestamp)
+		}
+		if _, _, err := p.Observe([]uint32{1, 0}); err != nil {
+			t.Errorf("%+v: Observe failed: %v", test, err)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package pool
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/position"
+	"golang.org/x/crypto/sha3"
+)
+
+// PositionKey identifies a position by its owner and tick range.
+type PositionKey struct {
+	Owner     string `json:"owner"`
+	TickLower int    `json:"tickLower"`
+	TickUpper int    `json:"tickUpper"`
+}
+
+// Returns the owner's address as 20 bytes. Addresses shorter than 20 bytes
+// are padded on the left, as when an address literal is cast in Solidity.
+func ownerBytes(owner string) ([]byte, error) {
+	digits := strings.TrimPrefix(strings.TrimPrefix(owner, "0x"), "0X")
+	if len(digits) > 40 {
+		return nil, fmt.Errorf("pool.PositionKey: %w (owner %q is longer than an address)", ErrInvalidPositionKey, owner)
+	}
+	digits = strings.Repeat("0", 40-len(digits)) + digits
+	address, err := hex.DecodeString(digits)
+	if err != nil {
+		return nil, fmt.Errorf("pool.PositionKey: %w (owner %q is not a hex address)", ErrInvalidPositionKey, owner)
+	}
+	return address, nil
+}
+
+// Hash returns the key of the position in the deployed contract, i.e.
+// keccak256(abi.encodePacked(owner, tickLower, tickUpper)), as a 0x prefixed
+// hex string. The pool's positions are keyed by this hash.
+//
+// Returns:
+// hash -- The hash of the position key
+// err  -- ErrInvalidPositionKey if the owner is not a hex address
+func (k PositionKey) Hash() (string, error) {
+	address, err := ownerBytes(k.Owner)
+	if err != nil {
+		return "", err
+	}
+	// The ticks are int24s, i.e. the last 3 bytes of their two's complement
+	// representation.
+	packed := make([]byte, 0, 26)
+	packed = append(packed, address...)
+	for _, tickIdx := range []int{k.TickLower, k.TickUpper} {
+		var word [4]byte
+		binary.BigEndian.PutUint32(word[:], uint32(int32(tickIdx)))
+		packed = append(packed, word[1:]...)
+	}
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(packed)
+	return "0x" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Legacy returns the key that was used for the position before positions
+// were keyed by their hash, i.e. the owner's address followed by tickLower and
+// tickUpper. Pool states saved in this format can still be loaded (see
+// PoolTempToPool).
+func (k PositionKey) Legacy() string {
+	return fmt.Sprintf("%s%d%d", k.Owner, k.TickLower, k.TickUpper)
+}
+
+// Returns true iff the key is a position hash (see PositionKey.Hash) rather
+// than a legacy key.
+func isPositionHash(key string) bool {
+	if len(key) != 66 || !strings.HasPrefix(key, "0x") {
+		return false
+	}
+	_, err := hex.DecodeString(key[2:])
+	return err == nil
+}
+
+// Parses a tick from a legacy key, which must be formatted as by
+// strconv.Itoa (i.e. without leading zeros) so that the split between the
+// ticks is unambiguous.
+func parseLegacyTick(s string) (int, bool) {
+	tickIdx, err := strconv.Atoi(s)
+	if err != nil || strconv.Itoa(tickIdx) != s {
+		return 0, false
+	}
+	return tickIdx, true
+}
+
+// ParseLegacyPositionKey parses a legacy position key (see
+// PositionKey.Legacy) whose owner is a 0x prefixed, 20 byte address. As the
+// ticks are not delimited, the key is split into a tick range that is valid
+// for the given tick spacing, i.e. with tickLower < tickUpper, both within
+// the minimum and maximum ticks and both multiples of the tick spacing.
+//
+// Arguments:
+// key         -- The legacy key
+// tickSpacing -- The tick spacing of the pool the position belongs to
+//
+// Returns:
+// positionKey -- The position key
+// err         -- ErrInvalidPositionKey if the key does not have exactly one
+//                valid tick range
+func ParseLegacyPositionKey(key string, tickSpacing int) (PositionKey, error) {
+	if len(key) < 42 || !strings.HasPrefix(key, "0x") {
+		return PositionKey{}, fmt.Errorf("pool.ParseLegacyPositionKey: %w (%q does not start with an address)", ErrInvalidPositionKey, key)
+	}
+	owner, ticks := key[:42], key[42:]
+	if _, err := hex.DecodeString(owner[2:]); err != nil {
+		return PositionKey{}, fmt.Errorf("pool.ParseLegacyPositionKey: %w (%q does not start with an address)", ErrInvalidPositionKey, key)
+	}
+	var candidates []PositionKey
+	for i := 1; i < len(ticks); i++ {
+		tickLower, okLower := parseLegacyTick(ticks[:i])
+		tickUpper, okUpper := parseLegacyTick(ticks[i:])
+		if !okLower || !okUpper || checkTicks(tickLower, tickUpper) != nil {
+			continue
+		}
+		if tickSpacing > 0 && (tickLower%tickSpacing != 0 || tickUpper%tickSpacing != 0) {
+			continue
+		}
+		candidates = append(candidates, PositionKey{Owner: owner, TickLower: tickLower, TickUpper: tickUpper})
+	}
+	if len(candidates) != 1 {
+		return PositionKey{}, fmt.Errorf("pool.ParseLegacyPositionKey: %w (%q has %d valid tick ranges)", ErrInvalidPositionKey, key, len(candidates))
+	}
+	return candidates[0], nil
+}
+
+// Records the key of the position with the given hash in the pool's index,
+// so that the position can be listed by owner.
+func (p *Pool) indexPosition(hash string, key PositionKey) {
+	if p.positionKeys == nil {
+		p.positionKeys = make(map[string]PositionKey)
+	}
+	if _, found := p.positionKeys[hash]; found {
+		return
+	}
+	if len(p.snapshots) > 0 {
+		p.snapshots[len(p.snapshots)-1].positionKeys[hash] = true
+	}
+	p.positionKeys[hash] = key
+}
+
+// Converts the positions of a pool state, which may be keyed by hash or by
+// legacy key, into positions keyed by hash and an index of their keys.
+// Positions keyed by hash are only indexed if their key is in the given keys.
+func loadPositions(positions map[string]*position.Position, keys map[string]PositionKey, tickSpacing int) (map[string]*position.Position, map[string]PositionKey, error) {
+	loaded := make(map[string]*position.Position, len(positions))
+	index := make(map[string]PositionKey, len(positions))
+	for key, pos := range positions {
+		hash := strings.ToLower(key)
+		if isPositionHash(hash) {
+			if positionKey, found := keys[key]; found {
+				index[hash] = positionKey
+			}
+		} else {
+			positionKey, err := ParseLegacyPositionKey(key, tickSpacing)
+			if err != nil {
+				return nil, nil, err
+			}
+			if hash, err = positionKey.Hash(); err != nil {
+				return nil, nil, err
+			}
+			index[hash] = positionKey
+		}
+		if _, found := loaded[hash]; found {
+			return nil, nil, fmt.Errorf("pool.PoolTempToPool: %w (position %q is given more than once)", ErrInvalidPositionKey, key)
+		}
+		loaded[hash] = pos
+	}
+	return loaded, index, nil
+}
+
+// Returns the position with the given key.
+//
+// Arguments:
+// key      -- The position's key
+//
+// Returns:
+// position -- The position, or nil if it does not exist
+// found    -- True iff the position exists
+func (p *Pool) Position(key PositionKey) (*position.Position, bool) {
+	hash, err := key.Hash()
+	if err != nil {
+		return nil, false
+	}
+	pos, found := p.Positions[hash]
+	return pos, found
+}
+
+// Returns the keys of the pool's positions, sorted by owner and tick range.
+// Positions that were loaded by hash and have not been modified since are not
+// included, as their owner and tick range are unknown.
+func (p *Pool) PositionKeys() []PositionKey {
+	keys := make([]PositionKey, 0, len(p.positionKeys))
+	for hash, key := range p.positionKeys {
+		if _, found := p.Positions[hash]; found {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Owner != keys[j].Owner {
+			return keys[i].Owner < keys[j].Owner
+		}
+		if keys[i].TickLower != keys[j].TickLower {
+			return keys[i].TickLower < keys[j].TickLower
+		}
+		return keys[i].TickUpper < keys[j].TickUpper
+	})
+	return keys
+}
+
+// Returns the keys of the positions owned by the given address, sorted by
+// tick range (see PositionKeys). Addresses are compared case-insensitively.
+func (p *Pool) OwnerPositionKeys(owner string) []PositionKey {
+	var keys []PositionKey
+	for _, key := range p.PositionKeys() {
+		if strings.EqualFold(key.Owner, owner) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,82 @@
+package pool
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Returns true iff the protocol fee denominator is valid, i.e. 0 (no protocol
+// fee) or between 4 and 10.
+func validFeeProtocol(feeProtocol int) bool {
+	return feeProtocol == 0 || (feeProtocol >= 4 && feeProtocol <= 10)
+}
+
+// Sets the denominator of the protocol's % share of the fees. In the deployed
+// contract this can only be called by the factory owner.
+//
+// Arguments:
+// feeProtocol0 -- New protocol fee for token0 of the pool
+// feeProtocol1 -- New protocol fee for token1 of the pool
+//
+// Returns:
+// err          -- ErrInvalidFeeProtocol if either fee is invalid, or an error
+//                 if the pool cannot be called (see checkLock)
+func (p *Pool) SetFeeProtocol(feeProtocol0, feeProtocol1 int) error {
+	if err := p.checkLock(); err != nil {
+		return fmt.Errorf("pool.SetFeeProtocol: %w", err)
+	}
+	if !validFeeProtocol(feeProtocol0) || !validFeeProtocol(feeProtocol1) {
+		return fmt.Errorf("pool.SetFeeProtocol: %w (got %d and %d)", ErrInvalidFeeProtocol, feeProtocol0, feeProtocol1)
+	}
+	p.Slot0.FeeProtocol = feeProtocol0 + (feeProtocol1 << 4)
+	return nil
+}
+
+// Collects the protocol fee accrued to the pool. In the deployed contract
+// this can only be called by the factory owner. As in the deployed contract,
+// one wei of each token is always left in the protocol fees (so that the
+// storage slot is not cleared, for gas savings).
+//
+// Arguments:
+// recipient        -- The address to which collected protocol fees should be
+//                     sent
+// amount0Requested -- The maximum amount of token0 to send, can be 0 to
+//                     collect fees in only token1
+// amount1Requested -- The maximum amount of token1 to send, can be 0 to
+//                     collect fees in only token0
+//
+// Returns:
+// amount0          -- The protocol fee collected in token0
+// amount1          -- The protocol fee collected in token1
+// err              -- An error if the pool cannot be called (see checkLock)
+func (p *Pool) CollectProtocol(recipient string, amount0Requested, amount1Requested *big.Int) (amount0, amount1 *big.Int, err error) {
+	if err := p.checkLock(); err != nil {
+		return nil, nil, fmt.Errorf("pool.CollectProtocol: %w", err)
+	}
+	amount0 = new(big.Int).Set(amount0Requested)
+	if amount0Requested.Cmp(p.ProtocolFees.Token0) >= 1 {
+		amount0.Set(p.ProtocolFees.Token0)
+	}
+	amount1 = new(big.Int).Set(amount1Requested)
+	if amount1Requested.Cmp(p.ProtocolFees.Token1) >= 1 {
+		amount1.Set(p.ProtocolFees.Token1)
+	}
+
+	if amount0.Cmp(big.NewInt(0)) >= 1 {
+		// Ensure that the slot is not cleared, for gas savings.
+		if amount0.Cmp(p.ProtocolFees.Token0) == 0 {
+			amount0.Sub(amount0, big.NewInt(1))
+		}
+		p.ProtocolFees.Token0 = new(big.Int).Sub(p.ProtocolFees.Token0, amount0)
+		p.Balance0 = new(big.Int).Sub(p.Balance0, amount0)
+	}
+	if amount1.Cmp(big.NewInt(0)) >= 1 {
+		// Ensure that the slot is not cleared, for gas savings.
+		if amount1.Cmp(p.ProtocolFees.Token1) == 0 {
+			amount1.Sub(amount1, big.NewInt(1))
+		}
+		p.ProtocolFees.Token1 = new(big.Int).Sub(p.ProtocolFees.Token1, amount1)
+		p.Balance1 = new(big.Int).Sub(p.Balance1, amount1)
+	}
+	return
+}
@@ -0,0 +1,322 @@
+package pool
+
+import (
+	"math/big"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/oracle"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/position"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/tick"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/tickBitmap"
+)
+
+// Returns a copy of x, or nil if x is nil.
+func copyInt(x *big.Int) *big.Int {
+	if x == nil {
+		return nil
+	}
+	return new(big.Int).Set(x)
+}
+
+// Returns a copy of slot0.
+func (s *Slot0) copy() *Slot0 {
+	slot0 := *s
+	slot0.SqrtPriceX96 = copyInt(s.SqrtPriceX96)
+	return &slot0
+}
+
+// Returns a copy of the protocol fees.
+func (f *ProtocolFees) copy() *ProtocolFees {
+	return &ProtocolFees{
+		Token0: copyInt(f.Token0),
+		Token1: copyInt(f.Token1),
+	}
+}
+
+// Clone returns a deep copy of the pool. The clone shares no state (maps,
+// slices or big.Ints) with the pool, so either can be modified without
+// affecting the other. Snapshots of the pool are not cloned.
+//
+// Returns:
+// The clone
+func (p *Pool) Clone() *Pool {
+	positions := make(map[string]*position.Position, len(p.Positions))
+	for key, pos := range p.Positions {
+		positions[key] = pos.Copy()
+	}
+	positionKeys := make(map[string]PositionKey, len(p.positionKeys))
+	for hash, key := range p.positionKeys {
+		positionKeys[hash] = key
+	}
+	return &Pool{
+		Token0:               p.Token0,
+		Token1:               p.Token1,
+		Fee:                  p.Fee,
+		TickSpacing:          p.TickSpacing,
+		MaxLiquidityPerTick:  copyInt(p.MaxLiquidityPerTick),
+		Slot0:                p.Slot0.copy(),
+		FeeGrowthGlobal0X128: copyInt(p.FeeGrowthGlobal0X128),
+		FeeGrowthGlobal1X128: copyInt(p.FeeGrowthGlobal1X128),
+		ProtocolFees:         p.ProtocolFees.copy(),
+		Liquidity:            copyInt(p.Liquidity),
+		Ticks:                p.Ticks.Copy(),
+		TickBitmap:           p.TickBitmap.Copy(),
+		Positions:            positions,
+		Balance0:             copyInt(p.Balance0),
+		Balance1:             copyInt(p.Balance1),
+		Observations:         p.Observations.Copy(),
+		BlockTimestamp:       p.BlockTimestamp,
+		positionKeys:         positionKeys,
+	}
+}
+
+// Snapshot records the state of a pool so that it can be restored later (see
+// Pool.Snapshot). The pool's ticks, tick bitmap words, positions and
+// observations are copied on write, i.e. a snapshot only stores the ones
+// that have been changed since it was taken, so taking a snapshot does not
+// copy them.
+type Snapshot struct {
+	// The pool's state, other than the state that is copied on write, when
+	// the snapshot was taken. None of the big.Ints are modified in place, so
+	// they are not copied.
+	slot0                Slot0
+	feeGrowthGlobal0X128 *big.Int
+	feeGrowthGlobal1X128 *big.Int
+	protocolFees         ProtocolFees
+	liquidity            *big.Int
+	balance0             *big.Int
+	balance1             *big.Int
+	blockTimestamp       int
+	// The pool's observations when the snapshot was taken. The slice shares
+	// its array with the pool's, so the observations that have since been
+	// changed are stored in changedObservations.
+	observations oracle.Observations
+	// The ticks, tick bitmap words, positions and observations as they were
+	// when the snapshot was taken, for each one that has since been changed.
+	// Nil if the tick, word or position did not exist.
+	ticks               map[int]*tick.Tick
+	tickBitmap          map[int]*big.Int
+	positions           map[string]*position.Position
+	changedObservations map[int]oracle.Observation
+	// The hashes of the position keys that have been indexed since the
+	// snapshot was taken.
+	positionKeys map[string]bool
+}
+
+// Snapshot records the current state of the pool, so that any changes made
+// to the pool afterwards (e.g. to evaluate a swap or the value of a position
+// after burning it) can be undone with Restore. Snapshots can be nested.
+// Changes are recorded until the snapshot is restored or discarded, so a
+// snapshot that is no longer needed should be discarded (see Discard).
+//
+// Ticks and positions are copied on write, so pointers to ticks and positions
+// obtained from the pool before they are changed refer to the state recorded
+// in the snapshot, not to the pool's current state.
+//
+// Returns:
+// The snapshot
+func (p *Pool) Snapshot() *Snapshot {
+	s := &Snapshot{
+		slot0:                *p.Slot0,
+		feeGrowthGlobal0X128: p.FeeGrowthGlobal0X128,
+		feeGrowthGlobal1X128: p.FeeGrowthGlobal1X128,
+		protocolFees:         *p.ProtocolFees,
+		liquidity:            p.Liquidity,
+		balance0:             p.Balance0,
+		balance1:             p.Balance1,
+		blockTimestamp:       p.BlockTimestamp,
+		observations:         p.Observations,
+	}
+	s.clearChanges()
+	p.snapshots = append(p.snapshots, s)
+	return s
+}
+
+// Forgets the changes recorded by the snapshot, i.e. the pool's state is
+// taken to be the state the snapshot records.
+func (s *Snapshot) clearChanges() {
+	s.ticks = make(map[int]*tick.Tick)
+	s.tickBitmap = make(map[int]*big.Int)
+	s.positions = make(map[string]*position.Position)
+	s.changedObservations = make(map[int]oracle.Observation)
+	s.positionKeys = make(map[string]bool)
+}
+
+// Restore restores the pool to the state it was in when the snapshot was
+// taken. Snapshots taken after s are discarded, s itself can be restored
+// again.
+//
+// Arguments:
+// s -- A snapshot of the pool that has not been discarded
+func (p *Pool) Restore(s *Snapshot) {
+	i := p.snapshotIndex(s)
+	for j := len(p.snapshots) - 1; j >= i; j-- {
+		p.revert(p.snapshots[j])
+	}
+	p.snapshots = p.snapshots[:i+1]
+	s.clearChanges()
+}
+
+// Discard stops recording changes for the snapshot, and for any snapshots
+// taken after it, keeping the pool's current state. Snapshots taken before s
+// can still be restored.
+//
+// Arguments:
+// s -- A snapshot of the pool that has not been discarded
+func (p *Pool) Discard(s *Snapshot) {
+	i := p.snapshotIndex(s)
+	if i > 0 {
+		// The previous snapshot must be able to undo the changes recorded by
+		// the discarded snapshots.
+		previous := p.snapshots[i-1]
+		for _, discarded := range p.snapshots[i:] {
+			for tickIdx, tickInfo := range discarded.ticks {
+				if _, found := previous.ticks[tickIdx]; !found {
+					previous.ticks[tickIdx] = tickInfo
+				}
+			}
+			for wordPos, word := range discarded.tickBitmap {
+				if _, found := previous.tickBitmap[wordPos]; !found {
+					previous.tickBitmap[wordPos] = word
+				}
+			}
+			for key, pos := range discarded.positions {
+				if _, found := previous.positions[key]; !found {
+					previous.positions[key] = pos
+				}
+			}
+			// Observations beyond the previous snapshot's are removed when
+			// it is restored, so they need not be recorded.
+			for i, observation := range discarded.changedObservations {
+				if _, found := previous.changedObservations[i]; !found && i < len(previous.observations) {
+					previous.changedObservations[i] = observation
+				}
+			}
+			for hash := range discarded.positionKeys {
+				previous.positionKeys[hash] = true
+			}
+		}
+	}
+	p.snapshots = p.snapshots[:i]
+}
+
+// Returns the index of the snapshot in the pool's snapshots. Panics if the
+// snapshot was not taken of the pool or has been discarded.
+func (p *Pool) snapshotIndex(s *Snapshot) int {
+	for i, snapshot := range p.snapshots {
+		if snapshot == s {
+			return i
+		}
+	}
+	panic("pool.Snapshot: Snapshot was not taken of this pool or has been discarded")
+}
+
+// Undoes the changes recorded by the snapshot.
+func (p *Pool) revert(s *Snapshot) {
+	slot0 := s.slot0
+	p.Slot0 = &slot0
+	p.FeeGrowthGlobal0X128 = s.feeGrowthGlobal0X128
+	p.FeeGrowthGlobal1X128 = s.feeGrowthGlobal1X128
+	protocolFees := s.protocolFees
+	p.ProtocolFees = &protocolFees
+	p.Liquidity = s.liquidity
+	p.Balance0 = s.balance0
+	p.Balance1 = s.balance1
+	p.BlockTimestamp = s.blockTimestamp
+	p.Observations = s.observations
+	for i, observation := range s.changedObservations {
+		p.Observations[i] = observation
+	}
+	for wordPos, word := range s.tickBitmap {
+		if word == nil {
+			delete(p.TickBitmap.Words, wordPos)
+		} else {
+			p.TickBitmap.Words[wordPos] = word
+		}
+	}
+	for tickIdx, tickInfo := range s.ticks {
+		if tickInfo == nil {
+			delete(p.Ticks.TickData, tickIdx)
+		} else {
+			p.Ticks.TickData[tickIdx] = tickInfo
+		}
+	}
+	for key, pos := range s.positions {
+		if pos == nil {
+			delete(p.Positions, key)
+		} else {
+			p.Positions[key] = pos
+		}
+	}
+	for hash := range s.positionKeys {
+		delete(p.positionKeys, hash)
+	}
+}
+
+// Must be called before the tick at the given index is changed (or added or
+// removed). If a snapshot is being recorded and the tick has not changed
+// since it was taken, the tick is recorded in the snapshot and replaced in
+// the pool with a copy, which can then be changed.
+func (p *Pool) touchTick(tickIdx int) {
+	if len(p.snapshots) == 0 {
+		return
+	}
+	s := p.snapshots[len(p.snapshots)-1]
+	if _, found := s.ticks[tickIdx]; found {
+		return
+	}
+	tickInfo, found := p.Ticks.TickData[tickIdx]
+	if !found {
+		s.ticks[tickIdx] = nil
+		return
+	}
+	s.ticks[tickIdx] = tickInfo
+	p.Ticks.TickData[tickIdx] = tickInfo.Copy()
+}
+
+// Must be called before the position with the given key is changed (or
+// added). See touchTick.
+func (p *Pool) touchPosition(key string) {
+	if len(p.snapshots) == 0 {
+		return
+	}
+	s := p.snapshots[len(p.snapshots)-1]
+	if _, found := s.positions[key]; found {
+		return
+	}
+	pos, found := p.Positions[key]
+	if !found {
+		s.positions[key] = nil
+		return
+	}
+	s.positions[key] = pos
+	p.Positions[key] = pos.Copy()
+}
+
+// Must be called before the tick bitmap word in which the given tick's bit is
+// stored is changed. See touchTick. Words are not modified in place (see
+// tickBitmap.TickBitmap), so they are not copied.
+func (p *Pool) touchTickBitmap(tickIdx int) {
+	if len(p.snapshots) == 0 {
+		return
+	}
+	s := p.snapshots[len(p.snapshots)-1]
+	wordPos := tickBitmap.WordPos(tickIdx, p.TickSpacing)
+	if _, found := s.tickBitmap[wordPos]; found {
+		return
+	}
+	s.tickBitmap[wordPos] = p.TickBitmap.Words[wordPos]
+}
+
+// Must be called before the observation at the given index is overwritten.
+// Observations appended to the array (see oracle.Grow) need not be touched,
+// as the array is truncated to its length when the snapshot is restored.
+func (p *Pool) touchObservation(i int) {
+	if len(p.snapshots) == 0 {
+		return
+	}
+	s := p.snapshots[len(p.snapshots)-1]
+	if _, found := s.changedObservations[i]; found || i >= len(s.observations) {
+		return
+	}
+	s.changedObservations[i] = p.Observations[i]
+}
@@ -0,0 +1,96 @@
+package pool
+
+import "math/big"
+
+// SwapStepTrace records a step of a swap, i.e. a swap to the next initialized
+// tick (or to the end of a tick bitmap word), to the price limit or until the
+// amount specified is used up.
+type SwapStepTrace struct {
+	// The price and tick at the beginning and the end of the step.
+	SqrtPriceStartX96 *big.Int `json:"sqrtPriceStartX96"`
+	SqrtPriceEndX96   *big.Int `json:"sqrtPriceEndX96"`
+	TickStart         int      `json:"tickStart"`
+	TickEnd           int      `json:"tickEnd"`
+	// The next tick in the swap direction, the step's target (unless the
+	// price limit comes first), and whether it is initialized.
+	TickNext         int      `json:"tickNext"`
+	SqrtPriceNextX96 *big.Int `json:"sqrtPriceNextX96"`
+	Initialized      bool     `json:"initialized"`
+	// The amounts swapped in (excluding fees) and out in the step.
+	AmountIn  *big.Int `json:"amountIn"`
+	AmountOut *big.Int `json:"amountOut"`
+	// The fee paid to liquidity providers in range and to the protocol.
+	FeeAmount   *big.Int `json:"feeAmount"`
+	ProtocolFee *big.Int `json:"protocolFee"`
+	// The liquidity in range during the step and after it, which differ iff
+	// the step ends by crossing an initialized tick.
+	LiquidityBefore *big.Int `json:"liquidityBefore"`
+	LiquidityAfter  *big.Int `json:"liquidityAfter"`
+}
+
+// TickCrossTrace records an initialized tick crossed by a swap (see
+// tick.Ticks.Cross).
+type TickCrossTrace struct {
+	Tick int `json:"tick"`
+	// The tick's liquidityNet, i.e. the liquidity added when it is crossed
+	// from left to right (subtracted from right to left).
+	LiquidityNet *big.Int `json:"liquidityNet"`
+	// The tick's fee growth outside after it was crossed.
+	FeeGrowthOutside0X128 *big.Int `json:"feeGrowthOutside0X128"`
+	FeeGrowthOutside1X128 *big.Int `json:"feeGrowthOutside1X128"`
+}
+
+// SwapTrace records how a swap executed on a pool walked the liquidity curve.
+type SwapTrace struct {
+	// The swap's arguments (see Pool.Swap).
+	Sender            string   `json:"sender"`
+	Recipient         string   `json:"recipient"`
+	ZeroForOne        bool     `json:"zeroForOne"`
+	AmountSpecified   *big.Int `json:"amountSpecified"`
+	SqrtPriceLimitX96 *big.Int `json:"sqrtPriceLimitX96"`
+	// The delta of the balance of token0 and token1 of the pool.
+	Amount0 *big.Int `json:"amount0"`
+	Amount1 *big.Int `json:"amount1"`
+	// The price, tick and liquidity in range after the swap.
+	SqrtPriceX96After *big.Int `json:"sqrtPriceX96After"`
+	TickAfter         int      `json:"tickAfter"`
+	LiquidityAfter    *big.Int `json:"liquidityAfter"`
+	// The steps of the swap and the initialized ticks it crossed, in order.
+	Steps     []*SwapStepTrace  `json:"steps"`
+	Crossings []*TickCrossTrace `json:"crossings"`
+}
+
+// SwapTracer receives a trace of every swap executed on a pool (see
+// Pool.SetSwapTracer). Swaps that are only computed (see ComputeSwap) are not
+// traced.
+type SwapTracer interface {
+	TraceSwap(trace *SwapTrace)
+}
+
+// SwapTracerFunc is a function that can be used as a SwapTracer.
+type SwapTracerFunc func(trace *SwapTrace)
+
+// TraceSwap calls f(trace).
+func (f SwapTracerFunc) TraceSwap(trace *SwapTrace) {
+	f(trace)
+}
+
+// SwapTraceRecorder is a SwapTracer that keeps every trace it receives.
+type SwapTraceRecorder struct {
+	Traces []*SwapTrace
+}
+
+// TraceSwap appends the trace to the recorder's traces.
+func (r *SwapTraceRecorder) TraceSwap(trace *SwapTrace) {
+	r.Traces = append(r.Traces, trace)
+}
+
+// Sets the tracer that receives a trace of every swap executed on the pool.
+// Tracing is off by default, and can be turned off again by setting a nil
+// tracer.
+//
+// Arguments:
+// tracer -- The tracer, or nil
+func (p *Pool) SetSwapTracer(tracer SwapTracer) {
+	p.swapTracer = tracer
+}
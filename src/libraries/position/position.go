@@ -7,11 +7,25 @@
 package position
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
 
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/constants"
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/liquidityMath"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/logging"
+)
+
+// Logs position updates (subsystem "position", see the logging package).
+var logger = logging.Get("position")
+
+var (
+	// Returned by Update for a poke (a zero liquidity delta) of a position
+	// with no liquidity.
+	ErrNoLiquidity = errors.New("position has no liquidity")
+	// Returned by Update if more liquidity would be removed from a position
+	// than it holds.
+	ErrInsufficientLiquidity = errors.New("insufficient position liquidity")
 )
 
 // Position represents an owner address' liquidity between a lower and upper
@@ -29,7 +43,31 @@ type Position struct {
 	TokensOwed1 *big.Int
 }
 
-// Calculates and credits accumulated fees to a user's position.
+// Checks whether the position can be updated with the given liquidity delta,
+// i.e. returns ErrNoLiquidity for a poke (a zero liquidity delta) of a
+// position with no liquidity, ErrInsufficientLiquidity if more liquidity
+// would be removed than the position holds and nil otherwise.
+//
+// Arguments:
+// liquidityDelta -- The change in pool liquidity as a result of the position
+//                   update
+func (p *Position) CheckUpdate(liquidityDelta *big.Int) error {
+	if liquidityDelta.Cmp(big.NewInt(0)) == 0 {
+		// Disallow pokes for 0 liquidity positions.
+		if p.Liquidity.Cmp(big.NewInt(0)) <= 0 {
+			return fmt.Errorf("position.CheckUpdate: %w", ErrNoLiquidity)
+		}
+		return nil
+	}
+	if new(big.Int).Add(p.Liquidity, liquidityDelta).Cmp(big.NewInt(0)) <= -1 {
+		return fmt.Errorf("position.CheckUpdate: %w (liquidity %v, liquidity delta %v)", ErrInsufficientLiquidity, p.Liquidity, liquidityDelta)
+	}
+	return nil
+}
+
+// Calculates and credits accumulated fees to a user's position. Returns
+// ErrNoLiquidity or ErrInsufficientLiquidity (and leaves the position
+// unchanged) if the update is invalid.
 //
 // Arguments:
 // liquidityDelta       -- The change in pool liquidity as a result of the
@@ -38,12 +76,16 @@ type Position struct {
 //                         liquidity, inside the position's tick boundaries
 // feeGrowthInside1X128 -- The all-time fee growth in token1, per unit of
 //                         liquidity, inside the position's tick boundaries
-func (p *Position) Update(liquidityDelta, feeGrowthGlobal0X128, feeGrowthGlobal1X128 *big.Int) {
-	fmt.Println("Position.Update")
-	fmt.Printf("liquidityDelta: %v, feeGrowthGlobal0X128: %v, feeGrowthGlobal1X128: %v", liquidityDelta, feeGrowthGlobal0X128, feeGrowthGlobal1X128)
-	fmt.Println()
-	fmt.Printf("Position: %v", p)
-	fmt.Println()
+//
+// Returns:
+// err                  -- ErrNoLiquidity, ErrInsufficientLiquidity or nil
+func (p *Position) Update(liquidityDelta, feeGrowthGlobal0X128, feeGrowthGlobal1X128 *big.Int) error {
+	if logger.Enabled(logging.Debug) {
+		logger.Debug("update", logging.F("liquidity", p.Liquidity), logging.F("liquidityDelta", liquidityDelta), logging.F("feeGrowthInside0X128", feeGrowthGlobal0X128), logging.F("feeGrowthInside1X128", feeGrowthGlobal1X128))
+	}
+	if err := p.CheckUpdate(liquidityDelta); err != nil {
+		return err
+	}
 	liquidityNext := new(big.Int)
 	if liquidityDelta.Cmp(big.NewInt(0)) == 0 {
 		liquidityNext = p.Liquidity
@@ -65,6 +107,7 @@ func (p *Position) Update(liquidityDelta, feeGrowthGlobal0X128, feeGrowthGlobal1
 		p.TokensOwed0 = new(big.Int).Add(p.TokensOwed0, tokensOwed0)
 		p.TokensOwed1 = new(big.Int).Add(p.TokensOwed1, tokensOwed1)
 	}
+	return nil
 }
 
 // Make returns a new position struct.
@@ -77,3 +120,23 @@ func Make() *Position {
 		TokensOwed1:              big.NewInt(0),
 	}
 }
+
+// Returns a deep copy of the position, i.e. a position that shares no
+// big.Ints with the original.
+func (p *Position) Copy() *Position {
+	return &Position{
+		Liquidity:                copyInt(p.Liquidity),
+		FeeGrowthInside0LastX128: copyInt(p.FeeGrowthInside0LastX128),
+		FeeGrowthInside1LastX128: copyInt(p.FeeGrowthInside1LastX128),
+		TokensOwed0:              copyInt(p.TokensOwed0),
+		TokensOwed1:              copyInt(p.TokensOwed1),
+	}
+}
+
+// Returns a copy of x, or nil if x is nil.
+func copyInt(x *big.Int) *big.Int {
+	if x == nil {
+		return nil
+	}
+	return new(big.Int).Set(x)
+}
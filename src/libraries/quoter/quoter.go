@@ -0,0 +1,134 @@
+// Package quoter simulates the Uniswap V3 periphery Quoter.
+//
+// Quotes the result of a hypothetical swap against a pool without changing
+// the pool's state, e.g. to size a strategy's rebalancing swaps or to compute
+// the depth of a pool. Quotes are computed with the same swap loop as
+// pool.Swap (see pool.ComputeSwap), so a quote is exactly the result of the
+// swap if it were executed on the pool in its current state.
+package quoter
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/constants"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/pool"
+)
+
+// Returned by QuoteExactOutput if no price limit is given and the pool does
+// not have enough liquidity to provide the full amount out.
+var ErrInsufficientLiquidity = errors.New("insufficient liquidity for amount out")
+
+// The result of a hypothetical swap.
+type Quote struct {
+	// The amount of the input token that the swap takes, including fees.
+	AmountIn *big.Int
+	// The amount of the output token that the swap gives.
+	AmountOut *big.Int
+	// The price and tick of the pool after the swap.
+	SqrtPriceX96After *big.Int
+	TickAfter         int
+	// The initialized ticks crossed by the swap, in the order they are
+	// crossed.
+	InitializedTicksCrossed []int
+	// The fee paid in the input token, including the protocol fee.
+	FeeAmount *big.Int
+	// The part of the fee paid to the protocol.
+	ProtocolFee *big.Int
+}
+
+// Returns the given price limit, or the least restrictive valid price limit
+// for a swap in the given direction if it is nil or zero (as in the periphery
+// Quoter).
+func priceLimit(zeroForOne bool, sqrtPriceLimitX96 *big.Int) *big.Int {
+	if sqrtPriceLimitX96 != nil && sqrtPriceLimitX96.Cmp(big.NewInt(0)) != 0 {
+		return sqrtPriceLimitX96
+	}
+	if zeroForOne {
+		return new(big.Int).Add(constants.MinSqrtRatioBig, big.NewInt(1))
+	}
+	return new(big.Int).Sub(constants.MaxSqrtRatio, big.NewInt(1))
+}
+
+// Computes the quote for a swap with the given amount specified (positive for
+// exact input, negative for exact output).
+func quote(p *pool.Pool, zeroForOne bool, amountSpecified, sqrtPriceLimitX96 *big.Int) (*Quote, error) {
+	result, err := p.ComputeSwap(zeroForOne, amountSpecified, priceLimit(zeroForOne, sqrtPriceLimitX96))
+	if err != nil {
+		return nil, err
+	}
+	// The pool's deltas are positive for the token it receives and negative
+	// for the token it gives.
+	amountIn, amountOut := result.Amount1, new(big.Int).Neg(result.Amount0)
+	if zeroForOne {
+		amountIn, amountOut = result.Amount0, new(big.Int).Neg(result.Amount1)
+	}
+	feeAmount := new(big.Int).Set(result.ProtocolFee)
+	for _, step := range result.Steps {
+		feeAmount.Add(feeAmount, step.FeeAmount)
+	}
+	return &Quote{
+		AmountIn:                new(big.Int).Set(amountIn),
+		AmountOut:               amountOut,
+		SqrtPriceX96After:       new(big.Int).Set(result.SqrtPriceX96),
+		TickAfter:               result.Tick,
+		InitializedTicksCrossed: result.TicksCrossed(),
+		FeeAmount:               feeAmount,
+		ProtocolFee:             new(big.Int).Set(result.ProtocolFee),
+	}, nil
+}
+
+// Returns the amount out received for a given exact input swap, without
+// changing the pool. The swap stops early if it reaches the price limit, in
+// which case AmountIn is less than amountIn.
+//
+// Arguments:
+// p                 -- The pool to quote the swap against
+// zeroForOne        -- The direction of the swap, true for token0 to token1,
+//                      false for token1 to token0
+// amountIn          -- The amount of the input token to swap, including fees
+// sqrtPriceLimitX96 -- The price limit of the swap (see pool.Swap), or nil or
+//                      zero for no limit
+//
+// Returns:
+// quote             -- The quote
+// err               -- An error if the swap would fail (see pool.Swap)
+func QuoteExactInput(p *pool.Pool, zeroForOne bool, amountIn, sqrtPriceLimitX96 *big.Int) (*Quote, error) {
+	if amountIn.Cmp(big.NewInt(0)) <= -1 {
+		return nil, fmt.Errorf("quoter.QuoteExactInput: amountIn %v must not be negative", amountIn)
+	}
+	return quote(p, zeroForOne, amountIn, sqrtPriceLimitX96)
+}
+
+// Returns the amount in required for a given exact output swap, without
+// changing the pool. If a price limit is given the swap stops early if it
+// reaches the limit, in which case AmountOut is less than amountOut. If no
+// price limit is given ErrInsufficientLiquidity is returned if the pool
+// cannot provide the full amount out (as in the periphery Quoter).
+//
+// Arguments:
+// p                 -- The pool to quote the swap against
+// zeroForOne        -- The direction of the swap, true for token0 to token1,
+//                      false for token1 to token0
+// amountOut         -- The amount of the output token to receive
+// sqrtPriceLimitX96 -- The price limit of the swap (see pool.Swap), or nil or
+//                      zero for no limit
+//
+// Returns:
+// quote             -- The quote
+// err               -- An error if the swap would fail (see pool.Swap)
+func QuoteExactOutput(p *pool.Pool, zeroForOne bool, amountOut, sqrtPriceLimitX96 *big.Int) (*Quote, error) {
+	if amountOut.Cmp(big.NewInt(0)) <= -1 {
+		return nil, fmt.Errorf("quoter.QuoteExactOutput: amountOut %v must not be negative", amountOut)
+	}
+	q, err := quote(p, zeroForOne, new(big.Int).Neg(amountOut), sqrtPriceLimitX96)
+	if err != nil {
+		return nil, err
+	}
+	noLimit := sqrtPriceLimitX96 == nil || sqrtPriceLimitX96.Cmp(big.NewInt(0)) == 0
+	if noLimit && q.AmountOut.Cmp(amountOut) != 0 {
+		return nil, fmt.Errorf("quoter.QuoteExactOutput: %w (amount out %v, available %v)", ErrInsufficientLiquidity, amountOut, q.AmountOut)
+	}
+	return q, nil
+}
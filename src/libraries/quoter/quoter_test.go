@@ -0,0 +1,103 @@
+package quoter
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/pool"
+)
+
+// 1 as a Q64.96.
+var priceOne, _ = new(big.Int).SetString("79228162514264337593543950336", 10)
+
+// Returns a pool at a price of 1 with a full range position.
+func liquidPool(t *testing.T) *pool.Pool {
+	p := pool.Make("0xA", "0xB", 3000, 60)
+	if err := p.Initialize(priceOne); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	if _, _, err := p.Mint("0xC", -887220, 887220, big.NewInt(1000000000)); err != nil {
+		t.Fatalf("Mint failed: %v", err)
+	}
+	return p
+}
+
+func TestQuoteExactInput(t *testing.T) {
+	fmt.Println("QuoteExactInput: Matches the swap and does not change the pool")
+	p := liquidPool(t)
+	// A position below the current price, which the swap enters.
+	if _, _, err := p.Mint("0xD", -120, -60, big.NewInt(1000000000)); err != nil {
+		t.Fatalf("Mint failed: %v", err)
+	}
+	before := p.Clone()
+	q, err := QuoteExactInput(p, true, big.NewInt(5000000), nil)
+	if err != nil {
+		t.Fatalf("QuoteExactInput failed: %v", err)
+	}
+	if differences := pool.Diff(before, p, &pool.Tolerances{}); len(differences) != 0 {
+		t.Errorf("Expected the pool to be unchanged, got differences %+v", differences)
+	}
+	amount0, amount1, err := before.Swap("0xE", "0xE", true, big.NewInt(5000000), big.NewInt(4295128740))
+	if err != nil {
+		t.Fatalf("Swap failed: %v", err)
+	}
+	if q.AmountIn.Cmp(amount0) != 0 || q.AmountOut.Cmp(new(big.Int).Neg(amount1)) != 0 {
+		t.Errorf("Got %v in, %v out; want %v in, %v out", q.AmountIn, q.AmountOut, amount0, new(big.Int).Neg(amount1))
+	}
+	if len(q.InitializedTicksCrossed) != 1 || q.InitializedTicksCrossed[0] != -60 {
+		t.Errorf("Got ticks crossed %v; want [-60]", q.InitializedTicksCrossed)
+	}
+	if q.TickAfter >= -60 || q.TickAfter < -120 {
+		t.Errorf("Expected the tick after to be between -120 and -60, got %d", q.TickAfter)
+	}
+	// The fee is 0.3% of the amount in, rounded up in each of the swap's
+	// steps (of which there are at most 3).
+	if q.FeeAmount.Cmp(big.NewInt(15000)) <= -1 || q.FeeAmount.Cmp(big.NewInt(15003)) >= 1 {
+		t.Errorf("Got fee %v; want between 15000 and 15003", q.FeeAmount)
+	}
+}
+
+func TestQuoteExactOutput(t *testing.T) {
+	fmt.Println("QuoteExactOutput: Returns the amount in that gives exactly the amount out")
+	p := liquidPool(t)
+	q, err := QuoteExactOutput(p, false, big.NewInt(1000), nil)
+	if err != nil {
+		t.Fatalf("QuoteExactOutput failed: %v", err)
+	}
+	if q.AmountOut.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("Got %v out; want 1000", q.AmountOut)
+	}
+	inputQuote, err := QuoteExactInput(p, false, q.AmountIn, nil)
+	if err != nil {
+		t.Fatalf("QuoteExactInput failed: %v", err)
+	}
+	if inputQuote.AmountOut.Cmp(big.NewInt(1000)) <= -1 {
+		t.Errorf("Expected swapping the quoted amount in to give at least 1000 out, got %v", inputQuote.AmountOut)
+	}
+}
+
+func TestQuoteExactOutputInsufficientLiquidity(t *testing.T) {
+	fmt.Println("QuoteExactOutput: Fails without a price limit if the pool cannot provide the amount out")
+	p := liquidPool(t)
+	if _, err := QuoteExactOutput(p, true, big.NewInt(1e18), nil); !errors.Is(err, ErrInsufficientLiquidity) {
+		t.Errorf("Expected ErrInsufficientLiquidity, got %v", err)
+	}
+	limit := new(big.Int).Sub(priceOne, big.NewInt(1e15))
+	q, err := QuoteExactOutput(p, true, big.NewInt(1e18), limit)
+	if err != nil {
+		t.Fatalf("QuoteExactOutput failed: %v", err)
+	}
+	if q.SqrtPriceX96After.Cmp(limit) != 0 {
+		t.Errorf("Expected the swap to stop at the price limit %v, got %v", limit, q.SqrtPriceX96After)
+	}
+}
+
+func TestQuoteInvalidPriceLimit(t *testing.T) {
+	fmt.Println("QuoteExactInput: Returns the pool's error for an invalid price limit")
+	p := liquidPool(t)
+	if _, err := QuoteExactInput(p, true, big.NewInt(1000), new(big.Int).Add(priceOne, big.NewInt(1))); !errors.Is(err, pool.ErrInvalidPriceLimit) {
+		t.Errorf("Expected ErrInvalidPriceLimit, got %v", err)
+	}
+}
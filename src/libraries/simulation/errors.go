@@ -0,0 +1,120 @@
+package simulation
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/logging"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/transaction"
+)
+
+// ErrorPolicy determines what a simulation does when a transaction (or one of
+// the strategy's hooks) fails, i.e. when the deployed contract would have
+// reverted.
+type ErrorPolicy int
+
+const (
+	// Panics on the first error (the default).
+	AbortOnError ErrorPolicy = iota
+	// Records the error in the simulation's Errors and continues with the
+	// next transaction. A failed operation leaves the pool unchanged.
+	SkipOnError
+	// Records the error in the simulation's Errors and stops the simulation,
+	// returning the error from Simulate.
+	StopOnError
+)
+
+// Names used to select an error policy (e.g. from the command line).
+var errorPolicyNames = map[string]ErrorPolicy{
+	"abort": AbortOnError,
+	"skip":  SkipOnError,
+	"stop":  StopOnError,
+}
+
+// ParseErrorPolicy returns the error policy with the given name.
+func ParseErrorPolicy(name string) (ErrorPolicy, error) {
+	policy, found := errorPolicyNames[name]
+	if !found {
+		return 0, fmt.Errorf("simulation.ParseErrorPolicy: Unknown error policy %q", name)
+	}
+	return policy, nil
+}
+
+// String returns the name of the error policy.
+func (e ErrorPolicy) String() string {
+	for name, policy := range errorPolicyNames {
+		if policy == e {
+			return name
+		}
+	}
+	return fmt.Sprintf("ErrorPolicy(%d)", int(e))
+}
+
+// The methods recorded for errors returned by the strategy's hooks (see
+// strategy.Strategy). Errors returned by OnStart are recorded against the first
+// transaction and errors returned by OnEnd against the last.
+const (
+	startMethod             = "START"
+	blockMethod             = "BLOCK"
+	rebalanceMethod         = "REBALANCE"
+	beforeTransactionMethod = "BEFORE_TRANSACTION"
+	afterTransactionMethod  = "AFTER_TRANSACTION"
+	endMethod               = "END"
+)
+
+// TransactionError records an error returned while executing a transaction,
+// or while running one of the strategy's hooks around it. The underlying error (e.g.
+// pool.ErrTickOrder) can be inspected with errors.Is.
+type TransactionError struct {
+	// The index of the transaction in the simulation's transactions.
+	TxIndex int    `json:"txIndex"`
+	BlockNo int    `json:"blockNo"`
+	Method  string `json:"method"`
+	Err     error  `json:"-"`
+}
+
+// Error returns a description of the error, including the transaction.
+func (e *TransactionError) Error() string {
+	return fmt.Sprintf("transaction %d (%s in block %d): %v", e.TxIndex, e.Method, e.BlockNo, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *TransactionError) Unwrap() error {
+	return e.Err
+}
+
+// MarshalJSON encodes the error with its message, so that errors can be
+// saved alongside the other results of a simulation.
+func (e *TransactionError) MarshalJSON() ([]byte, error) {
+	type transactionError TransactionError
+	return json.Marshal(struct {
+		transactionError
+		Error string `json:"error"`
+	}{transactionError(*e), e.Err.Error()})
+}
+
+// Wraps the error with the details of the transaction.
+func makeTransactionError(index int, t transaction.Transaction, method string, err error) *TransactionError {
+	return &TransactionError{
+		TxIndex: index,
+		BlockNo: t.BlockNo,
+		Method:  method,
+		Err:     err,
+	}
+}
+
+// Handles an error according to the simulation's error policy. Returns a
+// non-nil error iff the simulation should stop.
+func (s *Simulation) handleError(err *TransactionError) error {
+	logger.Warn("transaction failed", logging.F("txIndex", err.TxIndex), logging.F("block", err.BlockNo), logging.F("method", err.Method), logging.F("error", err.Err), logging.F("onError", s.OnError))
+	switch s.OnError {
+	case SkipOnError:
+		s.Errors = append(s.Errors, err)
+		return nil
+	case StopOnError:
+		s.Errors = append(s.Errors, err)
+		return err
+	default:
+		panic(fmt.Sprintf("simulation.Simulate: %v", err))
+	}
+}
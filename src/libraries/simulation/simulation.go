@@ -5,43 +5,160 @@
 package simulation
 
 import (
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/logging"
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/pool"
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/strategy"
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/transaction"
 )
 
+// Logs the progress of simulations (subsystem "simulation", see the logging
+// package).
+var logger = logging.Get("simulation")
+
 // Simulation represents a simulation of a Uniswap pool. It contains the
 // pool, the transactions to be run, and the strategy to be tested in the
 // simulation.
 type Simulation struct {
-	Strategy     *strategy.Strategy
+	Strategy strategy.Strategy
+	// The strategy's tokens and positions.
+	Account      *strategy.Account
 	Pool         *pool.Pool
 	Transactions []transaction.Transaction
+	// How recorded swaps are replayed (exact input by default).
+	SwapMode transaction.SwapMode
+	// How each transaction was replayed, in the same order as Transactions
+	// (e.g. whether a swap was replayed as an exact output swap).
+	Results []transaction.Result
+	// If true, the pool state is compared with the state recorded on chain
+	// after each transaction and any differences are added to Divergences.
+	Verify      bool
+	Divergences []Divergence
+	// What to do when a transaction or one of the strategy's hooks fails
+	// (abort by default).
+	OnError ErrorPolicy
+	// The errors that were skipped (or that stopped the simulation), in the
+	// order they occurred.
+	Errors []*TransactionError
+	// If true, a trace of every swap executed on the pool (including the
+	// strategy's swaps) is added to SwapTraces.
+	TraceSwaps bool
+	SwapTraces []*SwapTrace
+}
+
+// SwapTrace records a swap executed while replaying a transaction, or while
+// running one of the strategy's hooks around it (see pool.SwapTrace).
+type SwapTrace struct {
+	// The index of the transaction in the simulation's transactions.
+	TxIndex int    `json:"txIndex"`
+	BlockNo int    `json:"blockNo"`
+	Method  string `json:"method"`
+	*pool.SwapTrace
 }
 
 // Make returns a new simulation struct.
-func Make(pool *pool.Pool, transactions []transaction.Transaction, strategy *strategy.Strategy) *Simulation {
+func Make(pool *pool.Pool, transactions []transaction.Transaction, strategy strategy.Strategy, account *strategy.Account) *Simulation {
 	return &Simulation{
 		Strategy:     strategy,
+		Account:      account,
 		Pool:         pool,
 		Transactions: transactions,
 	}
 }
 
-// Simulate runs the simulation.
-func (s *Simulation) Simulate() {
+// Simulate runs the simulation, calling the strategy's hooks (see
+// strategy.Strategy) around the transactions. Errors are handled according to
+// the simulation's error policy (see ErrorPolicy): the returned error is
+// non-nil only if the simulation was stopped early.
+func (s *Simulation) Simulate() error {
 	startBlock := s.Transactions[0].BlockNo
 	prevBlock := startBlock
-	for _, t := range s.Transactions {
+	// The transaction (or hook) that swaps are currently traced for.
+	var current *SwapTrace
+	if s.TraceSwaps {
+		s.Pool.SetSwapTracer(pool.SwapTracerFunc(func(trace *pool.SwapTrace) {
+			traced := *current
+			traced.SwapTrace = trace
+			s.SwapTraces = append(s.SwapTraces, &traced)
+		}))
+		defer s.Pool.SetSwapTracer(nil)
+	}
+	// Runs one of the strategy's hooks, recording its errors (and swaps)
+	// against the ith transaction.
+	runHook := func(i int, method string, hook func() error) error {
+		t := s.Transactions[i]
+		current = &SwapTrace{TxIndex: i, BlockNo: t.BlockNo, Method: method}
+		if err := hook(); err != nil {
+			return s.handleError(makeTransactionError(i, t, method, err))
+		}
+		return nil
+	}
+	logger.Info("simulation started", logging.F("transactions", len(s.Transactions)), logging.F("swapMode", s.SwapMode), logging.F("onError", s.OnError))
+
+	s.Pool.SetBlockTimestamp(s.Transactions[0].Timestamp)
+	ctx := strategy.MakeContext(startBlock, s.Transactions[0].Timestamp, 0, nil)
+	if err := runHook(0, startMethod, func() error { return s.Strategy.OnStart(ctx, s.Pool, s.Account) }); err != nil {
+		return err
+	}
+	// The last transaction executed.
+	var last *transaction.Transaction
+	for i, t := range s.Transactions {
+		// Hooks run in the same block as the transaction.
+		s.Pool.SetBlockTimestamp(t.Timestamp)
+		ctx = strategy.MakeContext(t.BlockNo, t.Timestamp, i, last)
+
+		if i == 0 || t.BlockNo != prevBlock {
+			if err := runHook(i, blockMethod, func() error { return s.Strategy.OnBlock(ctx, s.Pool, s.Account) }); err != nil {
+				return err
+			}
+		}
+
 		// Rebalance the pool if the update interval has been reached.
-		if (t.BlockNo-startBlock)%s.Strategy.UpdateInterval == 0 {
-			s.Strategy.Rebalance(s.Pool, s.Strategy)
-		} else if t.BlockNo-prevBlock >= s.Strategy.UpdateInterval {
-			s.Strategy.Rebalance(s.Pool, s.Strategy)
+		if (t.BlockNo-startBlock)%s.Account.UpdateInterval == 0 || t.BlockNo-prevBlock >= s.Account.UpdateInterval {
+			if logger.Enabled(logging.Debug) {
+				logger.Debug("rebalance", logging.F("txIndex", i), logging.F("block", t.BlockNo), logging.F("tick", s.Pool.Slot0.Tick))
+			}
+			if err := runHook(i, rebalanceMethod, func() error { return s.Strategy.OnRebalance(ctx, s.Pool, s.Account) }); err != nil {
+				return err
+			}
+		}
+
+		ctx = strategy.MakeContext(t.BlockNo, t.Timestamp, i, &s.Transactions[i])
+		if err := runHook(i, beforeTransactionMethod, func() error {
+			return s.Strategy.OnTransaction(ctx, strategy.BeforeTransaction, s.Pool, s.Account)
+		}); err != nil {
+			return err
 		}
 
 		// Execute the transaction.
-		transaction.Execute(t, s.Pool)
+		if logger.Enabled(logging.Debug) {
+			logger.Debug("transaction", logging.F("txIndex", i), logging.F("block", t.BlockNo), logging.F("method", t.Method), logging.F("tick", s.Pool.Slot0.Tick))
+		}
+		current.Method = t.Method
+		result, err := transaction.Execute(t, s.Pool, s.SwapMode)
+		s.Results = append(s.Results, result)
+		if err != nil {
+			if err := s.handleError(makeTransactionError(i, t, t.Method, err)); err != nil {
+				return err
+			}
+		}
+		if s.Verify {
+			s.Divergences = append(s.Divergences, CompareToRecorded(i, t, s.Pool)...)
+		}
+
+		if err := runHook(i, afterTransactionMethod, func() error {
+			return s.Strategy.OnTransaction(ctx, strategy.AfterTransaction, s.Pool, s.Account)
+		}); err != nil {
+			return err
+		}
+		last = &s.Transactions[i]
 		prevBlock = t.BlockNo
 	}
+
+	end := len(s.Transactions) - 1
+	ctx = strategy.MakeContext(last.BlockNo, last.Timestamp, end, last)
+	if err := runHook(end, endMethod, func() error { return s.Strategy.OnEnd(ctx, s.Pool, s.Account) }); err != nil {
+		return err
+	}
+	logger.Info("simulation finished", logging.F("errors", len(s.Errors)), logging.F("divergences", len(s.Divergences)))
+	return nil
 }
@@ -0,0 +1,215 @@
+package simulation
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/pool"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/strategy"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/transaction"
+)
+
+// A strategy that records the hooks called, and fails the hooks in fail.
+type recordingStrategy struct {
+	calls []string
+	fail  map[string]bool
+}
+
+func (r *recordingStrategy) record(name string, ctx strategy.Context) error {
+	call := fmt.Sprintf("%s %d %d", name, ctx.Block(), ctx.TxIndex())
+	if t, found := ctx.Transaction(); found {
+		call += " " + t.Method
+	}
+	r.calls = append(r.calls, call)
+	if r.fail[name] {
+		return errors.New(name + " failed")
+	}
+	return nil
+}
+
+func (r *recordingStrategy) OnStart(ctx strategy.Context, p *pool.Pool, a *strategy.Account) error {
+	return r.record("start", ctx)
+}
+
+func (r *recordingStrategy) OnBlock(ctx strategy.Context, p *pool.Pool, a *strategy.Account) error {
+	return r.record("block", ctx)
+}
+
+func (r *recordingStrategy) OnRebalance(ctx strategy.Context, p *pool.Pool, a *strategy.Account) error {
+	return r.record("rebalance", ctx)
+}
+
+func (r *recordingStrategy) OnTransaction(ctx strategy.Context, phase strategy.Phase, p *pool.Pool, a *strategy.Account) error {
+	return r.record(phase.String(), ctx)
+}
+
+func (r *recordingStrategy) OnEnd(ctx strategy.Context, p *pool.Pool, a *strategy.Account) error {
+	return r.record("end", ctx)
+}
+
+// A strategy that changes the big.Ints of the transaction in its context.
+type mutatingStrategy struct {
+	strategy.Base
+}
+
+func (mutatingStrategy) OnTransaction(ctx strategy.Context, phase strategy.Phase, p *pool.Pool, a *strategy.Account) error {
+	t, _ := ctx.Transaction()
+	for _, x := range []*big.Int{t.Amount, t.SqrtPriceX96} {
+		if x != nil {
+			x.SetInt64(1)
+		}
+	}
+	return nil
+}
+
+// Returns a simulation of an initialization and two mints, in blocks 1, 1
+// and 3, with the given strategy rebalancing every 2 blocks.
+func hookSimulation(s strategy.Strategy) *Simulation {
+	price, _ := new(big.Int).SetString("79228162514264337593543950336", 10)
+	transactions := []transaction.Transaction{
+		{BlockNo: 1, Timestamp: 10, Method: "INITIALIZE", SqrtPriceX96: price},
+		{BlockNo: 1, Timestamp: 10, Method: "MINT", Owner: "0xC", TickLower: -60, TickUpper: 60, Amount: big.NewInt(1000)},
+		{BlockNo: 3, Timestamp: 34, Method: "MINT", Owner: "0xC", TickLower: -120, TickUpper: 120, Amount: big.NewInt(1000)},
+	}
+	account := strategy.Make(big.NewInt(0), big.NewInt(0), &strategy.GasAvs{}, 2)
+	return Make(pool.Make("0xA", "0xB", 3000, 60), transactions, s, account)
+}
+
+func TestSimulateCallsHooks(t *testing.T) {
+	fmt.Println("Simulate: Calls the strategy's hooks in order with their context")
+	r := &recordingStrategy{}
+	if err := hookSimulation(r).Simulate(); err != nil {
+		t.Fatalf("Simulate failed: %v", err)
+	}
+	expected := []string{
+		"start 1 0",
+		"block 1 0",
+		"rebalance 1 0",
+		"before 1 0 INITIALIZE",
+		"after 1 0 INITIALIZE",
+		"rebalance 1 1 INITIALIZE",
+		"before 1 1 MINT",
+		"after 1 1 MINT",
+		"block 3 2 MINT",
+		"rebalance 3 2 MINT",
+		"before 3 2 MINT",
+		"after 3 2 MINT",
+		"end 3 2 MINT",
+	}
+	if !reflect.DeepEqual(r.calls, expected) {
+		t.Errorf("Got calls %q; want %q", r.calls, expected)
+	}
+}
+
+func TestSimulateContextIsCopy(t *testing.T) {
+	fmt.Println("Simulate: Hooks cannot change the transactions through their context")
+	s := hookSimulation(mutatingStrategy{})
+	expected := make([]string, len(s.Transactions))
+	for i, tx := range s.Transactions {
+		expected[i] = fmt.Sprintf("%v %v", tx.Amount, tx.SqrtPriceX96)
+	}
+	if err := s.Simulate(); err != nil {
+		t.Fatalf("Simulate failed: %v", err)
+	}
+	for i, tx := range s.Transactions {
+		if got := fmt.Sprintf("%v %v", tx.Amount, tx.SqrtPriceX96); got != expected[i] {
+			t.Errorf("Transaction %d: Got %s; want %s", i, got, expected[i])
+		}
+	}
+	if s.Pool.Liquidity.Cmp(big.NewInt(2000)) != 0 {
+		t.Errorf("Got liquidity %v; want 2000", s.Pool.Liquidity)
+	}
+}
+
+func TestSimulateHookErrors(t *testing.T) {
+	fmt.Println("Simulate: Handles the errors of the strategy's hooks according to the error policy")
+	r := &recordingStrategy{fail: map[string]bool{"block": true, "end": true}}
+	s := hookSimulation(r)
+	s.OnError = SkipOnError
+	if err := s.Simulate(); err != nil {
+		t.Fatalf("Simulate failed: %v", err)
+	}
+	var methods []string
+	for _, err := range s.Errors {
+		methods = append(methods, fmt.Sprintf("%s %d", err.Method, err.TxIndex))
+	}
+	expected := []string{"BLOCK 0", "BLOCK 2", "END 2"}
+	if !reflect.DeepEqual(methods, expected) {
+		t.Errorf("Got errors %q; want %q", methods, expected)
+	}
+	// The transactions are still executed.
+	if s.Pool.Liquidity.Cmp(big.NewInt(2000)) != 0 {
+		t.Errorf("Got liquidity %v; want 2000", s.Pool.Liquidity)
+	}
+
+	r = &recordingStrategy{fail: map[string]bool{"start": true}}
+	s = hookSimulation(r)
+	s.OnError = StopOnError
+	if err := s.Simulate(); err == nil || len(r.calls) != 1 {
+		t.Errorf("Expected the simulation to stop after OnStart, got %v after %q", err, r.calls)
+	}
+}
+
+func TestCompareToRecorded(t *testing.T) {
+	fmt.Println("CompareToRecorded: Reports the fields of the pool state that differ from a recorded swap")
+	price, _ := new(big.Int).SetString("79228162514264337593543950336", 10)
+	p := pool.Make("0xA", "0xB", 3000, 60)
+	if err := p.Initialize(price); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	if _, _, err := p.Mint("0xC", -60, 60, big.NewInt(1000)); err != nil {
+		t.Fatalf("Mint failed: %v", err)
+	}
+	swap := transaction.Transaction{BlockNo: 5, Method: "SWAP", SqrtPriceX96: price, Tick: 0, Liquidity: big.NewInt(1000)}
+	if divergences := CompareToRecorded(3, swap, p); len(divergences) != 0 {
+		t.Errorf("Got divergences %+v; want none", divergences)
+	}
+
+	swap.Tick = 2
+	expected := []Divergence{{TxIndex: 3, BlockNo: 5, Method: "SWAP", Field: "tick", Expected: big.NewInt(2), Actual: big.NewInt(0), RelativeError: 1}}
+	if divergences := CompareToRecorded(3, swap, p); !reflect.DeepEqual(divergences, expected) {
+		t.Errorf("Got divergences %+v; want %+v", divergences, expected)
+	}
+
+	swap.Tick = 0
+	swap.Liquidity = big.NewInt(800)
+	expected = []Divergence{{TxIndex: 3, BlockNo: 5, Method: "SWAP", Field: "liquidity", Expected: big.NewInt(800), Actual: big.NewInt(1000), RelativeError: 0.25}}
+	if divergences := CompareToRecorded(3, swap, p); !reflect.DeepEqual(divergences, expected) {
+		t.Errorf("Got divergences %+v; want %+v", divergences, expected)
+	}
+
+	// Only swaps record the pool state after the transaction.
+	for _, method := range []string{"MINT", "BURN", "INITIALIZE"} {
+		tx := transaction.Transaction{Method: method, SqrtPriceX96: big.NewInt(1), Tick: 5, Liquidity: big.NewInt(1)}
+		if divergences := CompareToRecorded(0, tx, p); len(divergences) != 0 {
+			t.Errorf("%s: Got divergences %+v; want none", method, divergences)
+		}
+	}
+	if divergences := CompareToRecorded(0, transaction.Transaction{Method: "SWAP", Tick: 5}, p); len(divergences) != 0 {
+		t.Errorf("Got divergences %+v for a swap without a recorded state; want none", divergences)
+	}
+}
+
+func TestRelativeError(t *testing.T) {
+	fmt.Println("relativeError: Is relative to the expected value, or absolute if it is zero")
+	tests := []struct {
+		expected int64
+		actual   int64
+		err      float64
+	}{
+		{100, 100, 0},
+		{100, 150, 0.5},
+		{-100, -50, 0.5},
+		{0, 0, 0},
+		{0, 7, 7},
+		{0, -7, 7},
+	}
+	for _, test := range tests {
+		if err := relativeError(big.NewInt(test.expected), big.NewInt(test.actual)); err != test.err {
+			t.Errorf("relativeError(%d, %d): Got %v; want %v", test.expected, test.actual, err, test.err)
+		}
+	}
+}
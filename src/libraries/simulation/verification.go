@@ -0,0 +1,77 @@
+package simulation
+
+import (
+	"math/big"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/pool"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/transaction"
+)
+
+// Divergence records a difference between the simulated pool state and the
+// pool state recorded on chain after a transaction.
+type Divergence struct {
+	// The index of the transaction in the simulation's transactions.
+	TxIndex int    `json:"txIndex"`
+	BlockNo int    `json:"blockNo"`
+	Method  string `json:"method"`
+	// The name of the pool state field that diverged.
+	Field    string   `json:"field"`
+	Expected *big.Int `json:"expected"`
+	Actual   *big.Int `json:"actual"`
+	// |actual - expected| / |expected|, or |actual - expected| if the
+	// expected value is zero.
+	RelativeError float64 `json:"relativeError"`
+}
+
+// Compares the pool's Slot0 and Liquidity with the post-transaction state
+// recorded in the transaction. Only swaps record a post-transaction state, so
+// any other transaction (or a swap without a recorded state) never diverges.
+//
+// Arguments:
+// index       -- The index of the transaction in the simulation's transactions
+// t           -- The transaction that has just been executed on the pool
+// p           -- The pool
+//
+// Returns:
+// divergences -- The fields of the pool state that differ from those recorded
+func CompareToRecorded(index int, t transaction.Transaction, p *pool.Pool) (divergences []Divergence) {
+	if t.Method != "SWAP" || t.SqrtPriceX96 == nil || t.Liquidity == nil {
+		return nil
+	}
+	fields := []struct {
+		name     string
+		expected *big.Int
+		actual   *big.Int
+	}{
+		{"sqrtPriceX96", t.SqrtPriceX96, p.Slot0.SqrtPriceX96},
+		{"tick", big.NewInt(int64(t.Tick)), big.NewInt(int64(p.Slot0.Tick))},
+		{"liquidity", t.Liquidity, p.Liquidity},
+	}
+	for _, field := range fields {
+		if field.expected.Cmp(field.actual) == 0 {
+			continue
+		}
+		divergences = append(divergences, Divergence{
+			TxIndex:       index,
+			BlockNo:       t.BlockNo,
+			Method:        t.Method,
+			Field:         field.name,
+			Expected:      new(big.Int).Set(field.expected),
+			Actual:        new(big.Int).Set(field.actual),
+			RelativeError: relativeError(field.expected, field.actual),
+		})
+	}
+	return divergences
+}
+
+// Calculates |actual - expected| / |expected|, or |actual - expected| if
+// expected is zero.
+func relativeError(expected, actual *big.Int) float64 {
+	difference := new(big.Float).SetInt(new(big.Int).Abs(new(big.Int).Sub(actual, expected)))
+	if expected.Cmp(big.NewInt(0)) == 0 {
+		result, _ := difference.Float64()
+		return result
+	}
+	result, _ := new(big.Float).Quo(difference, new(big.Float).SetInt(new(big.Int).Abs(expected))).Float64()
+	return result
+}
@@ -0,0 +1,97 @@
+// The concentrated strategy provides liquidity over a fixed-width range around
+// the current price. When the price leaves the range (plus a buffer), it burns
+// its position, swaps its tokens to the ratio required by a new range around
+// the current price and mints a position over the new range.
+package strategy
+
+import (
+	"fmt"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/pool"
+)
+
+// ConcentratedParams are the params of the concentrated strategy.
+type ConcentratedParams struct {
+	// The number of tick spacings either side of the current tick that the
+	// range covers.
+	Width int `json:"width"`
+	// The number of ticks that the price can move outside of the range before
+	// the strategy rebalances.
+	Buffer int `json:"buffer"`
+}
+
+// Validate returns an error if the width is not positive or the buffer is
+// negative.
+func (c *ConcentratedParams) Validate() error {
+	if c.Width <= 0 {
+		return fmt.Errorf("width must be positive, got %d", c.Width)
+	}
+	if c.Buffer < 0 {
+		return fmt.Errorf("buffer must not be negative, got %d", c.Buffer)
+	}
+	return nil
+}
+
+// Concentrated is the concentrated strategy.
+type Concentrated struct {
+	Base
+	params ConcentratedParams
+}
+
+// Params returns the strategy's params.
+func (c *Concentrated) Params() Params {
+	return &c.params
+}
+
+// Mints a position around the current tick if the strategy has none, or
+// moves the position to a new range around the current tick if the price has
+// left the range plus the buffer.
+func (c *Concentrated) OnRebalance(ctx Context, p *pool.Pool, a *Account) error {
+	if len(a.Positions) > 0 {
+		tickLower, tickUpper := a.Positions[0].TickLower, a.Positions[0].TickUpper
+		// As in the pool, the position is in range iff
+		// tickLower <= tick < tickUpper.
+		if p.Slot0.Tick >= tickLower-c.params.Buffer && p.Slot0.Tick < tickUpper+c.params.Buffer {
+			return nil
+		}
+		if _, _, err := a.BurnAll(p); err != nil {
+			return err
+		}
+	}
+	tickLower, tickUpper := ConcentratedRange(p.Slot0.Tick, p.TickSpacing, c.params.Width)
+	if _, _, err := SwapToRatio(p, a, tickLower, tickUpper); err != nil {
+		return err
+	}
+	_, err := a.Mint(p, tickLower, tickUpper)
+	return err
+}
+
+// ConcentratedRange returns the range that covers width tick spacings either
+// side of the tick spacing that contains the given tick, clamped to the
+// usable ticks.
+//
+// Arguments:
+// tick        -- The current tick
+// tickSpacing -- The pool's tick spacing
+// width       -- The number of tick spacings either side of the tick
+//
+// Returns:
+// tickLower   -- The lower tick of the range, a multiple of tickSpacing
+// tickUpper   -- The upper tick of the range, a multiple of tickSpacing
+func ConcentratedRange(tick, tickSpacing, width int) (tickLower, tickUpper int) {
+	// Round towards negative infinity, so that tickLower <= tick.
+	aligned := tick / tickSpacing * tickSpacing
+	if tick < 0 && tick%tickSpacing != 0 {
+		aligned -= tickSpacing
+	}
+	tickLower = aligned - width*tickSpacing
+	tickUpper = aligned + width*tickSpacing
+	minTick, maxTick := FullRange(tickSpacing)
+	if tickLower < minTick {
+		tickLower = minTick
+	}
+	if tickUpper > maxTick {
+		tickUpper = maxTick
+	}
+	return
+}
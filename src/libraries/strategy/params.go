@@ -0,0 +1,224 @@
+package strategy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	// Returned by ParseInput for a strategy.txt that cannot be decoded or
+	// whose fields are invalid.
+	ErrInvalidInput = errors.New("invalid strategy input")
+	// Returned by Configure and NewFromInput for params that cannot be
+	// decoded into the strategy's params or that fail its validation.
+	ErrInvalidParams = errors.New("invalid strategy params")
+)
+
+// Params is implemented by the typed config structs of strategies (see
+// Configurable).
+type Params interface {
+	// Returns an error if the params are invalid, e.g. out of range. Called
+	// after the params are decoded, or on the defaults if none are given.
+	Validate() error
+}
+
+// Configurable is implemented by strategies that take params (the params
+// object of strategy.txt). Strategies that do not implement it take no
+// params.
+type Configurable interface {
+	Strategy
+	// Returns a pointer to the strategy's params, which the params object is
+	// decoded into. Fields that are not in the params object keep their
+	// value, so the strategy's defaults should be set by the function passed
+	// to Register.
+	Params() Params
+}
+
+// ParseInput decodes the contents of strategy.txt. Unlike json.Unmarshal it
+// fails on unknown fields, and it checks that the fields are valid. The
+// strategy's params are only decoded by NewFromInput.
+//
+// Arguments:
+// raw   -- The contents of strategy.txt
+//
+// Returns:
+// input -- The decoded input
+// err   -- ErrInvalidInput if the input cannot be decoded or is invalid
+func ParseInput(raw []byte) (*StrategyInput, error) {
+	var input StrategyInput
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&input); err != nil {
+		return nil, fmt.Errorf("strategy.ParseInput: %w (%s)", ErrInvalidInput, describeDecodeError(err, "field", &input))
+	}
+	if !atEOF(dec) {
+		return nil, fmt.Errorf("strategy.ParseInput: %w (unexpected data after the input object)", ErrInvalidInput)
+	}
+	switch {
+	case input.Strategy == "":
+		return nil, fmt.Errorf("strategy.ParseInput: %w (no strategy)", ErrInvalidInput)
+	case input.Amount0 == nil || input.Amount0.Cmp(big.NewInt(0)) < 0:
+		return nil, fmt.Errorf("strategy.ParseInput: %w (amount0 must be a non-negative integer, got %v)", ErrInvalidInput, input.Amount0)
+	case input.Amount1 == nil || input.Amount1.Cmp(big.NewInt(0)) < 0:
+		return nil, fmt.Errorf("strategy.ParseInput: %w (amount1 must be a non-negative integer, got %v)", ErrInvalidInput, input.Amount1)
+	case input.UpdateInterval <= 0:
+		return nil, fmt.Errorf("strategy.ParseInput: %w (updateInterval must be positive, got %d)", ErrInvalidInput, input.UpdateInterval)
+	}
+	return &input, nil
+}
+
+// NewFromInput returns a new instance of the strategy named in the input,
+// configured with the input's params (see Configure).
+//
+// Arguments:
+// input    -- The decoded strategy.txt (see ParseInput)
+//
+// Returns:
+// strategy -- The configured strategy
+// err      -- ErrUnknownStrategy or ErrInvalidParams
+func NewFromInput(input *StrategyInput) (Strategy, error) {
+	s, err := New(input.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	if err := Configure(s, input.Params); err != nil {
+		return nil, fmt.Errorf("strategy.NewFromInput: %w (strategy %s)", err, input.Strategy)
+	}
+	return s, nil
+}
+
+// Configure decodes the params object into the strategy's params (see
+// Configurable) and validates them. Unknown params and params of the wrong
+// type are errors. If raw is empty or null the strategy's defaults are
+// validated.
+//
+// Arguments:
+// s   -- The strategy
+// raw -- The params object
+//
+// Returns:
+// err -- ErrInvalidParams if the params cannot be decoded or are invalid
+func Configure(s Strategy, raw json.RawMessage) error {
+	raw = bytes.TrimSpace(raw)
+	given := len(raw) > 0 && !bytes.Equal(raw, []byte("null"))
+	c, ok := s.(Configurable)
+	if !ok {
+		if !given {
+			return nil
+		}
+		var params map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return fmt.Errorf("strategy.Configure: %w (params must be an object)", ErrInvalidParams)
+		}
+		if len(params) > 0 {
+			return fmt.Errorf("strategy.Configure: %w (the strategy takes no params, got %s)", ErrInvalidParams, strings.Join(sortedKeys(params), ", "))
+		}
+		return nil
+	}
+	params := c.Params()
+	if given {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(params); err != nil {
+			return fmt.Errorf("strategy.Configure: %w (%s)", ErrInvalidParams, describeDecodeError(err, "param", params))
+		}
+		if !atEOF(dec) {
+			return fmt.Errorf("strategy.Configure: %w (unexpected data after the params object)", ErrInvalidParams)
+		}
+	}
+	if err := params.Validate(); err != nil {
+		return fmt.Errorf("strategy.Configure: %w (%v)", ErrInvalidParams, err)
+	}
+	return nil
+}
+
+// Returns true iff there is nothing but whitespace left in the decoder's
+// input, i.e. the value decoded was the whole input.
+func atEOF(dec *json.Decoder) bool {
+	_, err := dec.Token()
+	return err == io.EOF
+}
+
+// Describes an error returned by json.Decoder.Decode for the value v, naming
+// the field (or param) that could not be decoded.
+func describeDecodeError(err error, kind string, v interface{}) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		if typeErr.Field == "" {
+			return fmt.Sprintf("expected an object, got %s", typeErr.Value)
+		}
+		return fmt.Sprintf("%s %q must be %s, got %s", kind, typeErr.Field, describeType(typeErr.Type), typeErr.Value)
+	}
+	// The decoder does not export the error for unknown fields.
+	if name, found := strings.CutPrefix(err.Error(), "json: unknown field "); found {
+		return fmt.Sprintf("unknown %s %s (known %ss: %s)", kind, name, kind, strings.Join(jsonFieldNames(v), ", "))
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return fmt.Sprintf("%v at offset %d", err, syntaxErr.Offset)
+	}
+	return err.Error()
+}
+
+// Describes the type expected for a field.
+func describeType(t reflect.Type) string {
+	if t == reflect.TypeOf(big.Int{}) {
+		return "an integer"
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
+
+// Returns the names of the JSON fields of the struct pointed to by v, sorted.
+func jsonFieldNames(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the keys of the map, sorted.
+func sortedKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,49 +1,233 @@
 // The strategy package contains the logic for defining and executing strategies.
 //
-// All strategies have a BurnAll function that burns all of the strategy's
-// positions and calculates the tokens owed to the strategy, a Results function
-// that returns the tokens that the strategy has accumulated and the total
-// amount of gas that the strategy has spent and a Make function that
-// initialises a strategy.
+// A strategy is a type that implements the Strategy interface. Its hooks are
+// called by the simulation at the start and end of the simulation, for each
+// new block, when the strategy's update interval is reached and before and
+// after each transaction. Each hook takes a read-only Context, the Pool and
+// the strategy's Account. It can call any of the Pool methods and it has
+// access to all of the Pool and Account state. It returns an error if any of
+// the Pool methods it calls fail.
 //
-// The only field that differs significantly from strategy to strategy is the
-// Rebalance function. The function is of type \func(p *pool.Pool, s *Strategy).
-// It takes in a Pool and a  Strategy. It can call any of the Pool methods and
-// it has access to all of the Pool and Strategy state. It make use of any
-// number of helper functions.
+// The Account holds the strategy's tokens and positions. It has a BurnAll
+// function that burns all of the strategy's positions and calculates the
+// tokens owed to the strategy, a Results function that returns the tokens that
+// the strategy has accumulated and the total amount of gas that the strategy
+// has spent and a Make function that initialises an account.
+//
+// Strategies are registered by name with Register (e.g. in the init function
+// of the package that defines them) and created by name with New. Strategies
+// with tunables implement Configurable, and their params are decoded from the
+// params object of strategy.txt by Configure.
 
 package strategy
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math/big"
+	"sort"
+	"sync"
 
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/constants"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/liquidityAmounts"
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/pool"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/tickMath"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/transaction"
 )
 
-// Map of strategy names to strategy rebalance functions.
-var strategies map[string]func(p *pool.Pool, s *Strategy)
+// Returned by New for a strategy that has not been registered.
+var ErrUnknownStrategy = errors.New("unknown strategy")
+
+// Map of strategy names to functions that create the strategy.
+var (
+	strategies   = make(map[string]func() Strategy)
+	strategiesMu sync.Mutex
+)
 
-// Intialises the strategies map.
+// Registers the built-in strategies.
 func init() {
-	strategies = make(map[string]func(p *pool.Pool, s *Strategy))
-	strategies["nil"] = NilStrategyRebalance
-	strategies["v2"] = V2StrategyRebalance
-	strategies["v2Reinvesting"] = V2StrategyReinvestingRebalance
+	Register("nil", func() Strategy { return &Nil{} })
+	Register("v2", func() Strategy { return &V2{} })
+	Register("v2Reinvesting", func() Strategy {
+		return &V2Reinvesting{params: V2ReinvestingParams{CompoundInterval: 1, GasToken: 1}}
+	})
+	Register("concentrated", func() Strategy {
+		return &Concentrated{params: ConcentratedParams{Width: 10}}
+	})
+}
+
+// Register makes a strategy available by name (e.g. to the strategy field of
+// strategy.txt). The function is called to create a new instance of the
+// strategy for each simulation, so strategies can keep state between hooks.
+// Panics if the name is already registered or the function is nil.
+//
+// Arguments:
+// name     -- The name of the strategy
+// makeFunc -- Returns a new instance of the strategy
+func Register(name string, makeFunc func() Strategy) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	if makeFunc == nil {
+		panic("strategy.Register: Function to make strategy " + name + " is nil")
+	}
+	if _, found := strategies[name]; found {
+		panic("strategy.Register: Strategy " + name + " is already registered")
+	}
+	strategies[name] = makeFunc
+}
+
+// New returns a new instance of the strategy registered with the given name.
+//
+// Arguments:
+// name     -- The name of the strategy
+//
+// Returns:
+// strategy -- The strategy
+// err      -- ErrUnknownStrategy if no strategy has the name
+func New(name string) (Strategy, error) {
+	strategiesMu.Lock()
+	makeFunc, found := strategies[name]
+	strategiesMu.Unlock()
+	if !found {
+		return nil, fmt.Errorf("strategy.New: %w %q (registered strategies: %v)", ErrUnknownStrategy, name, Names())
+	}
+	return makeFunc(), nil
+}
+
+// Names returns the names of the registered strategies, sorted.
+func Names() []string {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Strategy is implemented by strategies. Each hook is given a read-only
+// context, the pool and the strategy's account, and returns an error if any of
+// the pool methods it calls fail (which is handled according to the
+// simulation's error policy). Strategies that only need some of the hooks can
+// embed Base.
+type Strategy interface {
+	// Called once, before the first transaction is executed.
+	OnStart(ctx Context, p *pool.Pool, a *Account) error
+	// Called before the first transaction of each block is executed.
+	OnBlock(ctx Context, p *pool.Pool, a *Account) error
+	// Called before a transaction is executed if the account's update
+	// interval has been reached (after OnBlock).
+	OnRebalance(ctx Context, p *pool.Pool, a *Account) error
+	// Called before and after each transaction is executed (after
+	// OnRebalance). The transaction is executed even if the hook fails
+	// before it.
+	OnTransaction(ctx Context, phase Phase, p *pool.Pool, a *Account) error
+	// Called once, after the last transaction is executed (not if the
+	// simulation is stopped early).
+	OnEnd(ctx Context, p *pool.Pool, a *Account) error
+}
+
+// Phase distinguishes the calls of OnTransaction before and after the
+// transaction is executed.
+type Phase int
+
+const (
+	BeforeTransaction Phase = iota
+	AfterTransaction
+)
+
+// String returns the name of the phase.
+func (ph Phase) String() string {
+	if ph == AfterTransaction {
+		return "after"
+	}
+	return "before"
+}
+
+// Base implements every hook of Strategy by doing nothing. Strategies can
+// embed it and implement only the hooks they need.
+type Base struct{}
+
+func (Base) OnStart(ctx Context, p *pool.Pool, a *Account) error     { return nil }
+func (Base) OnBlock(ctx Context, p *pool.Pool, a *Account) error     { return nil }
+func (Base) OnRebalance(ctx Context, p *pool.Pool, a *Account) error { return nil }
+func (Base) OnEnd(ctx Context, p *pool.Pool, a *Account) error       { return nil }
+func (Base) OnTransaction(ctx Context, phase Phase, p *pool.Pool, a *Account) error {
+	return nil
+}
+
+// Reporter is implemented by strategies that keep statistics of their run,
+// e.g. how often they compounded. The statistics are written to
+// strategyAfter.txt along with the account's results.
+type Reporter interface {
+	Strategy
+	// Returns the statistics by name.
+	Report() map[string]int
 }
 
-// Used to decode strategy input from JSON.
+// Context describes when a hook is called. It is passed by value and only
+// exposes copies of the simulation's state, so hooks cannot change it.
+type Context struct {
+	blockNo     int
+	timestamp   int
+	txIndex     int
+	transaction *transaction.Transaction
+}
+
+// MakeContext returns the context of a hook called in the given block, at
+// the given transaction index. t is the transaction being executed (for
+// OnTransaction) or the last transaction executed (for the other hooks), or
+// nil if no transaction has been executed.
+func MakeContext(blockNo, timestamp, txIndex int, t *transaction.Transaction) Context {
+	ctx := Context{blockNo: blockNo, timestamp: timestamp, txIndex: txIndex}
+	if t != nil {
+		ctx.transaction = t.Copy()
+	}
+	return ctx
+}
+
+// Block returns the number of the current block.
+func (c Context) Block() int {
+	return c.blockNo
+}
+
+// Timestamp returns the timestamp of the current block.
+func (c Context) Timestamp() int {
+	return c.timestamp
+}
+
+// TxIndex returns the index of the transaction that is being (or is about to
+// be) executed, in the simulation's transactions.
+func (c Context) TxIndex() int {
+	return c.txIndex
+}
+
+// Transaction returns a copy of the transaction being executed (for
+// OnTransaction) or the last transaction executed (for the other hooks), and
+// false if no transaction has been executed.
+func (c Context) Transaction() (transaction.Transaction, bool) {
+	if c.transaction == nil {
+		return transaction.Transaction{}, false
+	}
+	return *c.transaction.Copy(), true
+}
+
+// Used to decode strategy input from JSON (see ParseInput).
 type StrategyInput struct {
 	Strategy       string   `json:"strategy"`
 	Amount0        *big.Int `json:"amount0"`
 	Amount1        *big.Int `json:"amount1"`
 	UpdateInterval int      `json:"updateInterval"`
+	// The strategy's params, decoded into the strategy's params by Configure.
+	Params json.RawMessage `json:"params,omitempty"`
 }
 
 // StrategyPosition represents a position held by a strategy.
 // Pools index positions using the owner's address, tickLower, and tickUpper, so
 // the strategy must keep track of these values (the owners address is the same
-// as the strategy address in the Strategy struct).
+// as the strategy address in the Account struct).
 type StrategyPosition struct {
 	TickLower int
 	TickUpper int
@@ -64,8 +248,8 @@ type GasAvs struct {
 	CollectGas *big.Int `json:"collectAv"`
 }
 
-// Strategy state.
-type Strategy struct {
+// Account holds the state of a strategy: its tokens, positions and gas used.
+type Account struct {
 	// Address of the strategy.
 	Address string
 	// Current amount of token0 and token1 held by the strategy (does NOT
@@ -77,50 +261,122 @@ type Strategy struct {
 	// The average gas required to perform each operation during the testing.
 	// period
 	GasAvs *GasAvs
-	// The number of blocks between each rebalance.
+	// The number of blocks between each rebalance (see
+	// Strategy.OnRebalance).
 	UpdateInterval int
 	// The positions held by the strategy
 	Positions []*StrategyPosition
-	// The function that is called to rebalance the strategy.
-	Rebalance func(p *pool.Pool, s *Strategy)
 }
 
 // Burns all of the strategy's positions and calculates the tokens owed to the
-// strategy.
-func (s *Strategy) BurnAll(p *pool.Pool) (amount0, amount1 *big.Int) {
-	for _, stratPos := range s.Positions {
-		p.Burn(s.Address, stratPos.TickLower, stratPos.TickUpper, stratPos.Liquidity)
-		s.GasUsed = new(big.Int).Add(s.GasUsed, s.GasAvs.BurnGas)
-		amount0, amount1 := p.Collect(s.Address, stratPos.TickLower, stratPos.TickUpper, constants.MaxUint256, constants.MaxUint256)
-		s.GasUsed = new(big.Int).Add(s.GasUsed, s.GasAvs.CollectGas)
-		s.Amount0 = new(big.Int).Add(s.Amount0, amount0)
-		s.Amount1 = new(big.Int).Add(s.Amount1, amount1)
+// strategy. Returns an error if a position cannot be burned or collected.
+func (a *Account) BurnAll(p *pool.Pool) (amount0, amount1 *big.Int, err error) {
+	for _, stratPos := range a.Positions {
+		if _, _, err = p.Burn(a.Address, stratPos.TickLower, stratPos.TickUpper, stratPos.Liquidity); err != nil {
+			return nil, nil, err
+		}
+		a.GasUsed = new(big.Int).Add(a.GasUsed, a.GasAvs.BurnGas)
+		amount0, amount1, err := p.Collect(a.Address, stratPos.TickLower, stratPos.TickUpper, constants.MaxUint256, constants.MaxUint256)
+		if err != nil {
+			return nil, nil, err
+		}
+		a.GasUsed = new(big.Int).Add(a.GasUsed, a.GasAvs.CollectGas)
+		a.Amount0 = new(big.Int).Add(a.Amount0, amount0)
+		a.Amount1 = new(big.Int).Add(a.Amount1, amount1)
 	}
-	amount0 = new(big.Int).Set(s.Amount0)
-	amount1 = new(big.Int).Set(s.Amount1)
-	s.Positions = *new([]*StrategyPosition)
+	amount0 = new(big.Int).Set(a.Amount0)
+	amount1 = new(big.Int).Set(a.Amount1)
+	a.Positions = *new([]*StrategyPosition)
 	return
 }
 
+// Mints as much liquidity over the given range as the strategy's tokens allow,
+// paying for it with the strategy's tokens and charging MintGas. The
+// liquidity is added to the strategy's position over the range, if it has
+// one. Does nothing if no liquidity can be minted.
+//
+// Arguments:
+// p         -- The pool
+// tickLower -- The lower tick of the position
+// tickUpper -- The upper tick of the position
+//
+// Returns:
+// liquidity -- The liquidity minted (zero if none was minted)
+// err       -- An error if the position could not be minted
+func (a *Account) Mint(p *pool.Pool, tickLower, tickUpper int) (liquidity *big.Int, err error) {
+	sqrtRatioAX96 := tickMath.GetSqrtRatioAtTick(tickLower)
+	sqrtRatioBX96 := tickMath.GetSqrtRatioAtTick(tickUpper)
+	liquidity = liquidityAmounts.GetLiquidityForAmounts(p.Slot0.SqrtPriceX96, sqrtRatioAX96, sqrtRatioBX96, a.Amount0, a.Amount1)
+
+	// The pool rounds the amounts owed up, so they can exceed the strategy's
+	// tokens by a wei, in which case mint a little less liquidity.
+	var amount0, amount1 *big.Int
+	for liquidity.Cmp(big.NewInt(0)) >= 1 {
+		snapshot := p.Snapshot()
+		amount0, amount1, err = p.Mint(a.Address, tickLower, tickUpper, liquidity)
+		if err != nil {
+			p.Discard(snapshot)
+			return nil, err
+		}
+		if amount0.Cmp(a.Amount0) <= 0 && amount1.Cmp(a.Amount1) <= 0 {
+			p.Discard(snapshot)
+			break
+		}
+		p.Restore(snapshot)
+		p.Discard(snapshot)
+		liquidity = new(big.Int).Sub(liquidity, big.NewInt(1))
+	}
+	if liquidity.Cmp(big.NewInt(0)) <= 0 {
+		return big.NewInt(0), nil
+	}
+
+	a.GasUsed = new(big.Int).Add(a.GasUsed, a.GasAvs.MintGas)
+	a.Amount0 = new(big.Int).Sub(a.Amount0, amount0)
+	a.Amount1 = new(big.Int).Sub(a.Amount1, amount1)
+	for _, stratPos := range a.Positions {
+		if stratPos.TickLower == tickLower && stratPos.TickUpper == tickUpper {
+			stratPos.Liquidity = new(big.Int).Add(stratPos.Liquidity, liquidity)
+			return liquidity, nil
+		}
+	}
+	a.Positions = append(a.Positions, &StrategyPosition{
+		TickLower: tickLower,
+		TickUpper: tickUpper,
+		Liquidity: liquidity,
+	})
+	return liquidity, nil
+}
+
 // Returns the tokens that the strategy has accumulated and the total amount of
 // gas that the strategy has spent.
-func (s *Strategy) Results(p *pool.Pool) (*big.Int, *big.Int, *big.Int) {
-	amount0temp, amount1temp := s.BurnAll(p)
-	s.Amount0 = new(big.Int).Set(amount0temp)
-	s.Amount1 = new(big.Int).Set(amount1temp)
-	return s.Amount0, s.Amount1, s.GasUsed
-}
-
-// Initialises a strategy.
-func Make(amount0, amount1 *big.Int, p *pool.Pool, g *GasAvs, identifier string, updateInterval int) *Strategy {
-	s := new(Strategy)
-	s.Address = "0x0000000000000000000000000000000000000001"
-	s.Amount0 = new(big.Int).Set(amount0)
-	s.Amount1 = new(big.Int).Set(amount1)
-	s.GasAvs = g
-	s.GasUsed = big.NewInt(0)
-	s.UpdateInterval = updateInterval
-	s.Positions = make([]*StrategyPosition, 0)
-	s.Rebalance = strategies[identifier]
-	return s
+func (a *Account) Results(p *pool.Pool) (*big.Int, *big.Int, *big.Int, error) {
+	amount0temp, amount1temp, err := a.BurnAll(p)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	a.Amount0 = new(big.Int).Set(amount0temp)
+	a.Amount1 = new(big.Int).Set(amount1temp)
+	return a.Amount0, a.Amount1, a.GasUsed, nil
+}
+
+// Returns the total liquidity of the strategy's positions.
+func (a *Account) Liquidity() *big.Int {
+	liquidity := big.NewInt(0)
+	for _, stratPos := range a.Positions {
+		liquidity.Add(liquidity, stratPos.Liquidity)
+	}
+	return liquidity
+}
+
+// Initialises the account of a strategy.
+func Make(amount0, amount1 *big.Int, g *GasAvs, updateInterval int) *Account {
+	a := new(Account)
+	a.Address = "0x0000000000000000000000000000000000000001"
+	a.Amount0 = new(big.Int).Set(amount0)
+	a.Amount1 = new(big.Int).Set(amount1)
+	a.GasAvs = g
+	a.GasUsed = big.NewInt(0)
+	a.UpdateInterval = updateInterval
+	a.Positions = make([]*StrategyPosition, 0)
+	return a
 }
@@ -0,0 +1,498 @@
+package strategy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/pool"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/tickMath"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/transaction"
+)
+
+// A strategy with state, so that instances can be told apart.
+type countingStrategy struct {
+	Base
+	rebalances int
+}
+
+func (c *countingStrategy) OnRebalance(ctx Context, p *pool.Pool, a *Account) error {
+	c.rebalances++
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	fmt.Println("Register: Makes strategies available by name to New")
+	Register("testStrategy", func() Strategy { return &countingStrategy{} })
+	s, err := New("testStrategy")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	s.OnRebalance(MakeContext(1, 0, 0, nil), nil, nil)
+	if other, _ := New("testStrategy"); other.(*countingStrategy).rebalances != 0 || s.(*countingStrategy).rebalances != 1 {
+		t.Errorf("Expected New to return a new instance of the strategy")
+	}
+	names := Names()
+	for _, name := range []string{"nil", "testStrategy", "v2", "v2Reinvesting"} {
+		found := false
+		for _, n := range names {
+			found = found || n == name
+		}
+		if !found {
+			t.Errorf("Expected %q in %q", name, names)
+		}
+	}
+	if _, err := New("unknown"); !errors.Is(err, ErrUnknownStrategy) {
+		t.Errorf("Expected ErrUnknownStrategy, got %v", err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected Register to panic for a duplicate name")
+		}
+	}()
+	Register("testStrategy", func() Strategy { return &Nil{} })
+}
+
+func TestContext(t *testing.T) {
+	fmt.Println("Context: Exposes a copy of the last transaction")
+	ctx := MakeContext(7, 70, 3, nil)
+	if _, found := ctx.Transaction(); found || ctx.Block() != 7 || ctx.Timestamp() != 70 || ctx.TxIndex() != 3 {
+		t.Errorf("Got %+v; want block 7, timestamp 70, index 3 and no transaction", ctx)
+	}
+	tx := transaction.Transaction{Method: "MINT"}
+	ctx = MakeContext(7, 70, 3, &tx)
+	tx.Method = "BURN"
+	if got, found := ctx.Transaction(); !found || got.Method != "MINT" {
+		t.Errorf("Got %+v, %v; want the MINT transaction", got, found)
+	}
+}
+
+func TestV2Rebalance(t *testing.T) {
+	fmt.Println("V2.OnRebalance: Mints a full range position once")
+	price, _ := new(big.Int).SetString("79228162514264337593543950336", 10)
+	p := pool.Make("0xA", "0xB", 3000, 60)
+	p.Initialize(price)
+	g := &GasAvs{MintGas: big.NewInt(100)}
+	a := Make(big.NewInt(1000000), big.NewInt(1000000), g, 1)
+	s, _ := New("v2")
+	for i := 0; i < 2; i++ {
+		if err := s.OnRebalance(MakeContext(1, 0, i, nil), p, a); err != nil {
+			t.Fatalf("OnRebalance failed: %v", err)
+		}
+	}
+	if len(a.Positions) != 1 || a.Positions[0].TickLower != -887220 || a.Positions[0].TickUpper != 887220 {
+		t.Fatalf("Got positions %+v; want one full range position", a.Positions)
+	}
+	if a.Liquidity().Cmp(big.NewInt(1000000)) != 0 || p.Liquidity.Cmp(a.Liquidity()) != 0 {
+		t.Errorf("Got liquidity %v (pool %v); want 1000000", a.Liquidity(), p.Liquidity)
+	}
+	if !reflect.DeepEqual(a.GasUsed, big.NewInt(100)) {
+		t.Errorf("Got gas used %v; want 100", a.GasUsed)
+	}
+}
+
+// The params of configurableStrategy.
+type testParams struct {
+	Width     int     `json:"width"`
+	Threshold float64 `json:"threshold"`
+}
+
+func (t *testParams) Validate() error {
+	if t.Width <= 0 {
+		return fmt.Errorf("width must be positive, got %d", t.Width)
+	}
+	return nil
+}
+
+// A strategy that takes params.
+type configurableStrategy struct {
+	Base
+	params testParams
+}
+
+func (c *configurableStrategy) Params() Params {
+	return &c.params
+}
+
+func TestConfigure(t *testing.T) {
+	fmt.Println("Configure: Decodes params into the strategy's params with defaults and validation")
+	makeStrategy := func() *configurableStrategy {
+		return &configurableStrategy{params: testParams{Width: 10, Threshold: 0.5}}
+	}
+	s := makeStrategy()
+	if err := Configure(s, nil); err != nil || s.params != (testParams{10, 0.5}) {
+		t.Errorf("Got params %+v, error %v; want the defaults", s.params, err)
+	}
+	s = makeStrategy()
+	if err := Configure(s, json.RawMessage(`{"width": 4}`)); err != nil || s.params != (testParams{4, 0.5}) {
+		t.Errorf("Got params %+v, error %v; want width 4 and the default threshold", s.params, err)
+	}
+	invalid := map[string]string{
+		`{"widht": 4}`:       `unknown param "widht" (known params: threshold, width)`,
+		`{"width": "4"}`:     `param "width" must be an integer, got string`,
+		`{"width": 1.5}`:     `param "width" must be an integer, got number 1.5`,
+		`[4]`:                `expected an object, got array`,
+		`{"width": 0}`:       `width must be positive, got 0`,
+		`{"threshold": tru}`: `invalid character`,
+		`{"width": 4} {}`:    `unexpected data after the params object`,
+		`{"width": 4}}`:      `unexpected data after the params object`,
+	}
+	for raw, want := range invalid {
+		err := Configure(makeStrategy(), json.RawMessage(raw))
+		if !errors.Is(err, ErrInvalidParams) || !strings.Contains(err.Error(), want) {
+			t.Errorf("Params %s: Got error %v; want ErrInvalidParams containing %q", raw, err, want)
+		}
+	}
+	if err := Configure(&V2{}, json.RawMessage(`{}`)); err != nil {
+		t.Errorf("Expected empty params to be accepted by a strategy without params, got %v", err)
+	}
+	if err := Configure(&V2{}, json.RawMessage(`{"width": 4}`)); !errors.Is(err, ErrInvalidParams) || !strings.Contains(err.Error(), "takes no params, got width") {
+		t.Errorf("Expected ErrInvalidParams for a strategy without params, got %v", err)
+	}
+}
+
+func TestParseInput(t *testing.T) {
+	fmt.Println("ParseInput: Decodes strategy.txt and reports unknown and invalid fields")
+	Register("testConfigurable", func() Strategy { return &configurableStrategy{params: testParams{Width: 10}} })
+	input, err := ParseInput([]byte(`{"strategy": "testConfigurable", "amount0": 33, "amount1": 48, "updateInterval": 1, "params": {"width": 2}}`))
+	if err != nil {
+		t.Fatalf("ParseInput failed: %v", err)
+	}
+	s, err := NewFromInput(input)
+	if err != nil || s.(*configurableStrategy).params.Width != 2 {
+		t.Errorf("Got strategy %+v, error %v; want width 2", s, err)
+	}
+	input.Params = json.RawMessage(`{"width": -1}`)
+	if _, err := NewFromInput(input); !errors.Is(err, ErrInvalidParams) || !strings.Contains(err.Error(), "testConfigurable") {
+		t.Errorf("Expected ErrInvalidParams naming the strategy, got %v", err)
+	}
+	invalid := map[string]string{
+		`{"strategy": "v2", "amount0": 1, "amount1": 1, "updateInterval": 1, "interval": 2}`:      `unknown field "interval"`,
+		`{"strategy": "v2", "amount0": 1, "amount1": 1, "updateInterval": "1"}`:                   `field "updateInterval" must be an integer, got string`,
+		`{"strategy": "v2", "amount0": 1, "amount1": 1}`:                                          `updateInterval must be positive`,
+		`{"strategy": "v2", "amount0": -1, "amount1": 1, "updateInterval": 1}`:                    `amount0 must be a non-negative integer`,
+		`{"amount0": 1, "amount1": 1, "updateInterval": 1}`:                                       `no strategy`,
+		`{"strategy": "v2", "amount0": 1, "amount1": 1, "updateInterval": 1} {"strategy": "nil"}`: `unexpected data after the input object`,
+		`{"strategy": "v2", "amount0": 1, "amount1": 1, "updateInterval": 1},`:                    `unexpected data after the input object`,
+	}
+	for raw, want := range invalid {
+		if _, err := ParseInput([]byte(raw)); !errors.Is(err, ErrInvalidInput) || !strings.Contains(err.Error(), want) {
+			t.Errorf("Input %s: Got error %v; want ErrInvalidInput containing %q", raw, err, want)
+		}
+	}
+}
+
+// Returns a pool at a price of 1 with a tick spacing of 60 and liquidity of
+// 10^24 over the full range, and an account with 10^18 of each token.
+func liquidPool(t *testing.T) (*pool.Pool, *Account) {
+	price, _ := new(big.Int).SetString("79228162514264337593543950336", 10)
+	p := pool.Make("0xA", "0xB", 3000, 60)
+	p.Initialize(price)
+	liquidity, _ := new(big.Int).SetString("1000000000000000000000000", 10)
+	if _, _, err := p.Mint("0xC", -887220, 887220, liquidity); err != nil {
+		t.Fatalf("Mint failed: %v", err)
+	}
+	g := &GasAvs{MintGas: big.NewInt(1), BurnGas: big.NewInt(10), SwapGas: big.NewInt(100), CollectGas: big.NewInt(1000)}
+	amount, _ := new(big.Int).SetString("1000000000000000000", 10)
+	return p, Make(amount, amount, g, 1)
+}
+
+func TestAccountMint(t *testing.T) {
+	fmt.Println("Account.Mint: Mints as much liquidity as the tokens allow and pays for it")
+	p, a := liquidPool(t)
+	balance0, balance1 := new(big.Int).Set(p.Balance0), new(big.Int).Set(p.Balance1)
+	liquidity, err := a.Mint(p, -600, 600)
+	if err != nil {
+		t.Fatalf("Mint failed: %v", err)
+	}
+	paid0 := new(big.Int).Sub(p.Balance0, balance0)
+	paid1 := new(big.Int).Sub(p.Balance1, balance1)
+	amount, _ := new(big.Int).SetString("1000000000000000000", 10)
+	if new(big.Int).Add(a.Amount0, paid0).Cmp(amount) != 0 || new(big.Int).Add(a.Amount1, paid1).Cmp(amount) != 0 {
+		t.Errorf("Expected the account to pay %v, %v; has %v, %v left", paid0, paid1, a.Amount0, a.Amount1)
+	}
+	if a.Amount0.Sign() < 0 || a.Amount1.Sign() < 0 || (a.Amount0.Sign() > 0 && a.Amount1.Sign() > 0) {
+		t.Errorf("Expected one token to be used up, got %v, %v", a.Amount0, a.Amount1)
+	}
+	if len(a.Positions) != 1 || a.Positions[0].Liquidity.Cmp(liquidity) != 0 || a.GasUsed.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("Got positions %+v, gas %v; want one position of %v, gas 1", a.Positions, a.GasUsed, liquidity)
+	}
+
+	// Minting with the leftover tokens adds to the same position.
+	a.Amount0, a.Amount1 = new(big.Int).Add(a.Amount0, amount), new(big.Int).Add(a.Amount1, amount)
+	more, err := a.Mint(p, -600, 600)
+	if err != nil || len(a.Positions) != 1 || a.Positions[0].Liquidity.Cmp(new(big.Int).Add(liquidity, more)) != 0 {
+		t.Errorf("Got positions %+v, error %v; want one position of %v", a.Positions, err, new(big.Int).Add(liquidity, more))
+	}
+}
+
+func TestConcentratedRange(t *testing.T) {
+	fmt.Println("ConcentratedRange: Aligns the range to the tick spacing around the tick")
+	tests := []struct {
+		tick, width, lower, upper int
+	}{
+		{0, 10, -600, 600},
+		{59, 1, -60, 60},
+		{-1, 1, -120, 0},
+		{-60, 2, -180, 60},
+		{-887000, 10, -887220, -886440},
+		{887000, 10, 886380, 887220},
+	}
+	for _, test := range tests {
+		lower, upper := ConcentratedRange(test.tick, 60, test.width)
+		if lower != test.lower || upper != test.upper {
+			t.Errorf("Tick %d, width %d: Got %d, %d; want %d, %d", test.tick, test.width, lower, upper, test.lower, test.upper)
+		}
+	}
+}
+
+func TestConcentratedRebalance(t *testing.T) {
+	fmt.Println("Concentrated.OnRebalance: Moves the position when the price leaves the range")
+	p, a := liquidPool(t)
+	s, _ := New("concentrated")
+	if err := Configure(s, json.RawMessage(`{"width": 2, "buffer": 30}`)); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	ctx := MakeContext(1, 0, 0, nil)
+	if err := s.OnRebalance(ctx, p, a); err != nil {
+		t.Fatalf("OnRebalance failed: %v", err)
+	}
+	if len(a.Positions) != 1 || a.Positions[0].TickLower != -120 || a.Positions[0].TickUpper != 120 {
+		t.Fatalf("Got positions %+v; want one position over -120, 120", a.Positions)
+	}
+
+	// Move the price just outside the range, but inside the buffer.
+	swap := func(zeroForOne bool, sqrtPriceLimitX96 *big.Int) {
+		amount, _ := new(big.Int).SetString("1000000000000000000000000", 10)
+		if _, _, err := p.Swap("0xD", "0xD", zeroForOne, amount, sqrtPriceLimitX96); err != nil {
+			t.Fatalf("Swap failed: %v", err)
+		}
+	}
+	swap(false, tickMath.GetSqrtRatioAtTick(130))
+	gasUsed := new(big.Int).Set(a.GasUsed)
+	if err := s.OnRebalance(ctx, p, a); err != nil || a.Positions[0].TickLower != -120 || a.GasUsed.Cmp(gasUsed) != 0 {
+		t.Errorf("Expected no rebalance inside the buffer, got positions %+v, error %v", a.Positions, err)
+	}
+
+	// Move the price outside the buffer.
+	swap(false, tickMath.GetSqrtRatioAtTick(1000))
+	if err := s.OnRebalance(ctx, p, a); err != nil {
+		t.Fatalf("OnRebalance failed: %v", err)
+	}
+	if len(a.Positions) != 1 || a.Positions[0].TickLower != 840 || a.Positions[0].TickUpper != 1080 {
+		t.Errorf("Got positions %+v; want one position over 840, 1080", a.Positions)
+	}
+	// Burned, collected, swapped and minted.
+	if expected := new(big.Int).Add(gasUsed, big.NewInt(10+1000+100+1)); a.GasUsed.Cmp(expected) != 0 {
+		t.Errorf("Got gas used %v; want %v", a.GasUsed, expected)
+	}
+	if a.Amount0.Sign() < 0 || a.Amount1.Sign() < 0 {
+		t.Errorf("Got negative amounts %v, %v", a.Amount0, a.Amount1)
+	}
+	// The swap takes its fee and price impact into account, so few tokens
+	// are unused.
+	leftover := big.NewInt(1000)
+	if a.Amount0.Cmp(leftover) >= 0 || a.Amount1.Cmp(leftover) >= 0 {
+		t.Errorf("Got unused amounts %v, %v; want less than %v", a.Amount0, a.Amount1, leftover)
+	}
+	if position, _ := p.Position(pool.PositionKey{Owner: a.Address, TickLower: 840, TickUpper: 1080}); position == nil || position.Liquidity.Cmp(a.Positions[0].Liquidity) != 0 {
+		t.Errorf("Expected the position to be minted in the pool, got %+v", position)
+	}
+}
+
+func TestSwapToRatio(t *testing.T) {
+	fmt.Println("SwapToRatio: Swaps to the ratio a range requires after the swap's fee and price impact")
+	p, a := liquidPool(t)
+	amount0, amount1, err := SwapToRatio(p, a, 600, 1200)
+	if err != nil {
+		t.Fatalf("SwapToRatio failed: %v", err)
+	}
+	// The range is above the price, so only token0 is required.
+	if amount0.Sign() >= 0 || amount1.Sign() <= 0 || a.Amount1.Cmp(big.NewInt(1000)) >= 0 {
+		t.Errorf("Got pool deltas %v, %v, account %v, %v; want token1 swapped for token0", amount0, amount1, a.Amount0, a.Amount1)
+	}
+	if a.GasUsed.Cmp(big.NewInt(100)) != 0 {
+		t.Errorf("Got gas used %v; want 100", a.GasUsed)
+	}
+
+	// A range around the price requires both tokens.
+	p, a = liquidPool(t)
+	a.Amount1 = big.NewInt(0)
+	if _, _, err := SwapToRatio(p, a, -1200, 600); err != nil {
+		t.Fatalf("SwapToRatio failed: %v", err)
+	}
+	if _, err := a.Mint(p, -1200, 600); err != nil {
+		t.Fatalf("Mint failed: %v", err)
+	}
+	leftover := big.NewInt(1000)
+	if a.Amount0.Cmp(leftover) >= 0 || a.Amount1.Cmp(leftover) >= 0 {
+		t.Errorf("Got unused amounts %v, %v; want less than %v", a.Amount0, a.Amount1, leftover)
+	}
+
+	// Nothing is swapped if the tokens are already in the right ratio.
+	gasUsed := new(big.Int).Set(a.GasUsed)
+	amount0, amount1, err = SwapToRatio(p, a, -1200, 600)
+	if err != nil || amount0.Sign() != 0 || amount1.Sign() != 0 || a.GasUsed.Cmp(gasUsed) != 0 {
+		t.Errorf("Got pool deltas %v, %v, error %v; want no swap", amount0, amount1, err)
+	}
+}
+
+// Swaps back and forth on the pool so that positions in range earn fees in
+// both tokens.
+func earnFees(t *testing.T, p *pool.Pool) {
+	amount, _ := new(big.Int).SetString("100000000000000000000", 10)
+	for _, zeroForOne := range []bool{true, false} {
+		limit := tickMath.GetSqrtRatioAtTick(-100)
+		if !zeroForOne {
+			limit = tickMath.GetSqrtRatioAtTick(100)
+		}
+		if _, _, err := p.Swap("0xD", "0xD", zeroForOne, amount, limit); err != nil {
+			t.Fatalf("Swap failed: %v", err)
+		}
+	}
+}
+
+func TestV2ReinvestingCompounds(t *testing.T) {
+	fmt.Println("V2Reinvesting.OnRebalance: Compounds fees at the compound interval if they cover the gas")
+	p, a := liquidPool(t)
+	s, _ := New("v2Reinvesting")
+	if err := Configure(s, json.RawMessage(`{"compoundInterval": 2}`)); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	v := s.(*V2Reinvesting)
+	if err := s.OnRebalance(MakeContext(1, 0, 0, nil), p, a); err != nil {
+		t.Fatalf("OnRebalance failed: %v", err)
+	}
+	liquidity := new(big.Int).Set(a.Liquidity())
+	earnFees(t, p)
+	fees0, fees1, err := PeekFees(p, a.Address, -887220, 887220)
+	if err != nil || fees0.Sign() <= 0 || fees1.Sign() <= 0 {
+		t.Fatalf("Got fees %v, %v, error %v; want fees in both tokens", fees0, fees1, err)
+	}
+
+	// Too early.
+	tx := transaction.Transaction{GasPrice: 1}
+	gasUsed := new(big.Int).Set(a.GasUsed)
+	if err := s.OnRebalance(MakeContext(2, 0, 1, &tx), p, a); err != nil || v.compounds != 0 || a.GasUsed.Cmp(gasUsed) != 0 {
+		t.Errorf("Expected no compound before the interval, got %d compounds, error %v", v.compounds, err)
+	}
+
+	// The fees are collected and added to the position, and the strategy's
+	// tokens plus the pool's are unchanged (the fees are not counted twice).
+	tx.GasPrice = 1
+	total0 := new(big.Int).Add(a.Amount0, p.Balance0)
+	total1 := new(big.Int).Add(a.Amount1, p.Balance1)
+	if err := s.OnRebalance(MakeContext(3, 0, 2, &tx), p, a); err != nil || v.compounds != 1 {
+		t.Fatalf("Expected a compound, got %d compounds, error %v", v.compounds, err)
+	}
+	if len(a.Positions) != 1 || a.Liquidity().Cmp(liquidity) <= 0 {
+		t.Errorf("Got positions %+v; want one position with more than %v liquidity", a.Positions, liquidity)
+	}
+	if new(big.Int).Add(a.Amount0, p.Balance0).Cmp(total0) != 0 || new(big.Int).Add(a.Amount1, p.Balance1).Cmp(total1) != 0 {
+		t.Errorf("Got totals %v, %v; want %v, %v", new(big.Int).Add(a.Amount0, p.Balance0), new(big.Int).Add(a.Amount1, p.Balance1), total0, total1)
+	}
+	if position, _ := p.Position(pool.PositionKey{Owner: a.Address, TickLower: -887220, TickUpper: 887220}); position.TokensOwed0.Sign() != 0 || position.TokensOwed1.Sign() != 0 {
+		t.Errorf("Expected the fees to be collected, got %v, %v owed", position.TokensOwed0, position.TokensOwed1)
+	}
+	// Burned (poked), collected, swapped (if needed) and minted.
+	if added := new(big.Int).Sub(a.GasUsed, gasUsed); added.Cmp(big.NewInt(10+1000+1)) != 0 && added.Cmp(big.NewInt(10+1000+100+1)) != 0 {
+		t.Errorf("Got gas used %v; want 1011 or 1111", added)
+	}
+
+	// Once the gas costs more than the fees the strategy stops compounding,
+	// even if the gas later costs less.
+	earnFees(t, p)
+	tx.GasPrice = 1000000000000
+	gasUsed = new(big.Int).Set(a.GasUsed)
+	if err := s.OnRebalance(MakeContext(5, 0, 3, &tx), p, a); err != nil || v.compounds != 1 || v.stoppedAt != 5 || a.GasUsed.Cmp(gasUsed) != 0 {
+		t.Errorf("Expected the strategy to stop compounding at block 5, got %d compounds, stopped at %d, error %v", v.compounds, v.stoppedAt, err)
+	}
+	tx.GasPrice = 1
+	if err := s.OnRebalance(MakeContext(7, 0, 4, &tx), p, a); err != nil || v.compounds != 1 || a.GasUsed.Cmp(gasUsed) != 0 {
+		t.Errorf("Expected no compound after stopping, got %d compounds, error %v", v.compounds, err)
+	}
+	if report := v.Report(); !reflect.DeepEqual(report, map[string]int{"compounds": 1, "stoppedAtBlock": 5}) {
+		t.Errorf("Got report %v; want 1 compound, stopped at block 5", report)
+	}
+}
+
+func TestV2ReinvestingSwapGas(t *testing.T) {
+	fmt.Println("V2Reinvesting.OnRebalance: Only counts the gas of a swap if the fees would be swapped")
+	// Returns a strategy with a full range position that has earned fees,
+	// and a gas price at which the fees cover the gas of compounding without
+	// a swap (1011) but not with one (1111).
+	setup := func() (*pool.Pool, *Account, *V2Reinvesting, *transaction.Transaction) {
+		p, a := liquidPool(t)
+		s, _ := New("v2Reinvesting")
+		if err := s.OnRebalance(MakeContext(1, 0, 0, nil), p, a); err != nil {
+			t.Fatalf("OnRebalance failed: %v", err)
+		}
+		earnFees(t, p)
+		fees0, fees1, err := PeekFees(p, a.Address, -887220, 887220)
+		if err != nil {
+			t.Fatalf("PeekFees failed: %v", err)
+		}
+		fees := valueIn(p.Slot0.SqrtPriceX96, fees0, fees1, 1)
+		return p, a, s.(*V2Reinvesting), &transaction.Transaction{GasPrice: int(new(big.Int).Div(fees, big.NewInt(1061)).Int64())}
+	}
+
+	// The fees alone are not in the full range ratio, so they would be
+	// swapped.
+	p, a, v, tx := setup()
+	if err := v.OnRebalance(MakeContext(2, 0, 1, tx), p, a); err != nil || v.compounds != 0 || v.stoppedAt != 2 {
+		t.Errorf("Expected the strategy to stop compounding, got %d compounds, stopped at %d, error %v", v.compounds, v.stoppedAt, err)
+	}
+
+	// With some token1 left over from earlier the fees need not be swapped.
+	p, a, v, tx = setup()
+	fees0, fees1, _ := PeekFees(p, a.Address, -887220, 887220)
+	_, amountIn, err := ratioSwap(p, fees0, fees1, -887220, 887220)
+	if err != nil {
+		t.Fatalf("ratioSwap failed: %v", err)
+	}
+	// About twice the token0 that would be swapped balances the fees.
+	a.Amount1 = new(big.Int).Lsh(amountIn, 1)
+	for i := 0; ; i++ {
+		if _, amountIn, _ := ratioSwap(p, fees0, new(big.Int).Add(fees1, a.Amount1), -887220, 887220); amountIn.Sign() == 0 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("Expected some amount of token1 to balance the fees")
+		}
+		a.Amount1.Sub(a.Amount1, big.NewInt(1))
+	}
+	gasUsed := new(big.Int).Set(a.GasUsed)
+	if err := v.OnRebalance(MakeContext(2, 0, 1, tx), p, a); err != nil || v.compounds != 1 || v.stoppedAt != 0 {
+		t.Fatalf("Expected a compound, got %d compounds, stopped at %d, error %v", v.compounds, v.stoppedAt, err)
+	}
+	if added := new(big.Int).Sub(a.GasUsed, gasUsed); added.Cmp(big.NewInt(1011)) != 0 {
+		t.Errorf("Got gas used %v; want 1011", added)
+	}
+}
+
+func TestV2ReinvestingSwapsBeforeMint(t *testing.T) {
+	fmt.Println("V2Reinvesting.OnRebalance: Swaps to the full range ratio before the first mint")
+	p, _ := liquidPool(t)
+	amount, _ := new(big.Int).SetString("1000000000000000000", 10)
+	a := Make(amount, big.NewInt(0), &GasAvs{MintGas: big.NewInt(1), SwapGas: big.NewInt(100)}, 1)
+	s, _ := New("v2Reinvesting")
+	if err := s.OnRebalance(MakeContext(1, 0, 0, nil), p, a); err != nil {
+		t.Fatalf("OnRebalance failed: %v", err)
+	}
+	if len(a.Positions) != 1 || a.Liquidity().Sign() <= 0 {
+		t.Fatalf("Got positions %+v; want one position with liquidity", a.Positions)
+	}
+	// About half of the token0 is swapped and almost all of the rest is
+	// minted.
+	dust := big.NewInt(1000000000)
+	if a.Amount0.Cmp(dust) >= 0 || a.Amount1.Cmp(dust) >= 0 {
+		t.Errorf("Got %v, %v left; want less than %v of each", a.Amount0, a.Amount1, dust)
+	}
+	if a.GasUsed.Cmp(big.NewInt(101)) != 0 {
+		t.Errorf("Got gas used %v; want 101", a.GasUsed)
+	}
+}
@@ -0,0 +1,157 @@
+package strategy
+
+import (
+	"math/big"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/constants"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/liquidityAmounts"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/pool"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/quoter"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/tickMath"
+)
+
+// SwapToRatio swaps the strategy's tokens, as the strategy's address, so that
+// they are in the ratio of token0 to token1 that a position over the given
+// range requires, i.e. so that as much liquidity as possible can be minted
+// over the range after the swap (see Account.Mint). The swap is sized against
+// the pool in its current state (see the quoter package), so the swap's fee
+// and its impact on the price (and so on the ratio that the range requires)
+// are taken into account. Does not swap if swapping would not increase the
+// liquidity that can be minted. Charges SwapGas if a swap is executed.
+//
+// Arguments:
+// p         -- The pool
+// a         -- The strategy's account
+// tickLower -- The lower tick of the range
+// tickUpper -- The upper tick of the range
+//
+// Returns:
+// amount0   -- The delta of the balance of token0 of the pool (see
+//              pool.Swap), zero if no swap was needed
+// amount1   -- The delta of the balance of token1 of the pool
+// err       -- An error if the swap could not be executed
+func SwapToRatio(p *pool.Pool, a *Account, tickLower, tickUpper int) (amount0, amount1 *big.Int, err error) {
+	zeroForOne, amountIn, err := ratioSwap(p, a.Amount0, a.Amount1, tickLower, tickUpper)
+	if err != nil {
+		return nil, nil, err
+	}
+	if amountIn.Cmp(big.NewInt(0)) <= 0 {
+		return big.NewInt(0), big.NewInt(0), nil
+	}
+	amount0, amount1, err = p.Swap(a.Address, a.Address, zeroForOne, amountIn, ratioSwapPriceLimit(zeroForOne))
+	if err != nil {
+		return nil, nil, err
+	}
+	a.GasUsed = new(big.Int).Add(a.GasUsed, a.GasAvs.SwapGas)
+	a.Amount0 = new(big.Int).Sub(a.Amount0, amount0)
+	a.Amount1 = new(big.Int).Sub(a.Amount1, amount1)
+	return amount0, amount1, nil
+}
+
+// Returns the direction and the exact input of the swap that SwapToRatio
+// would execute for the given amounts of token0 and token1, without changing
+// the pool. The amount in is zero if SwapToRatio would not swap.
+func ratioSwap(p *pool.Pool, amount0, amount1 *big.Int, tickLower, tickUpper int) (zeroForOne bool, amountIn *big.Int, err error) {
+	// Without liquidity in range a swap would only move the price.
+	if p.Liquidity.Cmp(big.NewInt(0)) <= 0 {
+		return false, big.NewInt(0), nil
+	}
+	sqrtRatioAX96 := tickMath.GetSqrtRatioAtTick(tickLower)
+	sqrtRatioBX96 := tickMath.GetSqrtRatioAtTick(tickUpper)
+
+	// Swap the token that is in excess at the current price.
+	excess0 := excessValue(p.Slot0.SqrtPriceX96, sqrtRatioAX96, sqrtRatioBX96, amount0, amount1)
+	if excess0.Cmp(big.NewInt(0)) == 0 {
+		return false, big.NewInt(0), nil
+	}
+	zeroForOne = excess0.Cmp(big.NewInt(0)) >= 1
+	balanceIn := amount1
+	if zeroForOne {
+		balanceIn = amount0
+	}
+	sqrtPriceLimitX96 := ratioSwapPriceLimit(zeroForOne)
+
+	// Returns the price and the strategy's tokens after swapping amountIn of
+	// the input token.
+	quoteSwap := func(amountIn *big.Int) (sqrtPriceX96, balance0, balance1 *big.Int, err error) {
+		q, err := quoter.QuoteExactInput(p, zeroForOne, amountIn, sqrtPriceLimitX96)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if zeroForOne {
+			return q.SqrtPriceX96After, new(big.Int).Sub(amount0, q.AmountIn), new(big.Int).Add(amount1, q.AmountOut), nil
+		}
+		return q.SqrtPriceX96After, new(big.Int).Add(amount0, q.AmountOut), new(big.Int).Sub(amount1, q.AmountIn), nil
+	}
+	// Returns true iff the input token is still in excess after swapping
+	// amountIn of it.
+	inExcessAfter := func(amountIn *big.Int) (bool, error) {
+		sqrtPriceX96, balance0, balance1, err := quoteSwap(amountIn)
+		if err != nil {
+			return false, err
+		}
+		excess0 := excessValue(sqrtPriceX96, sqrtRatioAX96, sqrtRatioBX96, balance0, balance1)
+		if zeroForOne {
+			return excess0.Cmp(big.NewInt(0)) >= 1, nil
+		}
+		return excess0.Cmp(big.NewInt(0)) <= -1, nil
+	}
+
+	// The input token is in excess after swapping nothing. Find the largest
+	// amount after which it is still in excess, which is at most a wei from
+	// the amount after which neither token is in excess.
+	lo, hi := big.NewInt(0), new(big.Int).Set(balanceIn)
+	if inExcess, err := inExcessAfter(hi); err != nil {
+		return false, nil, err
+	} else if inExcess {
+		lo = hi
+	}
+	for new(big.Int).Sub(hi, lo).Cmp(big.NewInt(1)) >= 1 {
+		mid := new(big.Int).Rsh(new(big.Int).Add(lo, hi), 1)
+		inExcess, err := inExcessAfter(mid)
+		if err != nil {
+			return false, nil, err
+		}
+		if inExcess {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	if lo.Cmp(big.NewInt(0)) <= 0 {
+		return false, big.NewInt(0), nil
+	}
+	// Don't swap if the swap does not increase the liquidity that can be
+	// minted (e.g. if only a few wei are in excess).
+	sqrtPriceX96, balance0, balance1, err := quoteSwap(lo)
+	if err != nil {
+		return false, nil, err
+	}
+	liquidityBefore := liquidityAmounts.GetLiquidityForAmounts(p.Slot0.SqrtPriceX96, sqrtRatioAX96, sqrtRatioBX96, amount0, amount1)
+	liquidityAfter := liquidityAmounts.GetLiquidityForAmounts(sqrtPriceX96, sqrtRatioAX96, sqrtRatioBX96, balance0, balance1)
+	if liquidityAfter.Cmp(liquidityBefore) <= 0 {
+		return false, big.NewInt(0), nil
+	}
+	return zeroForOne, lo, nil
+}
+
+// Returns the price limit of a swap to the ratio, i.e. no limit.
+func ratioSwapPriceLimit(zeroForOne bool) *big.Int {
+	if zeroForOne {
+		return new(big.Int).Add(constants.MinSqrtRatioBig, big.NewInt(1))
+	}
+	return new(big.Int).Sub(constants.MaxSqrtRatio, big.NewInt(1))
+}
+
+// Returns the value (in token1, times 2^192) of the token0 that would be left
+// after minting as much liquidity as possible over the range at the given
+// price, minus that of the token1 that would be left. Positive iff token0 is
+// in excess, negative iff token1 is.
+func excessValue(sqrtPriceX96, sqrtRatioAX96, sqrtRatioBX96, amount0, amount1 *big.Int) *big.Int {
+	liquidity := liquidityAmounts.GetLiquidityForAmounts(sqrtPriceX96, sqrtRatioAX96, sqrtRatioBX96, amount0, amount1)
+	used0, used1 := liquidityAmounts.GetAmountsForLiquidity(sqrtPriceX96, sqrtRatioAX96, sqrtRatioBX96, liquidity)
+	priceX192 := new(big.Int).Mul(sqrtPriceX96, sqrtPriceX96)
+	value0 := new(big.Int).Mul(new(big.Int).Sub(amount0, used0), priceX192)
+	value1 := new(big.Int).Lsh(new(big.Int).Sub(amount1, used1), 192)
+	return value0.Sub(value0, value1)
+}
@@ -4,41 +4,32 @@
 package strategy
 
 import (
-	"math/big"
-
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/constants"
-	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/liquidityAmounts"
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/pool"
-	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/tickMath"
 )
 
-func V2StrategyRebalance(p *pool.Pool, s *Strategy) {
+// V2 is the v2 strategy.
+type V2 struct {
+	Base
+}
+
+func (V2) OnRebalance(ctx Context, p *pool.Pool, a *Account) error {
 	// Only rebalance once, when the strategy is first created.
-	if len(s.Positions) == 0 {
-		V2StrategyMintPosition(p, s)
+	if len(a.Positions) == 0 {
+		return V2StrategyMintPosition(p, a)
 	}
-	return
+	return nil
 }
 
-func V2StrategyMintPosition(p *pool.Pool, s *Strategy) {
-	s.GasUsed = new(big.Int).Add(s.GasUsed, s.GasAvs.MintGas)
-	tickLower := constants.MinTick
-	tickUpper := constants.MaxTick
-	sqrtRatioAX96 := tickMath.GetSqrtRatioAtTick(tickLower)
-	sqrtRatioBX96 := tickMath.GetSqrtRatioAtTick(tickUpper)
-
-	// Calculate the amount of liquidity to mint.
-	liquidity := liquidityAmounts.GetLiquidityForAmounts(p.Slot0.SqrtPriceX96, sqrtRatioAX96, sqrtRatioBX96, s.Amount0, s.Amount1)
-	if liquidity.Cmp(big.NewInt(0)) <= 0 {
-		return
-	}
+// Mints a position over the entire tick range with the account's tokens.
+func V2StrategyMintPosition(p *pool.Pool, a *Account) error {
+	tickLower, tickUpper := FullRange(p.TickSpacing)
+	_, err := a.Mint(p, tickLower, tickUpper)
+	return err
+}
 
-	// Mint the position.
-	p.Mint(s.Address, tickLower, tickUpper, liquidity)
-	// Add the position to the strategy's positions slice.
-	s.Positions = append(s.Positions, &StrategyPosition{
-		TickLower: tickLower,
-		TickUpper: tickUpper,
-		Liquidity: liquidity,
-	})
+// Returns the lowest and highest usable ticks, i.e. the full range.
+// Positions must be on ticks that are multiples of the pool's tick spacing.
+func FullRange(tickSpacing int) (tickLower, tickUpper int) {
+	return (constants.MinTick / tickSpacing) * tickSpacing, (constants.MaxTick / tickSpacing) * tickSpacing
 }
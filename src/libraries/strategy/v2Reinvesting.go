@@ -1,20 +1,182 @@
-// The v2 reinvesting strategy is the similar to the v2 strategy, but it
-// reinvests the fees collected from the position it holds at updateInterval.
-// This code is not finished and has not been tested.
+// The v2 reinvesting strategy is similar to the v2 strategy (although it
+// swaps its tokens to the ratio the full range requires before its first
+// mint), but it periodically compounds the fees earned by its position: it pokes the
+// position (burns zero liquidity) so that the fees owed to it are updated,
+// collects them, swaps them to the ratio the full range requires and adds
+// them to the position's liquidity. Once the gas cost of a compound exceeds
+// the fees it would collect, the strategy stops compounding and just holds
+// its position.
 package strategy
 
 import (
+	"fmt"
 	"math/big"
 
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/constants"
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/pool"
 )
 
-func V2StrategyReinvestingRebalance(p *pool.Pool, s *Strategy) {
-	// Probably better to set aside a little bit of the pool's liquidity for
-	// and, instead of burning all liquidity, mint a little bit (to recalculate
-	// tokens owed) and then collect and reinvest the rest.
-	amount0temp, amount1temp := s.BurnAll(p)
-	s.Amount0 = new(big.Int).Add(s.Amount0, amount0temp)
-	s.Amount1 = new(big.Int).Add(s.Amount1, amount1temp)
-	V2StrategyMintPosition(p, s)
+// V2ReinvestingParams are the params of the v2 reinvesting strategy.
+type V2ReinvestingParams struct {
+	// The minimum number of blocks between compounds. Compounds only happen
+	// when the strategy rebalances, so the cadence is also limited by
+	// updateInterval.
+	CompoundInterval int `json:"compoundInterval"`
+	// The token (0 or 1) in which gas is paid, i.e. wrapped ether, used to
+	// compare the gas cost of compounding with the fees collected.
+	GasToken int `json:"gasToken"`
+}
+
+// Validate returns an error if the compound interval is not positive or the
+// gas token is not 0 or 1.
+func (v *V2ReinvestingParams) Validate() error {
+	if v.CompoundInterval <= 0 {
+		return fmt.Errorf("compoundInterval must be positive, got %d", v.CompoundInterval)
+	}
+	if v.GasToken != 0 && v.GasToken != 1 {
+		return fmt.Errorf("gasToken must be 0 or 1, got %d", v.GasToken)
+	}
+	return nil
+}
+
+// V2Reinvesting is the v2 reinvesting strategy.
+type V2Reinvesting struct {
+	Base
+	params V2ReinvestingParams
+	// The block of the last compound (or of the first mint).
+	lastCompound int
+	// The number of compounds.
+	compounds int
+	// The block at which the strategy stopped compounding because the gas
+	// cost exceeded the fees, or 0 if it has not stopped.
+	stoppedAt int
+}
+
+// Params returns the strategy's params.
+func (v *V2Reinvesting) Params() Params {
+	return &v.params
+}
+
+// Report returns the number of compounds, and the block at which the
+// strategy stopped compounding (0 if it did not stop).
+func (v *V2Reinvesting) Report() map[string]int {
+	return map[string]int{"compounds": v.compounds, "stoppedAtBlock": v.stoppedAt}
+}
+
+// Mints a full range position (after swapping the strategy's tokens to the
+// ratio it requires) if the strategy has none, otherwise compounds the
+// position's fees if the compound interval has been reached and the strategy
+// has not stopped compounding.
+func (v *V2Reinvesting) OnRebalance(ctx Context, p *pool.Pool, a *Account) error {
+	tickLower, tickUpper := FullRange(p.TickSpacing)
+	if len(a.Positions) == 0 {
+		v.lastCompound = ctx.Block()
+		if _, _, err := SwapToRatio(p, a, tickLower, tickUpper); err != nil {
+			return err
+		}
+		_, err := a.Mint(p, tickLower, tickUpper)
+		return err
+	}
+	if v.stoppedAt != 0 || ctx.Block()-v.lastCompound < v.params.CompoundInterval {
+		return nil
+	}
+
+	// Compare the fees that would be collected with the gas cost of
+	// compounding at the gas price of the last transaction. There is nothing
+	// to compound until the position has earned fees.
+	fees0, fees1, err := PeekFees(p, a.Address, tickLower, tickUpper)
+	if err != nil {
+		return err
+	}
+	fees := valueIn(p.Slot0.SqrtPriceX96, fees0, fees1, v.params.GasToken)
+	if fees.Cmp(big.NewInt(0)) <= 0 {
+		return nil
+	}
+	gasPrice := big.NewInt(0)
+	if t, found := ctx.Transaction(); found {
+		gasPrice = big.NewInt(int64(t.GasPrice))
+	}
+	gas := new(big.Int).Add(a.GasAvs.BurnGas, a.GasAvs.CollectGas)
+	gas.Add(gas, a.GasAvs.MintGas)
+	// Poking the position does not change the pool's price or liquidity, so
+	// whether the fees are swapped can be decided before collecting them.
+	_, amountIn, err := ratioSwap(p, new(big.Int).Add(a.Amount0, fees0), new(big.Int).Add(a.Amount1, fees1), tickLower, tickUpper)
+	if err != nil {
+		return err
+	}
+	if amountIn.Cmp(big.NewInt(0)) >= 1 {
+		gas.Add(gas, a.GasAvs.SwapGas)
+	}
+	if new(big.Int).Mul(gas, gasPrice).Cmp(fees) >= 1 {
+		v.stoppedAt = ctx.Block()
+		return nil
+	}
+
+	// Poke the position and collect the fees.
+	if _, _, err := p.Burn(a.Address, tickLower, tickUpper, big.NewInt(0)); err != nil {
+		return err
+	}
+	a.GasUsed = new(big.Int).Add(a.GasUsed, a.GasAvs.BurnGas)
+	amount0, amount1, err := p.Collect(a.Address, tickLower, tickUpper, constants.MaxUint256, constants.MaxUint256)
+	if err != nil {
+		return err
+	}
+	a.GasUsed = new(big.Int).Add(a.GasUsed, a.GasAvs.CollectGas)
+	a.Amount0 = new(big.Int).Add(a.Amount0, amount0)
+	a.Amount1 = new(big.Int).Add(a.Amount1, amount1)
+
+	// Add the fees (and any tokens left over from earlier mints) to the
+	// position.
+	if _, _, err := SwapToRatio(p, a, tickLower, tickUpper); err != nil {
+		return err
+	}
+	if _, err := a.Mint(p, tickLower, tickUpper); err != nil {
+		return err
+	}
+	v.lastCompound = ctx.Block()
+	v.compounds++
+	return nil
+}
+
+// PeekFees returns the fees owed to a position, including the fees earned
+// since it was last poked, without changing the pool (the position is poked
+// and then the pool is restored, see pool.Snapshot).
+//
+// Arguments:
+// p         -- The pool
+// owner     -- The owner of the position
+// tickLower -- The lower tick of the position
+// tickUpper -- The upper tick of the position
+//
+// Returns:
+// fees0     -- The amount of token0 owed to the position
+// fees1     -- The amount of token1 owed to the position
+// err       -- An error if the position cannot be poked (e.g. it does not
+//              exist or has no liquidity)
+func PeekFees(p *pool.Pool, owner string, tickLower, tickUpper int) (fees0, fees1 *big.Int, err error) {
+	snapshot := p.Snapshot()
+	defer p.Discard(snapshot)
+	if _, _, err := p.Burn(owner, tickLower, tickUpper, big.NewInt(0)); err != nil {
+		return nil, nil, err
+	}
+	position, _ := p.Position(pool.PositionKey{Owner: owner, TickLower: tickLower, TickUpper: tickUpper})
+	fees0 = new(big.Int).Set(position.TokensOwed0)
+	fees1 = new(big.Int).Set(position.TokensOwed1)
+	p.Restore(snapshot)
+	return fees0, fees1, nil
+}
+
+// Returns the value of the amounts in the given token (0 or 1) at the given
+// price.
+func valueIn(sqrtPriceX96, amount0, amount1 *big.Int, token int) *big.Int {
+	priceX192 := new(big.Int).Mul(sqrtPriceX96, sqrtPriceX96)
+	q192 := new(big.Int).Lsh(big.NewInt(1), 192)
+	if token == 0 {
+		value := new(big.Int).Mul(amount1, q192)
+		value.Div(value, priceX192)
+		return value.Add(value, amount0)
+	}
+	value := new(big.Int).Mul(amount0, priceX192)
+	value.Div(value, q192)
+	return value.Add(value, amount1)
 }
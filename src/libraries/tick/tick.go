@@ -4,6 +4,8 @@
 package tick
 
 import (
+	"errors"
+	"fmt"
 	"math/big"
 	"strconv"
 
@@ -11,6 +13,10 @@ import (
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/liquidityMath"
 )
 
+// Returned by Update if the liquidity referencing a tick would exceed the
+// maximum liquidity per tick.
+var ErrMaxLiquidityPerTick = errors.New("tick liquidity exceeds max liquidity per tick")
+
 // State stored for each initialized tick.
 type Tick struct {
 	// The total position liquidity that references this tick.
@@ -23,6 +29,16 @@ type Tick struct {
 	// the value depends on when the tick is initialized.
 	FeeGrowthOutside0X128 *big.Int
 	FeeGrowthOutside1X128 *big.Int
+	// The cumulative tick value on the other side of the tick.
+	TickCumulativeOutside int64
+	// The seconds per unit of liquidity on the _other_ side of this tick
+	// (relative to the current tick). Only has relative meaning, not absolute —
+	// the value depends on when the tick is initialized.
+	SecondsPerLiquidityOutsideX128 *big.Int
+	// The seconds spent on the other side of the tick (relative to the current
+	// tick). Only has relative meaning, not absolute — the value depends on
+	// when the tick is initialized.
+	SecondsOutside uint32
 	// True iff the tick is initialized, i.e. the value is exactly equivalent to
 	// the expression liquidityGross != 0. These 8 bits are set to prevent fresh
 	// stores when crossing newly initialized ticks.
@@ -42,11 +58,17 @@ func TicksTempToTicks(ticks *map[string]Tick) *Ticks {
 	for k, v := range *ticks {
 		tickIdx, _ := strconv.ParseInt(k, 10, 64)
 		tick := &Tick{
-			LiquidityGross:        v.LiquidityGross,
-			LiquidityNet:          v.LiquidityNet,
-			FeeGrowthOutside0X128: v.FeeGrowthOutside0X128,
-			FeeGrowthOutside1X128: v.FeeGrowthOutside1X128,
-			Initialized:           v.Initialized,
+			LiquidityGross:                 v.LiquidityGross,
+			LiquidityNet:                   v.LiquidityNet,
+			FeeGrowthOutside0X128:          v.FeeGrowthOutside0X128,
+			FeeGrowthOutside1X128:          v.FeeGrowthOutside1X128,
+			TickCumulativeOutside:          v.TickCumulativeOutside,
+			SecondsPerLiquidityOutsideX128: v.SecondsPerLiquidityOutsideX128,
+			SecondsOutside:                 v.SecondsOutside,
+			Initialized:                    v.Initialized,
+		}
+		if tick.SecondsPerLiquidityOutsideX128 == nil {
+			tick.SecondsPerLiquidityOutsideX128 = big.NewInt(0)
 		}
 		tickData[int(tickIdx)] = tick
 	}
@@ -55,6 +77,19 @@ func TicksTempToTicks(ticks *map[string]Tick) *Ticks {
 	}
 }
 
+// Takes in a Ticks struct and returns a map from string to Tick (i.e. the
+// inverse of TicksTempToTicks). Used when saving tick data as JSON, so only
+// initialized ticks are included.
+func TicksToTicksTemp(ticks *Ticks) *map[string]Tick {
+	ticksTemp := make(map[string]Tick)
+	for k, v := range ticks.TickData {
+		if v.Initialized {
+			ticksTemp[strconv.Itoa(k)] = *v
+		}
+	}
+	return &ticksTemp
+}
+
 // Calculates max liquidity per tick from given tick spacing.
 //
 // Arguments:
@@ -62,7 +97,7 @@ func TicksTempToTicks(ticks *map[string]Tick) *Ticks {
 //
 // Returns:
 // The max liquidity per tick
-func tickSpacingToMaxLiquidityPerTick(tickSpacing int) *big.Int {
+func TickSpacingToMaxLiquidityPerTick(tickSpacing int) *big.Int {
 	minTick := (constants.MinTick / tickSpacing) * tickSpacing
 	maxTick := (constants.MaxTick / tickSpacing) * tickSpacing
 	numTicks := ((maxTick - minTick) / tickSpacing) + 1
@@ -73,6 +108,8 @@ func tickSpacingToMaxLiquidityPerTick(tickSpacing int) *big.Int {
 // Solidity automatically initializes all values in maps, so this simulates that
 // behavior (in the case that a tick doesn't exist at a particular index this
 // function initialises a new tick, associates it with that index and returns it).
+// This is the write path, it should only be used to get ticks that are about to
+// be updated. Use Lookup to read a tick.
 //
 // Arguments:
 // tick -- The tick index
@@ -84,17 +121,82 @@ func (t *Ticks) Get(tick int) *Tick {
 	if found {
 		return tickInfo
 	} else {
-		t.TickData[tick] = &Tick{
-			LiquidityGross:        big.NewInt(0),
-			LiquidityNet:          big.NewInt(0),
-			FeeGrowthOutside0X128: big.NewInt(0),
-			FeeGrowthOutside1X128: big.NewInt(0),
-			Initialized:           false,
-		}
+		t.TickData[tick] = uninitializedTick()
 		return t.TickData[tick]
 	}
 }
 
+// Returns the tick data at the given index without changing the ticks, i.e. in
+// the case that a tick doesn't exist at a particular index this function
+// returns a new uninitialized tick without associating it with that index.
+// This is the read path, changes to the returned tick are not guaranteed to be
+// stored. Use Get to get a tick that is about to be updated.
+//
+// Arguments:
+// tick -- The tick index
+//
+// Returns:
+// The tick data at the given index
+func (t *Ticks) Lookup(tick int) *Tick {
+	tickInfo, found := t.TickData[tick]
+	if found {
+		return tickInfo
+	}
+	return uninitializedTick()
+}
+
+// Returns a new uninitialized tick.
+func uninitializedTick() *Tick {
+	return &Tick{
+		LiquidityGross:                 big.NewInt(0),
+		LiquidityNet:                   big.NewInt(0),
+		FeeGrowthOutside0X128:          big.NewInt(0),
+		FeeGrowthOutside1X128:          big.NewInt(0),
+		SecondsPerLiquidityOutsideX128: big.NewInt(0),
+		Initialized:                    false,
+	}
+}
+
+// Returns a deep copy of the tick, i.e. a tick that shares no big.Ints with
+// the original.
+func (t *Tick) Copy() *Tick {
+	tickCopy := *t
+	tickCopy.LiquidityGross = copyInt(t.LiquidityGross)
+	tickCopy.LiquidityNet = copyInt(t.LiquidityNet)
+	tickCopy.FeeGrowthOutside0X128 = copyInt(t.FeeGrowthOutside0X128)
+	tickCopy.FeeGrowthOutside1X128 = copyInt(t.FeeGrowthOutside1X128)
+	tickCopy.SecondsPerLiquidityOutsideX128 = copyInt(t.SecondsPerLiquidityOutsideX128)
+	return &tickCopy
+}
+
+// Returns a deep copy of the ticks.
+func (t *Ticks) Copy() *Ticks {
+	tickData := make(map[int]*Tick, len(t.TickData))
+	for tickIdx, tickInfo := range t.TickData {
+		tickData[tickIdx] = tickInfo.Copy()
+	}
+	return &Ticks{TickData: tickData}
+}
+
+// Returns a copy of x, or nil if x is nil.
+func copyInt(x *big.Int) *big.Int {
+	if x == nil {
+		return nil
+	}
+	return new(big.Int).Set(x)
+}
+
+// Removes all uninitialized ticks, e.g. those included in a pool state loaded
+// from JSON. Uninitialized ticks are equivalent to ticks that don't exist, so
+// this does not change the behavior of the ticks.
+func (t *Ticks) Prune() {
+	for tickIdx, tickInfo := range t.TickData {
+		if !tickInfo.Initialized {
+			delete(t.TickData, tickIdx)
+		}
+	}
+}
+
 // Retrieves fee growth data.
 //
 // Arguments:
@@ -112,8 +214,8 @@ func (t *Ticks) Get(tick int) *Tick {
 // feeGrowthInside1X128 -- The all-time fee growth in token1, per unit of
 //                         liquidity, inside the position's tick boundaries
 func (t *Ticks) GetFeeGrowthInside(tickLower, tickUpper, tickCurrent int, feeGrowthGlobal0X128, feeGrowthGlobal1X128 *big.Int) (*big.Int, *big.Int) {
-	lower := t.Get(tickLower)
-	upper := t.Get(tickUpper)
+	lower := t.Lookup(tickLower)
+	upper := t.Lookup(tickUpper)
 
 	// Calculate fee growth below
 	feeGrowthBelow0X128 := new(big.Int)
@@ -153,7 +255,8 @@ func (t *Ticks) GetFeeGrowthInside(tickLower, tickUpper, tickCurrent int, feeGro
 }
 
 // Updates a tick and returns true if the tick was flipped from initialized to
-// uninitialized, or vice versa.
+// uninitialized, or vice versa. Returns ErrMaxLiquidityPerTick (and leaves the
+// tick unchanged) if the tick's liquidity would exceed the max liquidity.
 //
 // Arguments:
 // tick                 -- The index of the tick that will be updated
@@ -164,21 +267,28 @@ func (t *Ticks) GetFeeGrowthInside(tickLower, tickUpper, tickCurrent int, feeGro
 //                         in token0
 // feeGrowthGlobal1X128 -- The all-time global fee growth, per unit of liquidity,
 //                         in token1
+// secondsPerLiquidityCumulativeX128 -- The all-time seconds per max(1,
+//                         liquidity) of the pool
+// tickCumulative       -- The tick * time elapsed since the pool was first
+//                         initialized
+// time                 -- The current block timestamp cast to a uint32
+// maxLiquidity         -- The maximum liquidity allocation for a single tick
 // upper                -- A boolean that is true for updating a position's upper
 //                         tick, or false for updating a position's lower tick
-// maxLiquidity         -- The maximum liquidity allocation for a single tick
 //
 // Returns:
 // flipped              -- A boolean that indicates whether the tick was flipped
-func (t *Ticks) Update(tick, tickCurrent int, liquidityDelta, feeGrowthGlobal0X128, feeGrowthGlobal1X128, maxLiquidity *big.Int, upper bool) bool {
-	info := t.Get(tick)
-	liquidityGrossBefore := info.LiquidityGross
+// err                  -- ErrMaxLiquidityPerTick or nil
+func (t *Ticks) Update(tick, tickCurrent int, liquidityDelta, feeGrowthGlobal0X128, feeGrowthGlobal1X128, secondsPerLiquidityCumulativeX128 *big.Int, tickCumulative int64, time uint32, maxLiquidity *big.Int, upper bool) (bool, error) {
+	liquidityGrossBefore := t.Lookup(tick).LiquidityGross
 	liquidityGrossAfter := liquidityMath.AddDelta(liquidityGrossBefore, liquidityDelta)
 
 	if liquidityGrossAfter.Cmp(maxLiquidity) >= 1 {
-		panic("tick.Update: Tick liquidity cannot exceed max liquidity per tick")
+		return false, fmt.Errorf("tick.Update: %w (tick %d, liquidity %v, max %v)", ErrMaxLiquidityPerTick, tick, liquidityGrossAfter, maxLiquidity)
 	}
 
+	info := t.Get(tick)
+
 	flipped := (liquidityGrossAfter.Cmp(big.NewInt(0)) == 0) != (liquidityGrossBefore.Cmp(big.NewInt(0)) == 0)
 
 	if liquidityGrossBefore.Cmp(big.NewInt(0)) == 0 {
@@ -187,6 +297,9 @@ func (t *Ticks) Update(tick, tickCurrent int, liquidityDelta, feeGrowthGlobal0X1
 		if tick <= tickCurrent {
 			info.FeeGrowthOutside0X128 = feeGrowthGlobal0X128
 			info.FeeGrowthOutside1X128 = feeGrowthGlobal1X128
+			info.SecondsPerLiquidityOutsideX128 = secondsPerLiquidityCumulativeX128
+			info.TickCumulativeOutside = tickCumulative
+			info.SecondsOutside = time
 		}
 		info.Initialized = true
 	}
@@ -201,7 +314,7 @@ func (t *Ticks) Update(tick, tickCurrent int, liquidityDelta, feeGrowthGlobal0X1
 		info.LiquidityNet = new(big.Int).Add(info.LiquidityNet, liquidityDelta)
 	}
 
-	return flipped
+	return flipped, nil
 }
 
 // Clears data for a particular tick
@@ -220,14 +333,23 @@ func (t *Ticks) Clear(tick int) {
 //                         in token0
 // feeGrowthGlobal1X128 -- The all-time global fee growth, per unit of liquidity,
 //                         in token1
+// secondsPerLiquidityCumulativeX128 -- The current seconds per liquidity
+// tickCumulative       -- The tick * time elapsed since the pool was first
+//                         initialized
+// time                 -- The current block.timestamp
 // Returns:
 // liquidityNet         -- The amount of liquidity added (subtracted) when tick
 //                         is crossed from left to right (right to left)
 
-func (t *Ticks) Cross(tick int, feeGrowthGlobal0X128, feeGrowthGlobal1X128 *big.Int) *big.Int {
+func (t *Ticks) Cross(tick int, feeGrowthGlobal0X128, feeGrowthGlobal1X128, secondsPerLiquidityCumulativeX128 *big.Int, tickCumulative int64, time uint32) *big.Int {
 	info := t.Get(tick)
 	info.FeeGrowthOutside0X128 = new(big.Int).Sub(feeGrowthGlobal0X128, info.FeeGrowthOutside0X128)
 	info.FeeGrowthOutside1X128 = new(big.Int).Sub(feeGrowthGlobal1X128, info.FeeGrowthOutside1X128)
+	info.SecondsPerLiquidityOutsideX128 = new(big.Int).Sub(secondsPerLiquidityCumulativeX128, info.SecondsPerLiquidityOutsideX128)
+	// Simulate solidity (uint160) underflow
+	info.SecondsPerLiquidityOutsideX128.And(info.SecondsPerLiquidityOutsideX128, constants.MaxUint160)
+	info.TickCumulativeOutside = tickCumulative - info.TickCumulativeOutside
+	info.SecondsOutside = time - info.SecondsOutside
 	liquidityNet := info.LiquidityNet
 	return liquidityNet
 }
@@ -1,6 +1,7 @@
 package tick
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
 	"testing"
@@ -148,7 +149,7 @@ func TestGetFeeGrowthInside7(t *testing.T) {
 
 func TestUpdate1(t *testing.T) {
 	fmt.Println("Flips from zero to nonzero")
-	flipped := testTicks.Update(0, 0, big.NewInt(1), big.NewInt(0), big.NewInt(0), big.NewInt(3), false)
+	flipped, _ := testTicks.Update(0, 0, big.NewInt(1), big.NewInt(0), big.NewInt(0), big.NewInt(0), 0, 0, big.NewInt(3), false)
 	if !flipped {
 		t.Errorf("Expected flipped to be true")
 	}
@@ -157,8 +158,8 @@ func TestUpdate1(t *testing.T) {
 
 func TestUpdate2(t *testing.T) {
 	fmt.Println("Does not flip from nonzero to greater nonzero")
-	testTicks.Update(0, 0, big.NewInt(1), big.NewInt(0), big.NewInt(0), big.NewInt(3), false)
-	flipped := testTicks.Update(0, 0, big.NewInt(1), big.NewInt(0), big.NewInt(0), big.NewInt(3), false)
+	testTicks.Update(0, 0, big.NewInt(1), big.NewInt(0), big.NewInt(0), big.NewInt(0), 0, 0, big.NewInt(3), false)
+	flipped, _ := testTicks.Update(0, 0, big.NewInt(1), big.NewInt(0), big.NewInt(0), big.NewInt(0), 0, 0, big.NewInt(3), false)
 	if flipped {
 		t.Errorf("Expected flipped to be false")
 	}
@@ -167,8 +168,8 @@ func TestUpdate2(t *testing.T) {
 
 func TestUpdate3(t *testing.T) {
 	fmt.Println("Flips from nonzero to zero")
-	testTicks.Update(0, 0, big.NewInt(1), big.NewInt(0), big.NewInt(0), big.NewInt(3), false)
-	flipped := testTicks.Update(0, 0, big.NewInt(-1), big.NewInt(0), big.NewInt(0), big.NewInt(3), false)
+	testTicks.Update(0, 0, big.NewInt(1), big.NewInt(0), big.NewInt(0), big.NewInt(0), 0, 0, big.NewInt(3), false)
+	flipped, _ := testTicks.Update(0, 0, big.NewInt(-1), big.NewInt(0), big.NewInt(0), big.NewInt(0), 0, 0, big.NewInt(3), false)
 	if !flipped {
 		t.Errorf("Expected flipped to be true")
 	}
@@ -177,8 +178,8 @@ func TestUpdate3(t *testing.T) {
 
 func TestUpdate4(t *testing.T) {
 	fmt.Println("Does not flip from nonzero to lesser nonzero")
-	testTicks.Update(0, 0, big.NewInt(2), big.NewInt(0), big.NewInt(0), big.NewInt(3), false)
-	flipped := testTicks.Update(0, 0, big.NewInt(-1), big.NewInt(0), big.NewInt(0), big.NewInt(3), false)
+	testTicks.Update(0, 0, big.NewInt(2), big.NewInt(0), big.NewInt(0), big.NewInt(0), 0, 0, big.NewInt(3), false)
+	flipped, _ := testTicks.Update(0, 0, big.NewInt(-1), big.NewInt(0), big.NewInt(0), big.NewInt(0), 0, 0, big.NewInt(3), false)
 	if flipped {
 		t.Errorf("Expected flipped to be false")
 	}
@@ -187,8 +188,8 @@ func TestUpdate4(t *testing.T) {
 
 func TestUpdate5(t *testing.T) {
 	fmt.Println("Does not flip from nonzero to lesser nonzero")
-	testTicks.Update(0, 0, big.NewInt(2), big.NewInt(0), big.NewInt(0), big.NewInt(3), false)
-	flipped := testTicks.Update(0, 0, big.NewInt(-1), big.NewInt(0), big.NewInt(0), big.NewInt(3), false)
+	testTicks.Update(0, 0, big.NewInt(2), big.NewInt(0), big.NewInt(0), big.NewInt(0), 0, 0, big.NewInt(3), false)
+	flipped, _ := testTicks.Update(0, 0, big.NewInt(-1), big.NewInt(0), big.NewInt(0), big.NewInt(0), 0, 0, big.NewInt(3), false)
 	if flipped {
 		t.Errorf("Expected flipped to be false")
 	}
@@ -197,24 +198,36 @@ func TestUpdate5(t *testing.T) {
 
 func TestUpdate6(t *testing.T) {
 	fmt.Println("Reverts if total liquidity gross is greater than max")
-	testTicks.Update(0, 0, big.NewInt(2), big.NewInt(0), big.NewInt(0), big.NewInt(3), false)
-	testTicks.Update(0, 0, big.NewInt(1), big.NewInt(0), big.NewInt(0), big.NewInt(3), true)
-	defer func() {
-		if r := recover(); r == nil {
-			t.Errorf("Update did not panic when total liquidity gross was greater than max.")
-		}
-		testTicks.Clear(0)
-	}()
+	testTicks.Update(0, 0, big.NewInt(2), big.NewInt(0), big.NewInt(0), big.NewInt(0), 0, 0, big.NewInt(3), false)
+	testTicks.Update(0, 0, big.NewInt(1), big.NewInt(0), big.NewInt(0), big.NewInt(0), 0, 0, big.NewInt(3), true)
+	_, err := testTicks.Update(0, 0, big.NewInt(1), big.NewInt(0), big.NewInt(0), big.NewInt(0), 0, 0, big.NewInt(3), false)
+	if !errors.Is(err, ErrMaxLiquidityPerTick) {
+		t.Errorf("Expected ErrMaxLiquidityPerTick when total liquidity gross was greater than max, got %v", err)
+	}
+	if testTicks.Get(0).LiquidityGross.Cmp(big.NewInt(3)) != 0 {
+		t.Errorf("Expected the tick to be unchanged, got liquidityGross %v", testTicks.Get(0).LiquidityGross)
+	}
+	testTicks.Clear(0)
+}
 
-	testTicks.Update(0, 0, big.NewInt(1), big.NewInt(0), big.NewInt(0), big.NewInt(3), false)
+func TestUpdateDoesNotAddTickOnError(t *testing.T) {
+	fmt.Println("Update: Does not add an uninitialized tick if the update fails")
+	ticks := &Ticks{TickData: make(map[int]*Tick)}
+	_, err := ticks.Update(0, 0, big.NewInt(4), big.NewInt(0), big.NewInt(0), big.NewInt(0), 0, 0, big.NewInt(3), false)
+	if !errors.Is(err, ErrMaxLiquidityPerTick) {
+		t.Errorf("Expected ErrMaxLiquidityPerTick, got %v", err)
+	}
+	if len(ticks.TickData) != 0 {
+		t.Errorf("Expected no ticks, got %d", len(ticks.TickData))
+	}
 }
 
 func TestUpdate7(t *testing.T) {
 	fmt.Println("Nets the liquidity based on upper flag")
-	testTicks.Update(0, 0, big.NewInt(2), big.NewInt(0), big.NewInt(0), big.NewInt(10), false)
-	testTicks.Update(0, 0, big.NewInt(1), big.NewInt(0), big.NewInt(0), big.NewInt(10), true)
-	testTicks.Update(0, 0, big.NewInt(3), big.NewInt(0), big.NewInt(0), big.NewInt(10), true)
-	testTicks.Update(0, 0, big.NewInt(1), big.NewInt(0), big.NewInt(0), big.NewInt(10), false)
+	testTicks.Update(0, 0, big.NewInt(2), big.NewInt(0), big.NewInt(0), big.NewInt(0), 0, 0, big.NewInt(10), false)
+	testTicks.Update(0, 0, big.NewInt(1), big.NewInt(0), big.NewInt(0), big.NewInt(0), 0, 0, big.NewInt(10), true)
+	testTicks.Update(0, 0, big.NewInt(3), big.NewInt(0), big.NewInt(0), big.NewInt(0), 0, 0, big.NewInt(10), true)
+	testTicks.Update(0, 0, big.NewInt(1), big.NewInt(0), big.NewInt(0), big.NewInt(0), 0, 0, big.NewInt(10), false)
 	tick := testTicks.Get(0)
 	liquidityGross := tick.LiquidityGross
 	liquidityNet := tick.LiquidityNet
@@ -229,7 +242,7 @@ func TestUpdate7(t *testing.T) {
 
 func TestUpdate8(t *testing.T) {
 	fmt.Println("Reverts on overflow liquidity gross")
-	testTicks.Update(0, 0, new(big.Int).Div(constants.MaxUint128, big.NewInt(2)), big.NewInt(0), big.NewInt(0), constants.MaxUint128, false)
+	testTicks.Update(0, 0, new(big.Int).Div(constants.MaxUint128, big.NewInt(2)), big.NewInt(0), big.NewInt(0), big.NewInt(0), 0, 0, constants.MaxUint128, false)
 	defer func() {
 		if r := recover(); r == nil {
 			t.Errorf("Update did not panic when liquidity gross overflowed.")
@@ -237,12 +250,12 @@ func TestUpdate8(t *testing.T) {
 		testTicks.Clear(0)
 	}()
 
-	testTicks.Update(0, 0, new(big.Int).Add(new(big.Int).Add(constants.MaxUint128, big.NewInt(2)), big.NewInt(1)), big.NewInt(0), big.NewInt(0), constants.MaxUint128, false)
+	testTicks.Update(0, 0, new(big.Int).Add(new(big.Int).Add(constants.MaxUint128, big.NewInt(2)), big.NewInt(1)), big.NewInt(0), big.NewInt(0), big.NewInt(0), 0, 0, constants.MaxUint128, false)
 }
 
 func TestUpdate9(t *testing.T) {
 	fmt.Println("Assumes all growth happens below ticks lte current tick")
-	testTicks.Update(1, 1, big.NewInt(1), big.NewInt(1), big.NewInt(2), constants.MaxUint128, false)
+	testTicks.Update(1, 1, big.NewInt(1), big.NewInt(1), big.NewInt(2), big.NewInt(0), 0, 0, constants.MaxUint128, false)
 	tick := testTicks.Get(1)
 	feeGrowthOutside0X128 := tick.FeeGrowthOutside0X128
 	feeGrowthOutside1X128 := tick.FeeGrowthOutside1X128
@@ -261,8 +274,8 @@ func TestUpdate9(t *testing.T) {
 
 func TestUpdate10(t *testing.T) {
 	fmt.Println("Does not set any growth fields if tick is already initialized")
-	testTicks.Update(1, 1, big.NewInt(1), big.NewInt(1), big.NewInt(2), constants.MaxUint128, false)
-	testTicks.Update(1, 1, big.NewInt(1), big.NewInt(6), big.NewInt(7), constants.MaxUint128, false)
+	testTicks.Update(1, 1, big.NewInt(1), big.NewInt(1), big.NewInt(2), big.NewInt(0), 0, 0, constants.MaxUint128, false)
+	testTicks.Update(1, 1, big.NewInt(1), big.NewInt(6), big.NewInt(7), big.NewInt(0), 0, 0, constants.MaxUint128, false)
 	tick := testTicks.Get(1)
 	feeGrowthOutside0X128 := tick.FeeGrowthOutside0X128
 	feeGrowthOutside1X128 := tick.FeeGrowthOutside1X128
@@ -281,7 +294,7 @@ func TestUpdate10(t *testing.T) {
 
 func TestUpdate11(t *testing.T) {
 	fmt.Println("Does not set any growth fields for ticks gt current tick")
-	testTicks.Update(2, 1, big.NewInt(1), big.NewInt(1), big.NewInt(2), constants.MaxUint128, false)
+	testTicks.Update(2, 1, big.NewInt(1), big.NewInt(1), big.NewInt(2), big.NewInt(0), 0, 0, constants.MaxUint128, false)
 	tick := testTicks.Get(2)
 	feeGrowthOutside0X128 := tick.FeeGrowthOutside0X128
 	feeGrowthOutside1X128 := tick.FeeGrowthOutside1X128
@@ -297,3 +310,120 @@ func TestUpdate11(t *testing.T) {
 	}
 	testTicks.Clear(2)
 }
+
+func TestLookup(t *testing.T) {
+	fmt.Println("Lookup: Returns an uninitialized tick without adding it to the ticks")
+	tick := testTicks.Lookup(3)
+	if tick.Initialized || tick.LiquidityGross.Cmp(big.NewInt(0)) != 0 {
+		t.Errorf("Expected an uninitialized tick, got %v", tick)
+	}
+	if _, found := testTicks.TickData[3]; found {
+		t.Errorf("Expected tick 3 not to be added to the ticks")
+	}
+}
+
+func TestGetFeeGrowthInsideDoesNotAddTicks(t *testing.T) {
+	fmt.Println("GetFeeGrowthInside: Does not add uninitialized ticks to the ticks")
+	ticks := &Ticks{TickData: make(map[int]*Tick)}
+	ticks.GetFeeGrowthInside(-2, 2, 0, big.NewInt(15), big.NewInt(15))
+	if len(ticks.TickData) != 0 {
+		t.Errorf("Expected no ticks, got %d", len(ticks.TickData))
+	}
+}
+
+func TestPrune(t *testing.T) {
+	fmt.Println("Prune: Removes uninitialized ticks and keeps initialized ticks")
+	ticks := &Ticks{TickData: make(map[int]*Tick)}
+	ticks.Get(-1)
+	ticks.Update(1, 0, big.NewInt(1), big.NewInt(0), big.NewInt(0), big.NewInt(0), 0, 0, constants.MaxUint128, false)
+	ticks.Prune()
+	if _, found := ticks.TickData[-1]; found {
+		t.Errorf("Expected tick -1 to be removed")
+	}
+	if _, found := ticks.TickData[1]; !found {
+		t.Errorf("Expected tick 1 to be kept")
+	}
+}
+
+func TestUpdateSetsOutsideForTicksLteCurrent(t *testing.T) {
+	fmt.Println("Update: Sets the seconds per liquidity, tick cumulative and seconds outside for ticks lte current tick")
+	ticks := &Ticks{TickData: make(map[int]*Tick)}
+	ticks.Update(1, 1, big.NewInt(1), big.NewInt(1), big.NewInt(2), big.NewInt(3), 4, 5, constants.MaxUint128, false)
+	tick := ticks.Get(1)
+	if tick.SecondsPerLiquidityOutsideX128.Cmp(big.NewInt(3)) != 0 || tick.TickCumulativeOutside != 4 || tick.SecondsOutside != 5 {
+		t.Errorf("Got %v, %d, %d; want 3, 4, 5", tick.SecondsPerLiquidityOutsideX128, tick.TickCumulativeOutside, tick.SecondsOutside)
+	}
+	ticks.Update(2, 1, big.NewInt(1), big.NewInt(1), big.NewInt(2), big.NewInt(3), 4, 5, constants.MaxUint128, false)
+	tick = ticks.Get(2)
+	if tick.SecondsPerLiquidityOutsideX128.Cmp(big.NewInt(0)) != 0 || tick.TickCumulativeOutside != 0 || tick.SecondsOutside != 0 {
+		t.Errorf("Got %v, %d, %d for tick gt current tick; want 0, 0, 0", tick.SecondsPerLiquidityOutsideX128, tick.TickCumulativeOutside, tick.SecondsOutside)
+	}
+}
+
+func TestCross(t *testing.T) {
+	fmt.Println("Cross: Flips the growth variables")
+	ticks := &Ticks{TickData: make(map[int]*Tick)}
+	ticks.TickData[2] = &Tick{
+		LiquidityGross:                 big.NewInt(3),
+		LiquidityNet:                   big.NewInt(4),
+		FeeGrowthOutside0X128:          big.NewInt(1),
+		FeeGrowthOutside1X128:          big.NewInt(2),
+		TickCumulativeOutside:          6,
+		SecondsPerLiquidityOutsideX128: big.NewInt(5),
+		SecondsOutside:                 7,
+		Initialized:                    true,
+	}
+	liquidityNet := ticks.Cross(2, big.NewInt(7), big.NewInt(9), big.NewInt(8), 15, 10)
+	tick := ticks.Get(2)
+	if liquidityNet.Cmp(big.NewInt(4)) != 0 {
+		t.Errorf("Expected liquidityNet to be 4, got %v", liquidityNet)
+	}
+	if tick.FeeGrowthOutside0X128.Cmp(big.NewInt(6)) != 0 || tick.FeeGrowthOutside1X128.Cmp(big.NewInt(7)) != 0 {
+		t.Errorf("Expected fee growth outside to be 6, 7, got %v, %v", tick.FeeGrowthOutside0X128, tick.FeeGrowthOutside1X128)
+	}
+	if tick.SecondsPerLiquidityOutsideX128.Cmp(big.NewInt(3)) != 0 || tick.TickCumulativeOutside != 9 || tick.SecondsOutside != 3 {
+		t.Errorf("Got %v, %d, %d; want 3, 9, 3", tick.SecondsPerLiquidityOutsideX128, tick.TickCumulativeOutside, tick.SecondsOutside)
+	}
+}
+
+func TestCrossTwoFlipsAreNoOp(t *testing.T) {
+	fmt.Println("Cross: Two flips are a no-op (including seconds per liquidity underflow)")
+	ticks := &Ticks{TickData: make(map[int]*Tick)}
+	ticks.TickData[2] = &Tick{
+		LiquidityGross:                 big.NewInt(3),
+		LiquidityNet:                   big.NewInt(4),
+		FeeGrowthOutside0X128:          big.NewInt(1),
+		FeeGrowthOutside1X128:          big.NewInt(2),
+		TickCumulativeOutside:          6,
+		SecondsPerLiquidityOutsideX128: big.NewInt(9),
+		SecondsOutside:                 7,
+		Initialized:                    true,
+	}
+	ticks.Cross(2, big.NewInt(7), big.NewInt(9), big.NewInt(8), 15, 10)
+	ticks.Cross(2, big.NewInt(7), big.NewInt(9), big.NewInt(8), 15, 10)
+	tick := ticks.Get(2)
+	if tick.SecondsPerLiquidityOutsideX128.Cmp(big.NewInt(9)) != 0 || tick.TickCumulativeOutside != 6 || tick.SecondsOutside != 7 {
+		t.Errorf("Got %v, %d, %d; want 9, 6, 7", tick.SecondsPerLiquidityOutsideX128, tick.TickCumulativeOutside, tick.SecondsOutside)
+	}
+}
+
+func TestTickSpacingToMaxLiquidityPerTick(t *testing.T) {
+	tests := []struct {
+		tickSpacing int
+		expected    string
+	}{
+		{10, "1917569901783203986719870431555990"},
+		{60, "11505743598341114571880798222544994"},
+		{200, "38350317471085141830651933667504588"},
+		{887272, "113427455640312821154458202477256070485"},
+		{2302, "441351967472034323558203122479595605"},
+	}
+	for _, test := range tests {
+		fmt.Printf("TickSpacingToMaxLiquidityPerTick: Returns the correct value for tick spacing %d", test.tickSpacing)
+		fmt.Println()
+		expected, _ := new(big.Int).SetString(test.expected, 10)
+		if got := TickSpacingToMaxLiquidityPerTick(test.tickSpacing); got.Cmp(expected) != 0 {
+			t.Errorf("TickSpacingToMaxLiquidityPerTick(%d): Got %v; want %v", test.tickSpacing, got, expected)
+		}
+	}
+}
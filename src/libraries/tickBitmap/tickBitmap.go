@@ -0,0 +1,173 @@
+// Package tickBitmap simulates the Uniswap TickBitmap library.
+//
+// Stores a packed mapping of tick index to its initialized state. Each word
+// is a uint256 in which every bit records whether a (compressed) tick is
+// initialized, so finding the next initialized tick within a word is a
+// single bit operation rather than a search through 256 ticks.
+package tickBitmap
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/constants"
+)
+
+// A packed mapping of compressed tick index (tick / tickSpacing) to whether
+// the tick is initialized.
+type TickBitmap struct {
+	// Maps word position to the word. Words are never modified in place, a
+	// new big.Int is created whenever a tick is flipped.
+	Words map[int]*big.Int
+}
+
+// Make returns a new, empty tick bitmap.
+func Make() *TickBitmap {
+	return &TickBitmap{
+		Words: make(map[int]*big.Int),
+	}
+}
+
+// Returns a deep copy of the tick bitmap.
+func (b *TickBitmap) Copy() *TickBitmap {
+	words := make(map[int]*big.Int, len(b.Words))
+	for wordPos, word := range b.Words {
+		words[wordPos] = new(big.Int).Set(word)
+	}
+	return &TickBitmap{Words: words}
+}
+
+// Computes the position in the mapping where the initialized bit for a tick
+// lives.
+//
+// Arguments:
+// tick    -- The (compressed) tick for which to compute the position
+//
+// Returns:
+// wordPos -- The key in the mapping containing the word in which the bit is
+//            stored
+// bitPos  -- The bit position in the word where the flag is stored
+func position(tick int) (wordPos, bitPos int) {
+	// Arithmetic shift, so negative ticks are rounded towards negative
+	// infinity (as in the deployed contract).
+	wordPos = tick >> 8
+	bitPos = ((tick % 256) + 256) % 256
+	return
+}
+
+// Returns the key in the mapping of the word in which the initialized bit of
+// a tick is stored, i.e. of the word that FlipTick changes.
+//
+// Arguments:
+// tick        -- The tick
+// tickSpacing -- The spacing between usable ticks
+//
+// Returns:
+// The key in the mapping of the word
+func WordPos(tick, tickSpacing int) int {
+	wordPos, _ := position(tick / tickSpacing)
+	return wordPos
+}
+
+// Returns the word at the given position (zero if it has never been set).
+func (b *TickBitmap) word(wordPos int) *big.Int {
+	word, found := b.Words[wordPos]
+	if !found {
+		return big.NewInt(0)
+	}
+	return word
+}
+
+// Flips the initialized state for a given tick from false to true, or vice
+// versa.
+//
+// Arguments:
+// tick        -- The tick to flip
+// tickSpacing -- The spacing between usable ticks
+func (b *TickBitmap) FlipTick(tick, tickSpacing int) {
+	if tick%tickSpacing != 0 {
+		message := fmt.Sprintf("tickBitmap.FlipTick: Tick %d is not a multiple of tick spacing %d", tick, tickSpacing)
+		panic(message)
+	}
+	wordPos, bitPos := position(tick / tickSpacing)
+	word := b.word(wordPos)
+	word = new(big.Int).SetBit(word, bitPos, word.Bit(bitPos)^1)
+	if word.Cmp(big.NewInt(0)) == 0 {
+		delete(b.Words, wordPos)
+	} else {
+		b.Words[wordPos] = word
+	}
+}
+
+// Returns true iff the given tick is initialized.
+//
+// Arguments:
+// tick        -- The tick to check
+// tickSpacing -- The spacing between usable ticks
+func (b *TickBitmap) IsInitialized(tick, tickSpacing int) bool {
+	if tick%tickSpacing != 0 {
+		return false
+	}
+	wordPos, bitPos := position(tick / tickSpacing)
+	return b.word(wordPos).Bit(bitPos) == 1
+}
+
+// Returns the next initialized tick contained in the same word (or adjacent
+// word) as the tick that is either to the left (less than or equal to) or
+// right (greater than) of the given tick.
+//
+// Arguments:
+// tick        -- The starting tick
+// tickSpacing -- The spacing between usable ticks
+// lte         -- Whether to search for the next initialized tick to the left
+//                (less than or equal to the starting tick)
+//
+// Returns:
+// next        -- The next initialized or uninitialized tick up to 256 ticks
+//                away from the current tick
+// initialized -- Whether the next tick is initialized, as the function only
+//                searches within up to 256 ticks
+func (b *TickBitmap) NextInitializedTickWithinOneWord(tick, tickSpacing int, lte bool) (next int, initialized bool) {
+	compressed := tick / tickSpacing
+	if tick < 0 && tick%tickSpacing != 0 {
+		// Round towards negative infinity.
+		compressed--
+	}
+
+	if lte {
+		wordPos, bitPos := position(compressed)
+		// All the 1s at or to the right of the current bitPos.
+		mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(bitPos+1)), big.NewInt(1))
+		masked := new(big.Int).And(b.word(wordPos), mask)
+
+		// If there are no initialized ticks to the right of or at the
+		// current tick, return rightmost in the word.
+		initialized = masked.Cmp(big.NewInt(0)) != 0
+		if initialized {
+			// Overflow/underflow is possible, but prevented externally by
+			// limiting both tickSpacing and tick.
+			mostSignificantBit := masked.BitLen() - 1
+			next = (compressed - (bitPos - mostSignificantBit)) * tickSpacing
+		} else {
+			next = (compressed - bitPos) * tickSpacing
+		}
+	} else {
+		// Start from the word of the next tick, since the current tick
+		// state doesn't matter.
+		wordPos, bitPos := position(compressed + 1)
+		// All the 1s at or to the left of the bitPos.
+		mask := new(big.Int).Xor(constants.MaxUint256, new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(bitPos)), big.NewInt(1)))
+		masked := new(big.Int).And(b.word(wordPos), mask)
+
+		// If there are no initialized ticks to the left of the current
+		// tick, return leftmost in the word.
+		initialized = masked.Cmp(big.NewInt(0)) != 0
+		if initialized {
+			leastSignificantBit := int(masked.TrailingZeroBits())
+			next = (compressed + 1 + (leastSignificantBit - bitPos)) * tickSpacing
+		} else {
+			next = (compressed + 1 + (255 - bitPos)) * tickSpacing
+		}
+	}
+	return
+}
@@ -0,0 +1,152 @@
+package tickBitmap
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Returns a tick bitmap (with tick spacing 1) with the given ticks
+// initialized. Uses the same ticks as the Uniswap TickBitmap tests.
+func initTicks(ticks ...int) *TickBitmap {
+	b := Make()
+	for _, tick := range ticks {
+		b.FlipTick(tick, 1)
+	}
+	return b
+}
+
+var testTicks = []int{-200, -55, -4, 70, 78, 84, 139, 240, 535}
+
+func TestIsInitialized(t *testing.T) {
+	fmt.Println("IsInitialized: Is false at first, true after flipping and false after flipping back")
+	b := Make()
+	if b.IsInitialized(1, 1) {
+		t.Errorf("Expected tick 1 to be uninitialized")
+	}
+	b.FlipTick(1, 1)
+	if !b.IsInitialized(1, 1) {
+		t.Errorf("Expected tick 1 to be initialized")
+	}
+	b.FlipTick(1, 1)
+	if b.IsInitialized(1, 1) {
+		t.Errorf("Expected tick 1 to be uninitialized")
+	}
+	if len(b.Words) != 0 {
+		t.Errorf("Expected empty words to be removed, got %v", b.Words)
+	}
+}
+
+func TestIsInitializedOtherTicks(t *testing.T) {
+	fmt.Println("IsInitialized: Is not changed by another flip to a different tick")
+	b := initTicks(2)
+	if b.IsInitialized(1, 1) {
+		t.Errorf("Expected tick 1 to be uninitialized")
+	}
+	b = initTicks(1 + 256)
+	if b.IsInitialized(1, 1) {
+		t.Errorf("Expected tick 1 to be uninitialized (other word)")
+	}
+	if !b.IsInitialized(257, 1) {
+		t.Errorf("Expected tick 257 to be initialized")
+	}
+}
+
+func TestFlipTickNegative(t *testing.T) {
+	fmt.Println("FlipTick: Flips only the specified tick (negative ticks)")
+	b := initTicks(-230)
+	for tick, expected := range map[int]bool{-230: true, -231: false, -229: false, -230 + 256: false, -230 - 256: false} {
+		if b.IsInitialized(tick, 1) != expected {
+			t.Errorf("IsInitialized(%d): Got %t; want %t", tick, !expected, expected)
+		}
+	}
+	b.FlipTick(-230, 1)
+	if b.IsInitialized(-230, 1) {
+		t.Errorf("Expected tick -230 to be uninitialized after flipping back")
+	}
+}
+
+func TestFlipTickPanicsIfNotAligned(t *testing.T) {
+	fmt.Println("FlipTick: Panics if the tick is not a multiple of the tick spacing")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected FlipTick(61, 60) to panic")
+		}
+	}()
+	Make().FlipTick(61, 60)
+}
+
+func TestNextInitializedTickWithinOneWord(t *testing.T) {
+	tests := []struct {
+		description string
+		tick        int
+		lte         bool
+		next        int
+		initialized bool
+	}{
+		// lte = false
+		{"Returns tick to right if at initialized tick", 78, false, 84, true},
+		{"Returns tick to right if at initialized tick (negative)", -55, false, -4, true},
+		{"Returns the tick directly to the right", 77, false, 78, true},
+		{"Returns the tick directly to the right (negative)", -56, false, -55, true},
+		{"Returns the next words initialized tick if on the right boundary", 255, false, 511, false},
+		{"Returns the next words initialized tick if on the right boundary (negative)", -257, false, -200, true},
+		{"Does not exceed boundary", 508, false, 511, false},
+		{"Skips entire word", 255, false, 511, false},
+		{"Skips half word", 383, false, 511, false},
+		// lte = true
+		{"Returns same tick if initialized", 78, true, 78, true},
+		{"Returns tick directly to the left of input tick if not initialized", 79, true, 78, true},
+		{"Will not exceed the word boundary", 258, true, 256, false},
+		{"At the word boundary", 256, true, 256, false},
+		{"Word boundary less 1 (next initialized tick in next word)", 72, true, 70, true},
+		{"Word boundary (negative)", -257, true, -512, false},
+		{"Entire empty word", 1023, true, 768, false},
+		{"Halfway through empty word", 900, true, 768, false},
+	}
+	b := initTicks(testTicks...)
+	for _, test := range tests {
+		fmt.Println("NextInitializedTickWithinOneWord: " + test.description)
+		next, initialized := b.NextInitializedTickWithinOneWord(test.tick, 1, test.lte)
+		if next != test.next || initialized != test.initialized {
+			t.Errorf("NextInitializedTickWithinOneWord(%d, 1, %t): Got %d, %t; want %d, %t", test.tick, test.lte, next, initialized, test.next, test.initialized)
+		}
+	}
+}
+
+func TestNextInitializedTickWithinOneWordNextWord(t *testing.T) {
+	fmt.Println("NextInitializedTickWithinOneWord: Returns the next initialized tick from the next word")
+	b := initTicks(append(testTicks, 340)...)
+	next, initialized := b.NextInitializedTickWithinOneWord(328, 1, false)
+	if next != 340 || !initialized {
+		t.Errorf("Got %d, %t; want 340, true", next, initialized)
+	}
+}
+
+func TestNextInitializedTickWithinOneWordBoundaryInitialized(t *testing.T) {
+	fmt.Println("NextInitializedTickWithinOneWord: Boundary is initialized")
+	b := initTicks(append(testTicks, 329)...)
+	next, initialized := b.NextInitializedTickWithinOneWord(456, 1, true)
+	if next != 329 || !initialized {
+		t.Errorf("Got %d, %t; want 329, true", next, initialized)
+	}
+}
+
+func TestNextInitializedTickWithinOneWordTickSpacing(t *testing.T) {
+	fmt.Println("NextInitializedTickWithinOneWord: Compresses ticks using the tick spacing")
+	b := Make()
+	b.FlipTick(-120, 60)
+	b.FlipTick(180, 60)
+	next, initialized := b.NextInitializedTickWithinOneWord(-61, 60, true)
+	if next != -120 || !initialized {
+		t.Errorf("Got %d, %t; want -120, true", next, initialized)
+	}
+	// -60 is the last tick in the word containing -61.
+	next, initialized = b.NextInitializedTickWithinOneWord(-61, 60, false)
+	if next != -60 || initialized {
+		t.Errorf("Got %d, %t; want -60, false", next, initialized)
+	}
+	next, initialized = b.NextInitializedTickWithinOneWord(-60, 60, false)
+	if next != 180 || !initialized {
+		t.Errorf("Got %d, %t; want 180, true", next, initialized)
+	}
+}
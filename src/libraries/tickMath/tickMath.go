@@ -133,7 +133,7 @@ func GetSqrtRatioAtTick(tick int) *big.Int {
 // Returns:
 // The greatest tick for which the ratio is less than or equal to the input ratio
 func GetTickAtSqrtRatio(sqrtPriceX96 *big.Int) int {
-	if (sqrtPriceX96.Cmp(constants.MaxSqrtRatio) != -1) || (sqrtPriceX96.Cmp(constants.MinSqrtRatioBig) != 1) {
+	if (sqrtPriceX96.Cmp(constants.MaxSqrtRatio) != -1) || (sqrtPriceX96.Cmp(constants.MinSqrtRatioBig) == -1) {
 		panic("tickMath.getTickAtSqrtRatio: INVALID_SQRT_RATIO")
 	}
 
@@ -159,11 +159,10 @@ func GetTickAtSqrtRatio(sqrtPriceX96 *big.Int) int {
 	}
 	f := new(big.Int).Lsh(big.NewInt(int64(cmp)), 0)
 	msb = new(big.Int).Or(msb, f)
-	dif := new(big.Int).Sub(msb, big.NewInt(127))
 	if msb.Cmp(big.NewInt(128)) >= 0 {
-		r = new(big.Int).Rsh(ratio, uint(dif.Int64()))
+		r = new(big.Int).Rsh(ratio, uint(msb.Int64()-127))
 	} else {
-		r = new(big.Int).Lsh(ratio, uint(dif.Int64()))
+		r = new(big.Int).Lsh(ratio, uint(127-msb.Int64()))
 	}
 
 	log_2_temp := new(big.Int).Sub(msb, big.NewInt(128))
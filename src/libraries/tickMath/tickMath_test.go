@@ -146,3 +146,14 @@ func TestGetTickAtSqrtRatio(t *testing.T) {
 		}
 	}
 }
+
+// TestGetTickAtSqrtRatioNegativeTicks tests the GetTickAtSqrtRatio function
+// for prices below 1 (i.e. negative ticks).
+func TestGetTickAtSqrtRatioNegativeTicks(t *testing.T) {
+	for _, tick := range []int{-1, -60, -23028, -500000, -887271} {
+		output := GetTickAtSqrtRatio(GetSqrtRatioAtTick(tick))
+		if output != tick {
+			t.Errorf("GetTickAtSqrtRatio(GetSqrtRatioAtTick(%d)) = %d, want %d", tick, output, tick)
+		}
+	}
+}
@@ -3,16 +3,20 @@
 package transaction
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
 
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/constants"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/logging"
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/pool"
 )
 
 // Transaction represents a single transaction that is executed on a pool. It
-// contains the fields necessary for mints, burns, swaps and flashes. Any fields
-// that are not relevant to the transaction type are set to nil.
+// contains the fields necessary for mints, burns, collects, swaps, flashes,
+// the pool's initialization and the governance methods (setting the protocol
+// fee and collecting protocol fees). Any fields that are not relevant to the
+// transaction type are set to nil.
 type Transaction struct {
 	BlockNo      int      `json:"blockNo"`
 	Timestamp    int      `json:"timestamp"`
@@ -33,44 +37,350 @@ type Transaction struct {
 	Tick         int      `json:"tick"`
 	Paid0        *big.Int `json:"paid0"`
 	Paid1        *big.Int `json:"paid1"`
+	// The new protocol fees (SET_FEE_PROTOCOL only). Pointers so that a
+	// missing fee can be told apart from a fee of 0.
+	FeeProtocol0 *int `json:"feeProtocol0"`
+	FeeProtocol1 *int `json:"feeProtocol1"`
 }
 
-// Execute executes the transaction on the provided pool.
-func Execute(t Transaction, p *pool.Pool) {
-	fmt.Println()
-	fmt.Println()
-	fmt.Println("Pool liquidity: ", p.Liquidity)
-	fmt.Println("Pool current tick: ", p.Slot0.Tick)
-	fmt.Println("Pool current sqrt price: ", p.Slot0.SqrtPriceX96)
-	fmt.Printf("Transaction: %+v", t)
-	fmt.Println()
+// Returns a deep copy of the transaction, i.e. a transaction that shares no
+// big.Ints (or other pointers) with the original.
+func (t *Transaction) Copy() *Transaction {
+	tCopy := *t
+	tCopy.Amount = copyInt(t.Amount)
+	tCopy.Amount0 = copyInt(t.Amount0)
+	tCopy.Amount1 = copyInt(t.Amount1)
+	tCopy.SqrtPriceX96 = copyInt(t.SqrtPriceX96)
+	tCopy.Liquidity = copyInt(t.Liquidity)
+	tCopy.Paid0 = copyInt(t.Paid0)
+	tCopy.Paid1 = copyInt(t.Paid1)
+	if t.FeeProtocol0 != nil {
+		feeProtocol0 := *t.FeeProtocol0
+		tCopy.FeeProtocol0 = &feeProtocol0
+	}
+	if t.FeeProtocol1 != nil {
+		feeProtocol1 := *t.FeeProtocol1
+		tCopy.FeeProtocol1 = &feeProtocol1
+	}
+	return &tCopy
+}
+
+// Returns a copy of x, or nil if x is nil.
+func copyInt(x *big.Int) *big.Int {
+	if x == nil {
+		return nil
+	}
+	return new(big.Int).Set(x)
+}
+
+// Logs the transactions executed (subsystem "transaction", see the logging
+// package).
+var logger = logging.Get("transaction")
+
+var (
+	// Returned by Execute for a transaction whose method the simulator does
+	// not know how to replay.
+	ErrUnknownMethod = errors.New("unknown transaction method")
+	// Returned by Execute for a transaction that is missing a field its
+	// method needs.
+	ErrMalformedTransaction = errors.New("malformed transaction")
+)
+
+// SwapMode determines how recorded SWAP transactions are replayed on a pool.
+type SwapMode int
+
+const (
+	// Replays each swap as an exact input swap of the amount the user
+	// provided. Once a strategy adds liquidity, swaps replayed this way move
+	// the price less than they did on chain.
+	ExactInputSwapMode SwapMode = iota
+	// Replays each swap as a swap to the recorded post-swap price, i.e. as
+	// though the swap was arbitrage-driven. The pool ends each swap at the
+	// historical price and the swap amounts are recomputed against the
+	// pool's liquidity.
+	PricePathSwapMode
+	// Replays each swap as either an exact input or an exact output swap,
+	// whichever reproduces the recorded amounts, price and tick.
+	InferredSwapMode
+)
+
+// Names used to select a swap mode (e.g. from the command line).
+var swapModeNames = map[string]SwapMode{
+	"exactInput": ExactInputSwapMode,
+	"pricePath":  PricePathSwapMode,
+	"inferred":   InferredSwapMode,
+}
+
+// ParseSwapMode returns the swap mode with the given name.
+func ParseSwapMode(name string) (SwapMode, error) {
+	mode, found := swapModeNames[name]
+	if !found {
+		return 0, fmt.Errorf("transaction.ParseSwapMode: Unknown swap mode %q", name)
+	}
+	return mode, nil
+}
+
+// String returns the name of the swap mode.
+func (m SwapMode) String() string {
+	for name, mode := range swapModeNames {
+		if mode == m {
+			return name
+		}
+	}
+	return fmt.Sprintf("SwapMode(%d)", int(m))
+}
+
+// Result records how a transaction was replayed on a pool.
+type Result struct {
+	// The delta of the balance of token0 and token1 of the pool (nil if the
+	// transaction did not change the pool's balances).
+	Amount0 *big.Int
+	Amount1 *big.Int
+	// True iff the transaction was a swap that was replayed as an exact
+	// output swap (as opposed to an exact input swap).
+	ExactOutput bool
+}
+
+// SwapArgs are the arguments with which a recorded swap is replayed.
+type SwapArgs struct {
+	ZeroForOne        bool
+	AmountSpecified   *big.Int
+	SqrtPriceLimitX96 *big.Int
+}
+
+// Execute executes the transaction on the provided pool, replaying swaps
+// according to the given swap mode. The pool's block timestamp is set to the
+// transaction's timestamp, so that oracle observations are written with it.
+// If the transaction cannot be executed (e.g. the deployed contract would
+// have reverted) an error is returned and the pool is left unchanged. Returns
+// ErrUnknownMethod for a method that cannot be replayed and
+// ErrMalformedTransaction for a transaction that is missing a required field,
+// so that differences between the recorded data and the simulator are not
+// silently ignored.
+func Execute(t Transaction, p *pool.Pool, swapMode SwapMode) (result Result, err error) {
+	if logger.Enabled(logging.Debug) {
+		logger.Debug("execute", logging.F("block", t.BlockNo), logging.F("method", t.Method), logging.F("liquidity", p.Liquidity), logging.F("tick", p.Slot0.Tick), logging.F("sqrtPriceX96", p.Slot0.SqrtPriceX96), logging.F("transaction", fmt.Sprintf("%+v", t)))
+	}
+	if err = t.check(); err != nil {
+		return
+	}
+	p.SetBlockTimestamp(t.Timestamp)
 	switch t.Method {
+	case "INITIALIZE":
+		err = p.Initialize(t.SqrtPriceX96)
 	case "MINT":
 		if t.Amount.Cmp(big.NewInt(0)) == 0 {
 			return
 		}
-		p.Mint(t.Owner, t.TickLower, t.TickUpper, t.Amount)
+		result.Amount0, result.Amount1, err = p.Mint(t.Owner, t.TickLower, t.TickUpper, t.Amount)
 	case "BURN":
 		if t.Amount.Cmp(big.NewInt(0)) == 0 {
 			return
 		}
-		p.Burn(t.Owner, t.TickLower, t.TickUpper, t.Amount)
+		_, _, err = p.Burn(t.Owner, t.TickLower, t.TickUpper, t.Amount)
+	case "COLLECT":
+		// The recorded amounts are the amounts collected, which are requested
+		// again so that the same amounts are collected (as long as the
+		// simulated tokens owed are at least as large as those on chain).
+		var amount0, amount1 *big.Int
+		amount0, amount1, err = p.Collect(t.Owner, t.TickLower, t.TickUpper, t.Amount0, t.Amount1)
+		if err == nil {
+			result.Amount0 = new(big.Int).Neg(amount0)
+			result.Amount1 = new(big.Int).Neg(amount1)
+		}
 	case "SWAP":
-		// Is the swap token0 for token1 or token1 for token0? The value
-		// that is greater than 0 is the token that the user provided.
-		// There's no way to tell whether the swap was for an exact input
-		// or an exact output, so we'll just assume that all swaps are for
-		// an exact input (by providing the positive amount). We also set
-		// the price limit to the max value of a uint160 to ensure that all
-		// swaps are executed in their entirety.
-		zeroForOne := false
-		amount := t.Amount1
-		if t.Amount0.Cmp(big.NewInt(0)) >= 1 {
-			zeroForOne = true
-			amount = t.Amount0
+		var args *SwapArgs
+		args, err = GetSwapArgs(t, p, swapMode)
+		if err != nil || args == nil {
+			return
 		}
-		p.Swap(t.Sender, t.Recipient, zeroForOne, amount, new(big.Int).Sub(constants.MaxSqrtRatio, big.NewInt(1)))
+		result.Amount0, result.Amount1, err = p.Swap(t.Sender, t.Recipient, args.ZeroForOne, args.AmountSpecified, args.SqrtPriceLimitX96)
+		result.ExactOutput = args.AmountSpecified.Cmp(big.NewInt(0)) <= -1
 	case "FLASH":
-		p.Flash(t.Paid0, t.Paid1)
+		// Borrow the recorded amounts and repay them plus the recorded amounts
+		// paid, which the pool checks cover the fees.
+		amount0, amount1 := orZero(t.Amount0), orZero(t.Amount1)
+		result.Amount0, result.Amount1, err = p.Flash(t.Recipient, amount0, amount1, func(_ *pool.Pool, _, _ *big.Int) (*big.Int, *big.Int, error) {
+			return new(big.Int).Add(amount0, orZero(t.Paid0)), new(big.Int).Add(amount1, orZero(t.Paid1)), nil
+		})
+	case "SET_FEE_PROTOCOL":
+		err = p.SetFeeProtocol(*t.FeeProtocol0, *t.FeeProtocol1)
+	case "COLLECT_PROTOCOL":
+		// The recorded amounts are the amounts collected, so requesting them
+		// collects the same amounts (as long as the simulated protocol fees
+		// are the same as those on chain).
+		var amount0, amount1 *big.Int
+		amount0, amount1, err = p.CollectProtocol(t.Recipient, t.Amount0, t.Amount1)
+		if err == nil {
+			result.Amount0 = new(big.Int).Neg(amount0)
+			result.Amount1 = new(big.Int).Neg(amount1)
+		}
+	}
+	return
+}
+
+// The fields that must be set for each method that can be replayed.
+var requiredFields = map[string][]string{
+	"INITIALIZE":       {"sqrtPriceX96"},
+	"MINT":             {"amount"},
+	"BURN":             {"amount"},
+	"COLLECT":          {"amount0", "amount1"},
+	"SWAP":             {"amount0", "amount1", "sqrtPriceX96"},
+	"FLASH":            {},
+	"SET_FEE_PROTOCOL": {"feeProtocol0", "feeProtocol1"},
+	"COLLECT_PROTOCOL": {"amount0", "amount1"},
+}
+
+// Returns ErrUnknownMethod if the transaction's method cannot be replayed, or
+// ErrMalformedTransaction if a field the method requires is not set.
+func (t Transaction) check() error {
+	fields, found := requiredFields[t.Method]
+	if !found {
+		return fmt.Errorf("transaction.Execute: %w (%q)", ErrUnknownMethod, t.Method)
 	}
+	set := map[string]bool{
+		"amount":       t.Amount != nil,
+		"amount0":      t.Amount0 != nil,
+		"amount1":      t.Amount1 != nil,
+		"sqrtPriceX96": t.SqrtPriceX96 != nil,
+		"feeProtocol0": t.FeeProtocol0 != nil,
+		"feeProtocol1": t.FeeProtocol1 != nil,
+	}
+	for _, field := range fields {
+		if !set[field] {
+			return fmt.Errorf("transaction.Execute: %w (%s has no %s)", ErrMalformedTransaction, t.Method, field)
+		}
+	}
+	return nil
+}
+
+// Returns x, or zero if x is nil (i.e. the amount was not recorded).
+func orZero(x *big.Int) *big.Int {
+	if x == nil {
+		return big.NewInt(0)
+	}
+	return x
+}
+
+// GetSwapArgs returns the arguments with which a recorded swap is replayed on
+// the pool in the given swap mode, or nil if the swap does not need to be
+// replayed (i.e. the pool is already at the recorded price). An error is
+// returned if the swap cannot be computed against the pool.
+func GetSwapArgs(t Transaction, p *pool.Pool, swapMode SwapMode) (*SwapArgs, error) {
+	switch swapMode {
+	case PricePathSwapMode:
+		return pricePathSwapArgs(t, p), nil
+	case InferredSwapMode:
+		return inferSwapArgs(t, p)
+	default:
+		return exactInputSwapArgs(t), nil
+	}
+}
+
+// Returns the least restrictive valid price limit for a swap in the given
+// direction.
+func priceLimit(zeroForOne bool) *big.Int {
+	if zeroForOne {
+		return new(big.Int).Add(constants.MinSqrtRatioBig, big.NewInt(1))
+	}
+	return new(big.Int).Sub(constants.MaxSqrtRatio, big.NewInt(1))
+}
+
+// Returns the arguments to replay a swap as an exact input swap.
+func exactInputSwapArgs(t Transaction) *SwapArgs {
+	// Is the swap token0 for token1 or token1 for token0? The value that is
+	// greater than 0 is the token that the user provided. We assume that all
+	// swaps are for an exact input (by providing the positive amount). We
+	// also set the price limit to the least restrictive valid limit in the
+	// direction of the swap to ensure that all swaps are executed in their
+	// entirety.
+	zeroForOne := false
+	amount := t.Amount1
+	if t.Amount0.Cmp(big.NewInt(0)) >= 1 {
+		zeroForOne = true
+		amount = t.Amount0
+	}
+	return &SwapArgs{
+		ZeroForOne:        zeroForOne,
+		AmountSpecified:   amount,
+		SqrtPriceLimitX96: priceLimit(zeroForOne),
+	}
+}
+
+// Returns the arguments to replay a swap as a swap to the recorded post-swap
+// price, or nil if the pool is already at that price. The amount specified is
+// the largest possible exact input, so the swap only stops once it reaches the
+// price limit (the recorded price).
+func pricePathSwapArgs(t Transaction, p *pool.Pool) *SwapArgs {
+	cmp := t.SqrtPriceX96.Cmp(p.Slot0.SqrtPriceX96)
+	if cmp == 0 {
+		return nil
+	}
+	// If the recorded price is below the current price then token0 must be
+	// swapped in to move the price down to it.
+	return &SwapArgs{
+		ZeroForOne:        cmp <= -1,
+		AmountSpecified:   constants.MaxInt256,
+		SqrtPriceLimitX96: t.SqrtPriceX96,
+	}
+}
+
+// Returns the arguments to replay a swap as either an exact input swap of the
+// amount the user provided, or an exact output swap of the amount the user
+// received, whichever reproduces the recorded amounts, price and tick. Both
+// are computed against the pool without changing it. If neither reproduces
+// the recorded result (e.g. because a strategy has changed the pool's
+// liquidity), the one that ends closest to the recorded price is used.
+func inferSwapArgs(t Transaction, p *pool.Pool) (*SwapArgs, error) {
+	zeroForOne := t.Amount0.Cmp(big.NewInt(0)) >= 1
+	amountIn, amountOut := t.Amount1, t.Amount0
+	if zeroForOne {
+		amountIn, amountOut = t.Amount0, t.Amount1
+	}
+	exactInput := &SwapArgs{
+		ZeroForOne:        zeroForOne,
+		AmountSpecified:   amountIn,
+		SqrtPriceLimitX96: priceLimit(zeroForOne),
+	}
+	// A swap in which the user received nothing can only be replayed as an
+	// exact input swap.
+	if amountOut.Cmp(big.NewInt(0)) >= 0 {
+		return exactInput, nil
+	}
+	exactOutput := &SwapArgs{
+		ZeroForOne:        zeroForOne,
+		AmountSpecified:   amountOut,
+		SqrtPriceLimitX96: priceLimit(zeroForOne),
+	}
+
+	exactInputResult, err := p.ComputeSwap(exactInput.ZeroForOne, exactInput.AmountSpecified, exactInput.SqrtPriceLimitX96)
+	if err != nil {
+		return nil, err
+	}
+	if reproduces(t, exactInputResult) {
+		return exactInput, nil
+	}
+	exactOutputResult, err := p.ComputeSwap(exactOutput.ZeroForOne, exactOutput.AmountSpecified, exactOutput.SqrtPriceLimitX96)
+	if err != nil {
+		return nil, err
+	}
+	if reproduces(t, exactOutputResult) {
+		return exactOutput, nil
+	}
+
+	exactInputDistance := new(big.Int).Abs(new(big.Int).Sub(exactInputResult.SqrtPriceX96, t.SqrtPriceX96))
+	exactOutputDistance := new(big.Int).Abs(new(big.Int).Sub(exactOutputResult.SqrtPriceX96, t.SqrtPriceX96))
+	if exactOutputDistance.Cmp(exactInputDistance) <= -1 {
+		return exactOutput, nil
+	}
+	return exactInput, nil
+}
+
+// Returns true iff the swap result matches the recorded amounts, price and
+// tick of the transaction.
+func reproduces(t Transaction, result *pool.SwapResult) bool {
+	return result.Amount0.Cmp(t.Amount0) == 0 &&
+		result.Amount1.Cmp(t.Amount1) == 0 &&
+		result.SqrtPriceX96.Cmp(t.SqrtPriceX96) == 0 &&
+		result.Tick == t.Tick
 }
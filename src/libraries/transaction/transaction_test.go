@@ -0,0 +1,263 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/pool"
+)
+
+// Returns a pool with a fee of 0.3% and a tick spacing of 60, initialized at
+// a price of 1, with the given full range liquidity.
+func liquidPool(t *testing.T, liquidity int64) *pool.Pool {
+	price, _ := new(big.Int).SetString("79228162514264337593543950336", 10)
+	p := pool.Make("0xA", "0xB", 3000, 60)
+	if err := p.Initialize(price); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	if _, _, err := p.Mint("0xC", -887220, 887220, big.NewInt(liquidity)); err != nil {
+		t.Fatalf("Mint failed: %v", err)
+	}
+	return p
+}
+
+// Returns a SWAP transaction recording the result of swapping
+// amountSpecified on the pool (without changing the pool), as the data
+// would.
+func recordedSwap(t *testing.T, p *pool.Pool, zeroForOne bool, amountSpecified *big.Int) Transaction {
+	result, err := p.ComputeSwap(zeroForOne, amountSpecified, priceLimit(zeroForOne))
+	if err != nil {
+		t.Fatalf("ComputeSwap failed: %v", err)
+	}
+	return Transaction{
+		Method:       "SWAP",
+		Sender:       "0xD",
+		Recipient:    "0xD",
+		Amount0:      result.Amount0,
+		Amount1:      result.Amount1,
+		SqrtPriceX96: result.SqrtPriceX96,
+		Tick:         result.Tick,
+	}
+}
+
+func TestParseSwapMode(t *testing.T) {
+	fmt.Println("ParseSwapMode: Returns the swap mode with a name, and an error for an unknown name")
+	for name, mode := range swapModeNames {
+		if got, err := ParseSwapMode(name); err != nil || got != mode || got.String() != name {
+			t.Errorf("ParseSwapMode(%q): Got %v, %v; want %v", name, got, err, mode)
+		}
+	}
+	if _, err := ParseSwapMode("exactOutput"); err == nil {
+		t.Errorf("Expected an error for an unknown swap mode")
+	}
+}
+
+func TestExecutePricePath(t *testing.T) {
+	fmt.Println("Execute: A swap replayed in pricePath mode ends at the recorded price after liquidity is added")
+	tx := recordedSwap(t, liquidPool(t, 1000000000), true, big.NewInt(10000000))
+
+	// Another position doubles the liquidity in range, so the recorded
+	// amount moves the price half as far.
+	p := liquidPool(t, 1000000000)
+	if _, _, err := p.Mint("0xE", -600, 600, big.NewInt(1000000000)); err != nil {
+		t.Fatalf("Mint failed: %v", err)
+	}
+	exactInput, err := p.ComputeSwap(true, tx.Amount0, priceLimit(true))
+	if err != nil {
+		t.Fatalf("ComputeSwap failed: %v", err)
+	}
+	if exactInput.SqrtPriceX96.Cmp(tx.SqrtPriceX96) == 0 {
+		t.Fatalf("Expected an exact input swap not to end at the recorded price")
+	}
+
+	result, err := Execute(tx, p, PricePathSwapMode)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if p.Slot0.SqrtPriceX96.Cmp(tx.SqrtPriceX96) != 0 || p.Slot0.Tick != tx.Tick {
+		t.Errorf("Got price %v, tick %d; want %v, %d", p.Slot0.SqrtPriceX96, p.Slot0.Tick, tx.SqrtPriceX96, tx.Tick)
+	}
+	// Twice the liquidity needs about twice the input.
+	if result.Amount0.Cmp(tx.Amount0) <= 0 {
+		t.Errorf("Got amount0 %v; want more than the recorded %v", result.Amount0, tx.Amount0)
+	}
+
+	// The pool is already at the recorded price, so the swap is not replayed.
+	if result, err := Execute(tx, p, PricePathSwapMode); err != nil || result.Amount0 != nil {
+		t.Errorf("Got %+v, %v; want no swap", result, err)
+	}
+}
+
+func TestExecuteInferred(t *testing.T) {
+	fmt.Println("Execute: A swap replayed in inferred mode is detected as exact input or exact output")
+	tests := []struct {
+		zeroForOne      bool
+		amountSpecified int64
+		exactOutput     bool
+	}{
+		{true, 10000000, false},
+		{false, 10000000, false},
+		{true, -10000000, true},
+		{false, -10000000, true},
+	}
+	for _, test := range tests {
+		p := liquidPool(t, 1000000000)
+		tx := recordedSwap(t, p, test.zeroForOne, big.NewInt(test.amountSpecified))
+		result, err := Execute(tx, p, InferredSwapMode)
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		if result.ExactOutput != test.exactOutput {
+			t.Errorf("Swap of %d (zeroForOne %t): Got exact output %t; want %t", test.amountSpecified, test.zeroForOne, result.ExactOutput, test.exactOutput)
+		}
+		if result.Amount0.Cmp(tx.Amount0) != 0 || result.Amount1.Cmp(tx.Amount1) != 0 || p.Slot0.SqrtPriceX96.Cmp(tx.SqrtPriceX96) != 0 || p.Slot0.Tick != tx.Tick {
+			t.Errorf("Swap of %d (zeroForOne %t): Got %v, %v at %v, tick %d; want the recorded %+v", test.amountSpecified, test.zeroForOne, result.Amount0, result.Amount1, p.Slot0.SqrtPriceX96, p.Slot0.Tick, tx)
+		}
+	}
+}
+
+func TestInferSwapArgsClosestPrice(t *testing.T) {
+	fmt.Println("inferSwapArgs: Uses the swap that ends closest to the recorded price if neither reproduces it")
+	tx := recordedSwap(t, liquidPool(t, 1000000000), true, big.NewInt(-10000000))
+	p := liquidPool(t, 1000000000)
+	if _, _, err := p.Mint("0xE", -600, 600, big.NewInt(1000000000)); err != nil {
+		t.Fatalf("Mint failed: %v", err)
+	}
+
+	exactInput, err := p.ComputeSwap(true, tx.Amount0, priceLimit(true))
+	if err != nil {
+		t.Fatalf("ComputeSwap failed: %v", err)
+	}
+	exactOutput, err := p.ComputeSwap(true, tx.Amount1, priceLimit(true))
+	if err != nil {
+		t.Fatalf("ComputeSwap failed: %v", err)
+	}
+	if reproduces(tx, exactInput) || reproduces(tx, exactOutput) {
+		t.Fatalf("Expected neither swap to reproduce the recorded swap")
+	}
+	// The exact input swap uses all of the recorded input, so it moves the
+	// price further towards the recorded price.
+	exactInputDistance := new(big.Int).Abs(new(big.Int).Sub(exactInput.SqrtPriceX96, tx.SqrtPriceX96))
+	exactOutputDistance := new(big.Int).Abs(new(big.Int).Sub(exactOutput.SqrtPriceX96, tx.SqrtPriceX96))
+	if exactInputDistance.Cmp(exactOutputDistance) >= 0 {
+		t.Fatalf("Expected the exact input swap to end closer to the recorded price, got distances %v and %v", exactInputDistance, exactOutputDistance)
+	}
+
+	result, err := Execute(tx, p, InferredSwapMode)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if result.ExactOutput || result.Amount0.Cmp(tx.Amount0) != 0 || p.Slot0.SqrtPriceX96.Cmp(exactInput.SqrtPriceX96) != 0 {
+		t.Errorf("Got %+v at %v; want the exact input swap of %v to %v", result, p.Slot0.SqrtPriceX96, tx.Amount0, exactInput.SqrtPriceX96)
+	}
+
+	// Without the extra liquidity the exact output swap ends closest to a
+	// recorded price that neither swap reaches.
+	p = liquidPool(t, 1000000000)
+	tx.SqrtPriceX96 = new(big.Int).Add(tx.SqrtPriceX96, big.NewInt(1000))
+	if result, err := Execute(tx, p, InferredSwapMode); err != nil || !result.ExactOutput {
+		t.Errorf("Got %+v, %v; want the exact output swap", result, err)
+	}
+}
+
+func TestExecuteInitializeAndCollect(t *testing.T) {
+	fmt.Println("Execute: Replays INITIALIZE, MINT, BURN and COLLECT transactions")
+	price, _ := new(big.Int).SetString("79228162514264337593543950336", 10)
+	p := pool.Make("0xA", "0xB", 3000, 60)
+	if _, err := Execute(Transaction{Method: "INITIALIZE", Timestamp: 10, SqrtPriceX96: price}, p, ExactInputSwapMode); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if p.Slot0.SqrtPriceX96.Cmp(price) != 0 || p.Slot0.Tick != 0 {
+		t.Errorf("Got price %v, tick %d; want %v, 0", p.Slot0.SqrtPriceX96, p.Slot0.Tick, price)
+	}
+
+	mint := Transaction{Method: "MINT", Timestamp: 11, Owner: "0xC", TickLower: -60, TickUpper: 60, Amount: big.NewInt(1000000)}
+	burn := Transaction{Method: "BURN", Timestamp: 12, Owner: "0xC", TickLower: -60, TickUpper: 60, Amount: big.NewInt(1000000)}
+	for _, tx := range []Transaction{mint, burn} {
+		if _, err := Execute(tx, p, ExactInputSwapMode); err != nil {
+			t.Fatalf("Execute(%s) failed: %v", tx.Method, err)
+		}
+	}
+	key := pool.PositionKey{Owner: "0xC", TickLower: -60, TickUpper: 60}
+	position, found := p.Position(key)
+	if !found {
+		t.Fatalf("Expected the position to exist")
+	}
+	owed0, owed1 := position.TokensOwed0, position.TokensOwed1
+	if owed0.Cmp(big.NewInt(0)) <= 0 || owed1.Cmp(big.NewInt(0)) <= 0 {
+		t.Fatalf("Got tokens owed %v, %v; want positive amounts", owed0, owed1)
+	}
+
+	collect := Transaction{Method: "COLLECT", Timestamp: 13, Owner: "0xC", TickLower: -60, TickUpper: 60, Amount0: owed0, Amount1: owed1}
+	result, err := Execute(collect, p, ExactInputSwapMode)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if result.Amount0.Cmp(new(big.Int).Neg(owed0)) != 0 || result.Amount1.Cmp(new(big.Int).Neg(owed1)) != 0 {
+		t.Errorf("Got %v, %v; want -%v, -%v", result.Amount0, result.Amount1, owed0, owed1)
+	}
+	if p.BlockTimestamp != 13 {
+		t.Errorf("Got block timestamp %d; want 13", p.BlockTimestamp)
+	}
+}
+
+func TestExecuteInitializeInvalidPrice(t *testing.T) {
+	fmt.Println("Execute: Returns an error for an INITIALIZE transaction with a price out of range")
+	for _, price := range []*big.Int{big.NewInt(0), big.NewInt(4295128738)} {
+		p := pool.Make("0xA", "0xB", 3000, 60)
+		if _, err := Execute(Transaction{Method: "INITIALIZE", Timestamp: 10, SqrtPriceX96: price}, p, ExactInputSwapMode); !errors.Is(err, pool.ErrInvalidSqrtPrice) {
+			t.Errorf("Execute(INITIALIZE at %v): Expected %v, got %v", price, pool.ErrInvalidSqrtPrice, err)
+		}
+		if p.Slot0.SqrtPriceX96.Sign() != 0 {
+			t.Errorf("Execute(INITIALIZE at %v): Expected the pool not to be initialized", price)
+		}
+	}
+}
+
+// Returns a pointer to x.
+func intPointer(x int) *int {
+	return &x
+}
+
+func TestExecuteSetFeeProtocol(t *testing.T) {
+	fmt.Println("Execute: Replays SET_FEE_PROTOCOL transactions, including ones that turn the protocol fee off")
+	p := liquidPool(t, 1000000000)
+	if _, err := Execute(Transaction{Method: "SET_FEE_PROTOCOL", FeeProtocol0: intPointer(4), FeeProtocol1: intPointer(10)}, p, ExactInputSwapMode); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if p.Slot0.FeeProtocol != 4+(10<<4) {
+		t.Errorf("Got fee protocol %d; want %d", p.Slot0.FeeProtocol, 4+(10<<4))
+	}
+	if _, err := Execute(Transaction{Method: "SET_FEE_PROTOCOL", FeeProtocol0: intPointer(0), FeeProtocol1: intPointer(0)}, p, ExactInputSwapMode); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if p.Slot0.FeeProtocol != 0 {
+		t.Errorf("Got fee protocol %d; want 0", p.Slot0.FeeProtocol)
+	}
+}
+
+func TestExecuteErrors(t *testing.T) {
+	fmt.Println("Execute: Returns an error for an unknown method or a missing field, and leaves the pool unchanged")
+	tests := []struct {
+		tx  Transaction
+		err error
+	}{
+		{Transaction{Method: "DONATE", Amount0: big.NewInt(1), Amount1: big.NewInt(1)}, ErrUnknownMethod},
+		{Transaction{Method: "MINT", Owner: "0xC", TickLower: -60, TickUpper: 60}, ErrMalformedTransaction},
+		{Transaction{Method: "SWAP", Amount0: big.NewInt(1), Amount1: big.NewInt(-1)}, ErrMalformedTransaction},
+		{Transaction{Method: "SET_FEE_PROTOCOL", FeeProtocol0: intPointer(4)}, ErrMalformedTransaction},
+		{Transaction{Method: "SET_FEE_PROTOCOL", FeeProtocol1: intPointer(4)}, ErrMalformedTransaction},
+	}
+	for _, test := range tests {
+		p := liquidPool(t, 1000000000)
+		liquidity, positions := p.Liquidity.String(), len(p.Positions)
+		if _, err := Execute(test.tx, p, ExactInputSwapMode); !errors.Is(err, test.err) {
+			t.Errorf("Execute(%s): Expected %v, got %v", test.tx.Method, test.err, err)
+		}
+		if p.Liquidity.String() != liquidity || len(p.Positions) != positions {
+			t.Errorf("Execute(%s): Expected the pool to be unchanged", test.tx.Method)
+		}
+	}
+}
@@ -7,7 +7,10 @@ import (
 	"math/big"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/logging"
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/pool"
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/simulation"
 	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/strategy"
@@ -35,10 +38,21 @@ func getPoolState(poolRaw []byte) *pool.Pool {
 
 	json.Unmarshal(poolRaw, &poolInput)
 	poolTemp = poolInput.Data
-	p = pool.PoolTempToPool(&poolTemp)
+	p, err := pool.PoolTempToPool(&poolTemp)
+	if err != nil {
+		panic(err)
+	}
 	return p
 }
 
+// Converts a pool to the format in which pool states are provided (see
+// getPoolState), so that saved pool states can be loaded again.
+func poolStateOutput(p *pool.Pool) interface{} {
+	return struct {
+		Data *pool.PoolTemp `json:"data"`
+	}{pool.PoolToPoolTemp(p)}
+}
+
 func getGasAvs(gasAvsRaw []byte) *strategy.GasAvs {
 	type getGasAvsInput struct {
 		Data strategy.GasAvs
@@ -69,17 +83,65 @@ func getGasAvs(gasAvsRaw []byte) *strategy.GasAvs {
 }
 
 func getStratInput(stratRaw []byte) *strategy.StrategyInput {
-	var stratInput strategy.StrategyInput
+	stratInput, err := strategy.ParseInput(stratRaw)
+	if err != nil {
+		panic(err)
+	}
+	return stratInput
+}
 
-	json.Unmarshal(stratRaw, &stratInput)
+// Usage of the flag that sets the log levels.
+var logUsage = fmt.Sprintf("Log levels per subsystem, e.g. pool=debug,transaction=info (subsystems: %s; levels: debug, info, warn, error, off)", strings.Join(logging.Subsystems(), ", "))
 
-	return &stratInput
+// Sets the log levels of the subsystems (see logging.Configure) and, if a
+// path is given, writes logs to the file at the path. Logging is off if spec
+// is empty.
+func configureLogging(spec, relPath string) {
+	if err := logging.Configure(spec); err != nil {
+		panic(err)
+	}
+	if relPath != "" {
+		absPath, _ := filepath.Abs(relPath)
+		f, err := os.Create(absPath)
+		if err != nil {
+			panic(fmt.Sprintf("Error creating log file at path (relative path, absolute path): %s, %s, %v", relPath, absPath, err))
+		}
+		logging.SetOutput(f)
+	}
 }
 
 func main() {
+	// Run a subcommand if one is given, otherwise run a simulation.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "bisect":
+			bisect(os.Args[2:])
+			return
+		case "diff":
+			diff(os.Args[2:])
+			return
+		}
+	}
+
 	// Get command line arguments
 	relPathToData := flag.String("data", "../data/testV21", "Path to file containing data for simulation")
+	swapModeName := flag.String("swapMode", "exactInput", "How recorded swaps are replayed (exactInput, pricePath or inferred)")
+	verify := flag.Bool("verify", false, "Compare the pool state with the recorded state after each transaction")
+	onErrorName := flag.String("onError", "abort", "What to do when a transaction fails (abort, skip or stop)")
+	traceSwaps := flag.Bool("traceSwaps", false, "Record the steps and tick crossings of every swap")
+	logSpec := flag.String("log", "", logUsage)
+	logFile := flag.String("logFile", "", "Path to file to write logs to (stderr by default)")
 	flag.Parse()
+	configureLogging(*logSpec, *logFile)
+
+	swapMode, err := transaction.ParseSwapMode(*swapModeName)
+	if err != nil {
+		panic(err)
+	}
+	onError, err := simulation.ParseErrorPolicy(*onErrorName)
+	if err != nil {
+		panic(err)
+	}
 
 	// Relative paths to files containing data for simulation
 	relPathToTransactions := *relPathToData + "/transactions.txt"
@@ -93,6 +155,9 @@ func main() {
 	relPathToStratAfter := relPathToResults + "/strategyAfter.txt"
 	relPathToPoolStateBefore := relPathToResults + "/pool.txt"
 	relPathToPoolStateAfter := relPathToResults + "/poolAfter.txt"
+	relPathToDivergences := relPathToResults + "/divergences.txt"
+	relPathToErrors := relPathToResults + "/errors.txt"
+	relPathToSwapTraces := relPathToResults + "/swapTraces.txt"
 
 	// Get absolute paths to files containing data for simulation
 	absPathToTransactions, err := filepath.Abs(relPathToTransactions)
@@ -124,6 +189,9 @@ func main() {
 	absPathToStratAfter, _ := filepath.Abs(relPathToStratAfter)
 	absPathToPoolStateBefore, _ := filepath.Abs(relPathToPoolStateBefore)
 	absPathToPoolStateAfter, _ := filepath.Abs(relPathToPoolStateAfter)
+	absPathToDivergences, _ := filepath.Abs(relPathToDivergences)
+	absPathToErrors, _ := filepath.Abs(relPathToErrors)
+	absPathToSwapTraces, _ := filepath.Abs(relPathToSwapTraces)
 
 	// Read data for simulation from files
 	transactionsRaw, err := os.ReadFile(absPathToTransactions)
@@ -156,46 +224,96 @@ func main() {
 	g := getGasAvs(gasRaw)
 	stratInput := getStratInput(stratRaw)
 
-	strat := strategy.Make(stratInput.Amount0, stratInput.Amount1, p, g, stratInput.Strategy, stratInput.UpdateInterval)
+	strat, err := strategy.NewFromInput(stratInput)
+	if err != nil {
+		panic(err)
+	}
+	account := strategy.Make(stratInput.Amount0, stratInput.Amount1, g, stratInput.UpdateInterval)
 
-	s := simulation.Make(p, t, strat)
+	s := simulation.Make(p, t, strat, account)
+	s.SwapMode = swapMode
+	s.Verify = *verify
+	s.OnError = onError
+	s.TraceSwaps = *traceSwaps
 
 	// Save pool state before simulation
-	poolJSON, _ := json.MarshalIndent(s.Pool, "", "    ")
+	poolJSON, _ := json.MarshalIndent(poolStateOutput(s.Pool), "", "    ")
 	f, _ := os.Create(absPathToPoolStateBefore)
 	f.Write(poolJSON)
 	f.Close()
 
 	// Save strategy before to simulation
-	// stratJSON, _ := json.MarshalIndent(s.Strategy, "", "    ")
+	// stratJSON, _ := json.MarshalIndent(s.Account, "", "    ")
 	f, _ = os.Create(absPathToStratBefore)
 	// f.Write(stratJSON)
-	f.WriteString(fmt.Sprintf("amount0: %v\n", s.Strategy.Amount0))
-	f.WriteString(fmt.Sprintf("amount1: %v\n", s.Strategy.Amount1))
-	f.WriteString(fmt.Sprintf("gasUsed: %v\n", s.Strategy.GasUsed))
+	f.WriteString(fmt.Sprintf("amount0: %v\n", s.Account.Amount0))
+	f.WriteString(fmt.Sprintf("amount1: %v\n", s.Account.Amount1))
+	f.WriteString(fmt.Sprintf("gasUsed: %v\n", s.Account.GasUsed))
 	f.Close()
 
-	s.Simulate()
+	if err := s.Simulate(); err != nil {
+		fmt.Println("Simulation stopped:", err)
+	}
 
 	// Save pool state after simulation
-	poolJSON, _ = json.MarshalIndent(s.Pool, "", "    ")
+	poolJSON, _ = json.MarshalIndent(poolStateOutput(s.Pool), "", "    ")
 	f, _ = os.Create(absPathToPoolStateAfter)
 	f.Write(poolJSON)
 	f.Close()
 
+	// Save divergences from the recorded pool state
+	if s.Verify {
+		divergencesJSON, _ := json.MarshalIndent(s.Divergences, "", "    ")
+		f, _ = os.Create(absPathToDivergences)
+		f.Write(divergencesJSON)
+		f.Close()
+	}
+
+	// Save the errors that were skipped (or that stopped the simulation)
+	if s.OnError != simulation.AbortOnError {
+		errorsJSON, _ := json.MarshalIndent(s.Errors, "", "    ")
+		f, _ = os.Create(absPathToErrors)
+		f.Write(errorsJSON)
+		f.Close()
+	}
+
+	// Save the traces of the swaps
+	if s.TraceSwaps {
+		swapTracesJSON, _ := json.MarshalIndent(s.SwapTraces, "", "    ")
+		f, _ = os.Create(absPathToSwapTraces)
+		f.Write(swapTracesJSON)
+		f.Close()
+	}
+
 	// Save strategy after simulation
-	// stratJSON, _ = json.MarshalIndent(s.Strategy, "", "    ")
+	// stratJSON, _ = json.MarshalIndent(s.Account, "", "    ")
 	f, _ = os.Create(absPathToStratAfter)
-	liquidity := s.Strategy.Positions[0].Liquidity
+	// The total liquidity of the strategy's positions (the nil strategy
+	// has none).
+	liquidity := s.Account.Liquidity()
 	f.WriteString(fmt.Sprintf("liquidity: %v\n", liquidity))
-	amount0, amount1, gasUsed := s.Strategy.Results(p)
+	amount0, amount1, gasUsed, err := s.Account.Results(p)
+	if err != nil {
+		panic(err)
+	}
 	f.WriteString(fmt.Sprintf("amount0: %v\n", amount0))
 	f.WriteString(fmt.Sprintf("amount1: %v\n", amount1))
 	f.WriteString(fmt.Sprintf("gasUsed: %v\n", gasUsed))
+	if reporter, ok := strat.(strategy.Reporter); ok {
+		report := reporter.Report()
+		names := make([]string, 0, len(report))
+		for name := range report {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			f.WriteString(fmt.Sprintf("%s: %d\n", name, report[name]))
+		}
+	}
 	// f.Write(stratJSON)
 	f.Close()
 
-	// amount0, amount1, gasUsed := s.Strategy.Results(p)
+	// amount0, amount1, gasUsed := s.Account.Results(p)
 	// fmt.Println(amount0)
 	// fmt.Println(amount1)
 	// fmt.Println(gasUsed)
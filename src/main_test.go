@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/constants"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/pool"
+	"github.com/chris-aubin/Uniswap-Simulator/src/libraries/transaction"
+)
+
+func TestParseTolerances(t *testing.T) {
+	fmt.Println("parseTolerances: Parses tolerances of the form field=absolute:relative")
+	tolerances, err := parseTolerances("balance0=1000:0,ticks.=0:1e-9")
+	expected := map[string]pool.Tolerance{
+		"balance0": {Absolute: big.NewInt(1000), Relative: 0},
+		"ticks.":   {Absolute: big.NewInt(0), Relative: 1e-9},
+	}
+	if err != nil || !reflect.DeepEqual(tolerances, expected) {
+		t.Errorf("Got %+v, %v; want %+v", tolerances, err, expected)
+	}
+	if tolerances, err := parseTolerances(""); err != nil || len(tolerances) != 0 {
+		t.Errorf("Got %+v, %v; want no tolerances", tolerances, err)
+	}
+	for _, raw := range []string{"balance0", "balance0=1000", "balance0=1e3:0", "balance0=1000:x", "balance0=1000:0,"} {
+		if _, err := parseTolerances(raw); err == nil {
+			t.Errorf("parseTolerances(%q): Expected an error", raw)
+		}
+	}
+}
+
+// Returns an initialization, a mint and three swaps that record the pool
+// state after them, and an uninitialized pool on which to replay them.
+func divergenceTransactions(t *testing.T) ([]transaction.Transaction, *pool.Pool) {
+	price, _ := new(big.Int).SetString("79228162514264337593543950336", 10)
+	transactions := []transaction.Transaction{
+		{BlockNo: 1, Timestamp: 10, Method: "INITIALIZE", SqrtPriceX96: price},
+		{BlockNo: 1, Timestamp: 10, Method: "MINT", Owner: "0xC", TickLower: -600, TickUpper: 600, Amount: big.NewInt(1000000000)},
+	}
+	// Record the swaps by executing them on another pool.
+	p := pool.Make("0xA", "0xB", 3000, 60)
+	for _, tx := range transactions {
+		if _, err := transaction.Execute(tx, p, transaction.ExactInputSwapMode); err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+	}
+	for i, zeroForOne := range []bool{true, false, true} {
+		limit := new(big.Int).Sub(constants.MaxSqrtRatio, big.NewInt(1))
+		if zeroForOne {
+			limit = new(big.Int).Add(constants.MinSqrtRatioBig, big.NewInt(1))
+		}
+		amount0, amount1, err := p.Swap("0xD", "0xD", zeroForOne, big.NewInt(1000000), limit)
+		if err != nil {
+			t.Fatalf("Swap failed: %v", err)
+		}
+		transactions = append(transactions, transaction.Transaction{
+			BlockNo:      2 + i,
+			Timestamp:    20 + i,
+			Method:       "SWAP",
+			Sender:       "0xD",
+			Recipient:    "0xD",
+			Amount0:      amount0,
+			Amount1:      amount1,
+			SqrtPriceX96: new(big.Int).Set(p.Slot0.SqrtPriceX96),
+			Tick:         p.Slot0.Tick,
+			Liquidity:    new(big.Int).Set(p.Liquidity),
+		})
+	}
+	return transactions, pool.Make("0xA", "0xB", 3000, 60)
+}
+
+func TestFirstDivergence(t *testing.T) {
+	fmt.Println("firstDivergence: Returns the first transaction that diverges and leaves the pool just before it")
+	transactions, p := divergenceTransactions(t)
+	if first := firstDivergence(transactions, p, transaction.ExactInputSwapMode); first != -1 {
+		t.Errorf("Got %d; want -1", first)
+	}
+	if last := transactions[len(transactions)-1]; p.Slot0.SqrtPriceX96.Cmp(last.SqrtPriceX96) != 0 {
+		t.Errorf("Got price %v; want %v, the price after the last transaction", p.Slot0.SqrtPriceX96, last.SqrtPriceX96)
+	}
+
+	// The second swap records a different tick.
+	transactions, p = divergenceTransactions(t)
+	transactions[3].Tick++
+	if first := firstDivergence(transactions, p, transaction.ExactInputSwapMode); first != 3 {
+		t.Errorf("Got %d; want 3", first)
+	}
+	if p.Slot0.SqrtPriceX96.Cmp(transactions[2].SqrtPriceX96) != 0 || p.BlockTimestamp != transactions[2].Timestamp {
+		t.Errorf("Got price %v at %d; want %v at %d, the state after transaction 2", p.Slot0.SqrtPriceX96, p.BlockTimestamp, transactions[2].SqrtPriceX96, transactions[2].Timestamp)
+	}
+
+	// A transaction that fails diverges, as it succeeded on chain.
+	transactions, p = divergenceTransactions(t)
+	transactions[1].Amount = new(big.Int).Add(pool.Make("0xA", "0xB", 3000, 60).MaxLiquidityPerTick, big.NewInt(1))
+	if first := firstDivergence(transactions, p, transaction.ExactInputSwapMode); first != 1 || len(p.Positions) != 0 {
+		t.Errorf("Got %d with %d positions; want 1 with none", first, len(p.Positions))
+	}
+}